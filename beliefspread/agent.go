@@ -223,3 +223,20 @@ func (a *Agent) UpdateActivationForAllBeliefs(
 
 	return nil
 }
+
+// ForgetHistory removes the activations and actions of the agent at every time
+// up to and including t.
+//
+// If keep is not nil, any time for which keep returns true is retained.
+func (a *Agent) ForgetHistory(t SimTime, keep func(SimTime) bool) {
+	for time := range a.Activations {
+		if time <= t && (keep == nil || !keep(time)) {
+			delete(a.Activations, time)
+		}
+	}
+	for time := range a.Actions {
+		if time <= t && (keep == nil || !keep(time)) {
+			delete(a.Actions, time)
+		}
+	}
+}
@@ -684,3 +684,45 @@ func TestUpdateActivationForAllBeliefsWhenErr(t *testing.T) {
 		t.Errorf("Expected delta not found error; got %s", err.Error())
 	}
 }
+
+func TestForgetHistoryRemovesUpToAndIncludingTime(t *testing.T) {
+	a := NewAgent()
+	belief := NewBelief("b")
+	behaviour := NewBehaviour("b")
+
+	for time := SimTime(0); time < 4; time++ {
+		a.Activations[time] = map[*Belief]float64{belief: 0.5}
+		a.Actions[time] = behaviour
+	}
+
+	a.ForgetHistory(1, nil)
+
+	if len(a.Activations) != 2 || a.Activations[2] == nil || a.Activations[3] == nil {
+		t.Errorf("Activations should only contain times 2 and 3; it was %v", a.Activations)
+	}
+
+	if len(a.Actions) != 2 || a.Actions[2] == nil || a.Actions[3] == nil {
+		t.Errorf("Actions should only contain times 2 and 3; it was %v", a.Actions)
+	}
+}
+
+func TestForgetHistoryRetainsKeptTimes(t *testing.T) {
+	a := NewAgent()
+	belief := NewBelief("b")
+	behaviour := NewBehaviour("b")
+
+	for time := SimTime(0); time < 4; time++ {
+		a.Activations[time] = map[*Belief]float64{belief: 0.5}
+		a.Actions[time] = behaviour
+	}
+
+	a.ForgetHistory(3, func(time SimTime) bool { return time%2 == 0 })
+
+	if len(a.Activations) != 2 || a.Activations[0] == nil || a.Activations[2] == nil {
+		t.Errorf("Activations should only contain times 0 and 2; it was %v", a.Activations)
+	}
+
+	if len(a.Actions) != 2 || a.Actions[0] == nil || a.Actions[2] == nil {
+		t.Errorf("Actions should only contain times 0 and 2; it was %v", a.Actions)
+	}
+}
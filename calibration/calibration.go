@@ -0,0 +1,300 @@
+// Package calibration fits the parameters of a model to observations.
+//
+// The fit of the model at a point in the space of the parameters is measured by
+// an Objective, such as the distance between the observations and the output of
+// the model at that point, which is minimised. The parameters are bounded by
+// their ranges.
+//
+// Two methods are implemented:
+//   - the simplex method of Nelder and Mead (1965), which finds the best-fit
+//     parameters without derivatives; and
+//   - rejection approximate Bayesian computation (ABC), which draws parameters
+//     from a uniform prior over their ranges and accepts those closest to the
+//     observations as samples from an approximate posterior.
+package calibration
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/0xr0bert/gobelief/sensitivity"
+)
+
+// Objective evaluates a batch of points, returning the value of each, which is
+// smaller for a better fit.
+//
+// The points of a batch are independent, so they may be evaluated
+// concurrently.
+type Objective func(points [][]float64) ([]float64, error)
+
+// NelderMead minimises an Objective with the simplex method of Nelder and
+// Mead.
+//
+// The simplex is searched in the unit hypercube of the ranges, and each vertex
+// is clamped to it, so the parameters never leave their ranges.
+type NelderMead struct {
+	// The ranges of the parameters.
+	Ranges []sensitivity.Range
+	// The starting point, or nil to start at the centre of the ranges.
+	Start []float64
+	// The size of the initial simplex, as a fraction of each range, or 0 for
+	// 0.25.
+	Step float64
+	// The maximum number of evaluations of the Objective.
+	MaxEvaluations int
+	// Stop once the values at the vertices of the simplex differ by no more
+	// than this.
+	Tolerance float64
+}
+
+// Fit is the best point found by NelderMead.
+type Fit struct {
+	// The best point.
+	Point []float64
+	// The value of the Objective at Point.
+	Value float64
+	// The number of evaluations of the Objective.
+	Evaluations int
+}
+
+// Minimise finds the point in the ranges with the smallest value of f.
+func (n *NelderMead) Minimise(f Objective) (*Fit, error) {
+	k := len(n.Ranges)
+	if k == 0 {
+		return nil, errors.New("there are no parameters")
+	}
+	if n.MaxEvaluations <= k {
+		return nil, fmt.Errorf("the maximum number of evaluations must be greater than %d", k)
+	}
+	if n.Start != nil && len(n.Start) != k {
+		return nil, fmt.Errorf("the starting point has %d parameters, not %d", len(n.Start), k)
+	}
+
+	step := n.Step
+	if step == 0 {
+		step = 0.25
+	}
+
+	start := make([]float64, k)
+	for i, r := range n.Ranges {
+		start[i] = 0.5
+		if n.Start != nil {
+			start[i] = clamp((n.Start[i] - r.Min) / (r.Max - r.Min))
+		}
+	}
+
+	evaluations := 0
+	evaluate := func(units ...[]float64) ([]float64, error) {
+		points := make([][]float64, len(units))
+		for i, unit := range units {
+			points[i] = sensitivity.Scale(n.Ranges, unit)
+		}
+		values, err := f(points)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(points) {
+			return nil, fmt.Errorf("expected %d values, got %d", len(points), len(values))
+		}
+		evaluations += len(points)
+		return values, nil
+	}
+
+	simplex := make([][]float64, k+1)
+	simplex[0] = start
+	for i := 0; i < k; i++ {
+		vertex := append([]float64(nil), start...)
+		if vertex[i]+step <= 1 {
+			vertex[i] += step
+		} else {
+			vertex[i] -= step
+		}
+		simplex[i+1] = vertex
+	}
+	values, err := evaluate(simplex...)
+	if err != nil {
+		return nil, err
+	}
+
+	for evaluations < n.MaxEvaluations {
+		sortSimplex(simplex, values)
+		if values[k]-values[0] <= n.Tolerance {
+			break
+		}
+
+		centroid := make([]float64, k)
+		for _, vertex := range simplex[:k] {
+			for i, x := range vertex {
+				centroid[i] += x / float64(k)
+			}
+		}
+		worst := simplex[k]
+
+		reflected := towards(centroid, worst, -1)
+		r, err := evaluate(reflected)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case r[0] < values[0]:
+			expanded := towards(centroid, worst, -2)
+			e, err := evaluate(expanded)
+			if err != nil {
+				return nil, err
+			}
+			if e[0] < r[0] {
+				simplex[k], values[k] = expanded, e[0]
+			} else {
+				simplex[k], values[k] = reflected, r[0]
+			}
+		case r[0] < values[k-1]:
+			simplex[k], values[k] = reflected, r[0]
+		default:
+			// Contract outside the simplex if the reflection improved on the
+			// worst vertex, and inside otherwise.
+			var contracted []float64
+			best := values[k]
+			if r[0] < values[k] {
+				contracted = towards(centroid, reflected, 0.5)
+				best = r[0]
+			} else {
+				contracted = towards(centroid, worst, 0.5)
+			}
+			c, err := evaluate(contracted)
+			if err != nil {
+				return nil, err
+			}
+			if c[0] < best {
+				simplex[k], values[k] = contracted, c[0]
+				break
+			}
+
+			// Shrink every vertex towards the best.
+			for i := 1; i <= k; i++ {
+				simplex[i] = towards(simplex[0], simplex[i], 0.5)
+			}
+			shrunk, err := evaluate(simplex[1:]...)
+			if err != nil {
+				return nil, err
+			}
+			copy(values[1:], shrunk)
+		}
+	}
+
+	sortSimplex(simplex, values)
+	return &Fit{
+		Point:       sensitivity.Scale(n.Ranges, simplex[0]),
+		Value:       values[0],
+		Evaluations: evaluations,
+	}, nil
+}
+
+// Rejection samples the approximate posterior of the parameters by rejection
+// ABC, with a uniform prior over the ranges.
+type Rejection struct {
+	// The ranges of the parameters.
+	Ranges []sensitivity.Range
+	// The number of draws from the prior.
+	Draws int
+	// The fraction of the draws with the smallest values which are accepted,
+	// in (0, 1].
+	Quantile float64
+	// If positive, the draws with values no greater than this are accepted
+	// instead.
+	Tolerance float64
+}
+
+// Sample is a point accepted by Rejection.
+type Sample struct {
+	// The point.
+	Point []float64
+	// The value of the Objective at Point, the distance from the observations.
+	Distance float64
+}
+
+// Sample draws points from the prior, evaluating them in a single batch, and
+// returns the accepted points in order of distance.
+func (r *Rejection) Sample(f Objective, rng *rand.Rand) ([]Sample, error) {
+	if len(r.Ranges) == 0 {
+		return nil, errors.New("there are no parameters")
+	}
+	if r.Draws <= 0 {
+		return nil, errors.New("the number of draws must be positive")
+	}
+	if r.Tolerance <= 0 && (r.Quantile <= 0 || r.Quantile > 1) {
+		return nil, errors.New("the quantile must be in (0, 1]")
+	}
+
+	points := make([][]float64, r.Draws)
+	for d := range points {
+		unit := make([]float64, len(r.Ranges))
+		for i := range unit {
+			unit[i] = rng.Float64()
+		}
+		points[d] = sensitivity.Scale(r.Ranges, unit)
+	}
+
+	distances, err := f(points)
+	if err != nil {
+		return nil, err
+	}
+	if len(distances) != len(points) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(points), len(distances))
+	}
+
+	samples := make([]Sample, r.Draws)
+	for d := range samples {
+		samples[d] = Sample{Point: points[d], Distance: distances[d]}
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Distance < samples[j].Distance
+	})
+
+	if r.Tolerance > 0 {
+		accepted := sort.Search(len(samples), func(i int) bool {
+			return samples[i].Distance > r.Tolerance
+		})
+		return samples[:accepted], nil
+	}
+
+	accepted := int(math.Ceil(r.Quantile * float64(r.Draws)))
+	return samples[:accepted], nil
+}
+
+// sortSimplex sorts the vertices of a simplex by their values.
+func sortSimplex(simplex [][]float64, values []float64) {
+	order := make([]int, len(simplex))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return values[order[i]] < values[order[j]]
+	})
+
+	sortedSimplex := make([][]float64, len(simplex))
+	sortedValues := make([]float64, len(values))
+	for i, o := range order {
+		sortedSimplex[i] = simplex[o]
+		sortedValues[i] = values[o]
+	}
+	copy(simplex, sortedSimplex)
+	copy(values, sortedValues)
+}
+
+// towards gets from + t * (to - from), clamped to the unit hypercube.
+func towards(from []float64, to []float64, t float64) []float64 {
+	x := make([]float64, len(from))
+	for i := range x {
+		x[i] = clamp(from[i] + t*(to[i]-from[i]))
+	}
+	return x
+}
+
+// clamp clamps x to [0, 1].
+func clamp(x float64) float64 {
+	return math.Min(math.Max(x, 0), 1)
+}
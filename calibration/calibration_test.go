@@ -0,0 +1,88 @@
+package calibration
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/0xr0bert/gobelief/sensitivity"
+)
+
+var ranges = []sensitivity.Range{
+	{Name: "x1", Min: -2, Max: 2},
+	{Name: "x2", Min: 0, Max: 4},
+}
+
+// objective is minimised at (0.5, 1.5).
+func objective(points [][]float64) ([]float64, error) {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = math.Pow(p[0]-0.5, 2.0) + 2*math.Pow(p[1]-1.5, 2.0)
+	}
+	return values, nil
+}
+
+func TestNelderMead(t *testing.T) {
+	n := NelderMead{Ranges: ranges, MaxEvaluations: 500, Tolerance: 1e-12}
+	fit, err := n.Minimise(objective)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(fit.Point[0]-0.5) > 1e-4 || math.Abs(fit.Point[1]-1.5) > 1e-4 {
+		t.Errorf("The fit should be (0.5, 1.5); it was %v", fit.Point)
+	}
+	if fit.Evaluations > 500 {
+		t.Errorf("There should be at most 500 evaluations; there were %d", fit.Evaluations)
+	}
+}
+
+func TestNelderMeadBounded(t *testing.T) {
+	bounded := []sensitivity.Range{{Name: "x1", Min: 1, Max: 2}, {Name: "x2", Min: 0, Max: 1}}
+	n := NelderMead{Ranges: bounded, MaxEvaluations: 500, Tolerance: 1e-12}
+	fit, err := n.Minimise(objective)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(fit.Point[0]-1) > 1e-4 || math.Abs(fit.Point[1]-1) > 1e-4 {
+		t.Errorf("The fit should be at the corner (1, 1); it was %v", fit.Point)
+	}
+}
+
+func TestNelderMeadRejectsStartOfWrongLength(t *testing.T) {
+	n := NelderMead{Ranges: ranges, Start: []float64{0.5}, MaxEvaluations: 500}
+	_, err := n.Minimise(objective)
+	if err == nil {
+		t.Error("Expected an error for a starting point with 1 parameter")
+	}
+}
+
+func TestRejection(t *testing.T) {
+	r := Rejection{Ranges: ranges, Draws: 2000, Quantile: 0.01}
+	samples, err := r.Sample(objective, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 20 {
+		t.Fatalf("There should be 20 samples; there were %d", len(samples))
+	}
+	for i, s := range samples {
+		if i > 0 && s.Distance < samples[i-1].Distance {
+			t.Error("Samples should be in order of distance")
+		}
+		if math.Abs(s.Point[0]-0.5) > 0.5 || math.Abs(s.Point[1]-1.5) > 0.5 {
+			t.Errorf("Sample %v should be near (0.5, 1.5)", s.Point)
+		}
+	}
+
+	r = Rejection{Ranges: ranges, Draws: 2000, Tolerance: samples[4].Distance}
+	accepted, err := r.Sample(objective, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accepted) != 5 {
+		t.Errorf("There should be 5 samples within the tolerance; there were %d", len(accepted))
+	}
+}
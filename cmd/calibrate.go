@@ -0,0 +1,430 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"github.com/0xr0bert/gobelief/calibration"
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/0xr0bert/gobelief/sensitivity"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// calibrateCmd fits the parameters of a scenario to observed behaviour
+var calibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Fit the parameters of a scenario to observed shares of behaviours",
+	Long: `Fit the parameters of a scenario to observed shares of agents performing
+each behaviour, such as from a survey.
+
+--observations gives a CSV file with a tick column, giving the tick of each
+row, and a column for each observed behaviour, named by its name or UUID,
+giving the share of agents performing it at that tick, in [0, 1]. Empty cells
+are not observed. The distance between a run and the observations is the root
+mean square difference between the observed and simulated shares.
+
+Each --parameter flag gives a free parameter and its bounds, as name=min,max.
+The parameters are those of the sweep command, except startTime and endTime.
+
+The methods are:
+
+  nelder-mead  minimise the distance with the Nelder-Mead simplex method,
+               writing the best-fit parameters
+  abc          rejection approximate Bayesian computation: run --draws draws
+               from a uniform prior over the bounds, and write the --quantile
+               closest to the observations (or those within --accept-distance)
+               as samples from the posterior
+
+The output is a CSV table with a column for each parameter and the distance,
+with a row for the best fit or for each posterior sample, in order of distance.
+Every run uses the same seed, which also generates the draws.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := zap.NewProduction()
+		if err != nil {
+			return
+		}
+
+		outputFilepath, err := cmd.Flags().GetString("output")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get output filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if outputFilepath == "" {
+			logger.Error(
+				"outputFilepath is unset",
+			)
+
+			return
+		}
+
+		parameters, err := cmd.Flags().GetStringArray("parameter")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get parameters",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		ranges, err := parseRanges(parameters)
+
+		if err != nil {
+			logger.Error(
+				"Failed to parse parameters",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		method, err := cmd.Flags().GetString("method")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get method",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get concurrency",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		seed, err := readSeed(cmd)
+
+		if err != nil {
+			logger.Error(
+				"Failed to get seed",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		base, err := newBaseConfiguration(cmd, seed)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read scenario",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		observations, err := readObservations(cmd, base)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read observations",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		// Only the names of the parameters are checked, so the point at the
+		// origin stands for every point the method will try.
+		err = runner.CheckParameters(rangePoints(ranges, [][]float64{make([]float64, len(ranges))}), base)
+
+		if err != nil {
+			logger.Error(
+				"Invalid parameters",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(
+			context.Background(),
+			os.Interrupt,
+			syscall.SIGTERM,
+		)
+		defer stop()
+
+		nAgents := len(base.Agents)
+
+		objective := func(points [][]float64) ([]float64, error) {
+			sweep := runner.Sweep{
+				NewConfiguration: func() (*runner.Configuration, error) {
+					return newBaseConfiguration(cmd, seed)
+				},
+				Points:      rangePoints(ranges, points),
+				Concurrency: concurrency,
+				Logger:      logger,
+			}
+
+			results, err := sweep.RunContext(ctx)
+
+			if err != nil {
+				return nil, err
+			}
+
+			distances := make([]float64, len(results))
+
+			for i, result := range results {
+				// A cancelled run would be ranked by the ticks it completed,
+				// as though it were a real fit.
+				if result.Summary.Truncated {
+					return nil, fmt.Errorf(
+						"run %d was cancelled after tick %d",
+						i,
+						result.Summary.LastTick,
+					)
+				}
+
+				distances[i], err = observations.Distance(result.Summary, nAgents)
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return distances, nil
+		}
+
+		var points [][]float64
+		var distances []float64
+
+		switch method {
+		case "nelder-mead":
+			points, distances, err = runNelderMead(cmd, ranges, objective)
+		case "abc":
+			points, distances, err = runRejection(cmd, ranges, objective, seed)
+		default:
+			err = fmt.Errorf("unknown method %q", method)
+		}
+
+		if err != nil {
+			logger.Error(
+				"Failed to calibrate",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		outputFile, err := os.Create(outputFilepath)
+
+		if err != nil {
+			logger.Error(
+				"Failed to create output file",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		defer outputFile.Close()
+
+		err = writeCalibrationTable(outputFile, ranges, points, distances)
+
+		if err != nil {
+			logger.Error(
+				"Failed to write output",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		logger.Info(
+			"Calibration finished",
+			zap.Int64("Seed", seed),
+			zap.Int("n samples", len(points)),
+		)
+	},
+}
+
+// readObservations reads the file of the --observations flag.
+func readObservations(cmd *cobra.Command, config *runner.Configuration) (*runner.Observations, error) {
+	observationsFilepath, err := cmd.Flags().GetString("observations")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if observationsFilepath == "" {
+		return nil, fmt.Errorf("observations filepath is unset")
+	}
+
+	observationsFile, err := os.Open(observationsFilepath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer observationsFile.Close()
+
+	return runner.ReadObservations(observationsFile, config.Behaviours)
+}
+
+// runNelderMead finds the best-fit point with the Nelder-Mead method.
+func runNelderMead(
+	cmd *cobra.Command,
+	ranges []sensitivity.Range,
+	objective calibration.Objective,
+) ([][]float64, []float64, error) {
+	maxEvaluations, err := cmd.Flags().GetInt("max-evaluations")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tolerance, err := cmd.Flags().GetFloat64("fit-tolerance")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	n := calibration.NelderMead{
+		Ranges:         ranges,
+		MaxEvaluations: maxEvaluations,
+		Tolerance:      tolerance,
+	}
+
+	fit, err := n.Minimise(objective)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return [][]float64{fit.Point}, []float64{fit.Value}, nil
+}
+
+// runRejection samples the posterior with rejection ABC.
+func runRejection(
+	cmd *cobra.Command,
+	ranges []sensitivity.Range,
+	objective calibration.Objective,
+	seed int64,
+) ([][]float64, []float64, error) {
+	draws, err := cmd.Flags().GetInt("draws")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	quantile, err := cmd.Flags().GetFloat64("quantile")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	acceptDistance, err := cmd.Flags().GetFloat64("accept-distance")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := calibration.Rejection{
+		Ranges:    ranges,
+		Draws:     draws,
+		Quantile:  quantile,
+		Tolerance: acceptDistance,
+	}
+
+	samples, err := r.Sample(objective, rand.New(rand.NewSource(seed)))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	points := make([][]float64, len(samples))
+	distances := make([]float64, len(samples))
+
+	for i, sample := range samples {
+		points[i] = sample.Point
+		distances[i] = sample.Distance
+	}
+
+	return points, distances, nil
+}
+
+// rangePoints converts points in the space of the ranges to Parameters.
+func rangePoints(ranges []sensitivity.Range, points [][]float64) []runner.Parameters {
+	parameters := make([]runner.Parameters, len(points))
+
+	for i, point := range points {
+		parameters[i] = make(runner.Parameters, len(ranges))
+		for k, r := range ranges {
+			parameters[i][r.Name] = point[k]
+		}
+	}
+
+	return parameters
+}
+
+// writeCalibrationTable writes points and their distances as a CSV table.
+func writeCalibrationTable(
+	w io.Writer,
+	ranges []sensitivity.Range,
+	points [][]float64,
+	distances []float64,
+) error {
+	writer := csv.NewWriter(w)
+
+	header := make([]string, 0, len(ranges)+1)
+
+	for _, r := range ranges {
+		header = append(header, r.Name)
+	}
+
+	writer.Write(append(header, "distance"))
+
+	for i, point := range points {
+		row := make([]string, 0, len(point)+1)
+		for _, x := range point {
+			row = append(row, strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		row = append(row, strconv.FormatFloat(distances[i], 'g', -1, 64))
+		writer.Write(row)
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func init() {
+	rootCmd.AddCommand(calibrateCmd)
+	addScenarioFlags(calibrateCmd)
+	addRunFlags(calibrateCmd)
+	calibrateCmd.Flags().StringP("output", "o", "", "The output CSV file (e.g., fit.csv)")
+	calibrateCmd.Flags().String("observations", "", "The CSV file of observed shares of behaviours")
+	calibrateCmd.Flags().StringArray("parameter", nil, "A free parameter and its bounds, as name=min,max (may be repeated)")
+	calibrateCmd.Flags().String("method", "nelder-mead", "The method (nelder-mead or abc)")
+	calibrateCmd.Flags().Int("max-evaluations", 200, "The maximum number of runs of the nelder-mead method")
+	calibrateCmd.Flags().Float64("fit-tolerance", 1e-6, "Stop the nelder-mead method once the distances of the simplex differ by no more than this")
+	calibrateCmd.Flags().Int("draws", 1000, "The number of draws from the prior of the abc method")
+	calibrateCmd.Flags().Float64("quantile", 0.01, "The fraction of the draws closest to the observations accepted by the abc method")
+	calibrateCmd.Flags().Float64("accept-distance", 0, "If positive, the abc method accepts draws within this distance instead")
+	calibrateCmd.Flags().Int("concurrency", runtime.NumCPU(), "The maximum number of runs at once")
+}
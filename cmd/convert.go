@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// convertCmd converts a summary output file to another format
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert a summary output file to another format",
+	Long: `Convert the summary statistics written by a run (e.g., output.json.zst) to
+another output format.
+
+The tidy formats (csv, tsv, parquet, arrow and arrow-stream) have the columns
+tick, entityType, entityUuid, entityName, statistic and value, with a row for
+each statistic of each belief and behaviour at each tick, so they can be loaded
+directly into R, pandas or polars. The behaviours and beliefs files name the
+entities. The csv and tsv formats also have the columns seed, truncated,
+lastTick and stopReason, which are the same in every row and record how the
+simulation stopped; the parquet, arrow and arrow-stream formats record them as
+their metadata.
+
+The sqlite format adds the summary as a run to a SQLite database, which is
+created if it does not exist, so the summaries of many runs can be collected
+in one database. The end time of the run is the last tick of a completed
+summary; a truncated or converged summary stopped before its end time, which
+must then be given by --end.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := zap.NewProduction()
+		if err != nil {
+			return
+		}
+
+		inputFilepath, err := cmd.Flags().GetString("input")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get input filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		outputFilepath, err := cmd.Flags().GetString("output")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get output filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if inputFilepath == "" || outputFilepath == "" {
+			logger.Error("--input and --output are required")
+
+			return
+		}
+
+		outputFormat, err := readOutputFormat(cmd)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read output format",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		behavioursFilepath, err := cmd.Flags().GetString("behaviours")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get behaviours filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		beliefsFilepath, err := cmd.Flags().GetString("beliefs")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get beliefs filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		behaviours, err := readBehavioursJson(behavioursFilepath)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read behaviours",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		beliefs, err := readBeliefsJson(beliefsFilepath, behaviours, false)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read beliefs",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		inputFile, err := os.Open(inputFilepath)
+
+		if err != nil {
+			logger.Error(
+				"Failed to open input file",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		defer inputFile.Close()
+
+		summary, err := runner.ReadOutputSpecs(inputFile)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read summary output",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if outputFormat == runner.OutputFormatSqlite {
+			var endTime b.SimTime
+			endTime, err = summaryEndTime(cmd, summary)
+
+			if err != nil {
+				logger.Error(
+					"Failed to get end time",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
+
+			err = writeSqliteOutput(cmd, logger, outputFilepath, &runner.SqliteRun{
+				StartTime:  summaryStartTime(summary),
+				EndTime:    endTime,
+				Behaviours: behaviours,
+				Beliefs:    beliefs,
+				Summary:    summary,
+			})
+		} else {
+			err = writeSummaryFile(outputFilepath, summary, behaviours, beliefs, outputFormat)
+		}
+
+		if err != nil {
+			logger.Error(
+				"Failed to write output",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		logger.Info(
+			"Converted output",
+			zap.String("Input", inputFilepath),
+			zap.String("Output", outputFilepath),
+			zap.String("Format", string(outputFormat)),
+		)
+	},
+}
+
+// writeSummaryFile writes the summary statistics of a simulation to a new
+// file at path in the format.
+func writeSummaryFile(
+	path string,
+	summary *runner.OutputSpecs,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	format runner.OutputFormat,
+) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	err = runner.WriteSummary(file, summary, behaviours, beliefs, format)
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// summaryStartTime gets the first tick of a summary, or its last tick if it
+// has none.
+func summaryStartTime(summary *runner.OutputSpecs) b.SimTime {
+	start := summary.LastTick
+
+	for time := range summary.Data {
+		if time < start {
+			start = time
+		}
+	}
+
+	return start
+}
+
+// summaryEndTime gets the end time of the simulation of a summary, from the
+// --end flag if it is set, or the last tick of a completed summary.
+//
+// A truncated or converged summary stopped before its end time, so it is an
+// error if --end is not set for one.
+func summaryEndTime(cmd *cobra.Command, summary *runner.OutputSpecs) (b.SimTime, error) {
+	if !cmd.Flags().Changed("end") {
+		if summary.StopReason != runner.StopReasonCompleted {
+			return 0, fmt.Errorf("--end is required for a summary which stopped with %q", summary.StopReason)
+		}
+
+		return summary.LastTick, nil
+	}
+
+	endTime, err := cmd.Flags().GetUint32("end")
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get end time: %w", err)
+	}
+
+	if b.SimTime(endTime) < summary.LastTick {
+		return 0, fmt.Errorf("--end %d is before the last tick of the summary, %d", endTime, summary.LastTick)
+	}
+
+	return b.SimTime(endTime), nil
+}
+
+// writeSqliteOutput adds a run, labelled by the --run-label flag, to the SQLite
+// database at path.
+func writeSqliteOutput(cmd *cobra.Command, logger *zap.Logger, path string, run *runner.SqliteRun) error {
+	label, err := cmd.Flags().GetString("run-label")
+
+	if err != nil {
+		return fmt.Errorf("failed to get run label: %w", err)
+	}
+
+	run.Label = label
+
+	db, err := runner.OpenSqlite(path)
+
+	if err != nil {
+		return err
+	}
+
+	runId, err := runner.WriteSqliteRun(db, run)
+
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	logger.Info(
+		"Wrote run to database",
+		zap.String("File", path),
+		zap.Int64("Run", runId),
+	)
+
+	return db.Close()
+}
+
+// addRunLabelFlag adds the --run-label flag used by writeSqliteOutput.
+func addRunLabelFlag(cmd *cobra.Command) {
+	cmd.Flags().String("run-label", "", "With --output-format sqlite, a label for the run in the database")
+}
+
+// addOutputFormatFlag adds the --output-format flag to a command, with a
+// default format.
+func addOutputFormatFlag(cmd *cobra.Command, defaultFormat runner.OutputFormat) {
+	cmd.Flags().String(
+		"output-format",
+		string(defaultFormat),
+		fmt.Sprintf("The format of the output (%s)", joinNames(runner.OutputFormats)),
+	)
+}
+
+// readOutputFormat reads the --output-format flag added by
+// addOutputFormatFlag.
+func readOutputFormat(cmd *cobra.Command) (runner.OutputFormat, error) {
+	name, err := cmd.Flags().GetString("output-format")
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get output format: %w", err)
+	}
+
+	return runner.ParseOutputFormat(name)
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringP("manifest", "m", "", "A JSON or YAML scenario manifest, whose behaviours and beliefs are overridden by the other flags")
+	convertCmd.Flags().StringP("behaviours", "b", "", "The behaviours.json file")
+	convertCmd.Flags().StringP("beliefs", "c", "", "The beliefs.json file")
+	convertCmd.Flags().StringP("input", "i", "", "The summary output file to convert (e.g., output.json.zst)")
+	convertCmd.Flags().StringP("output", "o", "", "The converted output file (e.g., output.csv)")
+	addOutputFormatFlag(convertCmd, runner.OutputFormatCsv)
+	addRunLabelFlag(convertCmd)
+	convertCmd.Flags().Uint32P("end", "e", 0, "With --output-format sqlite, the end time of a truncated or converged simulation")
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/0xr0bert/gobelief/dense"
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// driftCmd compares the accuracy of reduced precisions against float64
+var driftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Measure the drift of reduced precisions from float64",
+	Long: `Measure the drift of the dense engine at reduced precisions from the same
+simulation at float64 precision.
+
+The simulation is run once at float64 precision, and once at each of the
+reduced precisions, with the same seed. For each precision this prints:
+
+  - the bytes used to store the state of the simulation, and the fraction of
+    the bytes used at float64 precision;
+  - the largest absolute difference in the mean and median activation of any
+    belief at any tick; and
+  - the largest absolute difference in the share of agents performing any
+    behaviour at any tick.
+
+Behaviours are chosen stochastically, so a small difference in activation can
+change the behaviour an agent chooses, after which the runs diverge like two
+runs with different seeds. The behaviour share drift includes this divergence.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := zap.NewProduction()
+		if err != nil {
+			return
+		}
+
+		precisionNames, err := cmd.Flags().GetStringSlice("precisions")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get precisions",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		precisions := []dense.Precision{dense.Float64}
+
+		for _, name := range precisionNames {
+			precision, err := dense.ParsePrecision(name)
+
+			if err != nil {
+				logger.Error(
+					"Invalid precision",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
+
+			precisions = append(precisions, precision)
+		}
+
+		seed, err := readSeed(cmd)
+
+		if err != nil {
+			logger.Error(
+				"Failed to get seed",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		summaries := make([]*runner.OutputSpecs, len(precisions))
+		bytes := make([]int, len(precisions))
+		nAgents := 0
+
+		for i, precision := range precisions {
+			// The simulation modifies the agents, so they are read again for
+			// every precision.
+			config, err := readScenario(cmd)
+
+			if err != nil {
+				logger.Error(
+					"Failed to read scenario",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
+
+			config.Engine = runner.DenseEngine
+			config.Precision = precision
+			config.Seed = &seed
+			config.HistoryLength = 1
+			nAgents = len(config.Agents)
+
+			bytes[i] = dense.StateBytes(
+				len(config.Agents),
+				len(config.Beliefs),
+				len(config.Behaviours),
+				dense.CountEdges(config.Agents),
+				precision,
+			)
+
+			simRunner := runner.Runner{
+				Configuration: config,
+				Logger:        logger,
+			}
+			result, err := simRunner.Run()
+
+			if err != nil {
+				logger.Error(
+					"Failed to run simulation",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
+
+			summaries[i] = result.Summary
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PRECISION\tSTATE BYTES\tRELATIVE\tMEAN DRIFT\tMEDIAN DRIFT\tSHARE DRIFT")
+
+		for i, precision := range precisions {
+			drift := runner.NewDrift(summaries[0], summaries[i], nAgents)
+			fmt.Fprintf(
+				w,
+				"%s\t%d\t%.3f\t%.3g\t%.3g\t%.3g\n",
+				precision,
+				bytes[i],
+				float64(bytes[i])/float64(bytes[0]),
+				drift.MaxMeanActivation(),
+				drift.MaxMedianActivation(),
+				drift.MaxBehaviourShare(),
+			)
+		}
+
+		err = w.Flush()
+
+		if err != nil {
+			logger.Error(
+				"Failed to write drift",
+				zap.String("errorMessage", err.Error()),
+			)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(driftCmd)
+	addScenarioFlags(driftCmd)
+	driftCmd.Flags().StringSlice("precisions", []string{"float32", "int16"}, "The reduced precisions to compare against float64")
+	driftCmd.Flags().Int64("seed", 0, "The seed of the random number generator (default random)")
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+)
+
+// applyManifest sets the flags of a command from the manifest given by its
+// --manifest flag, if any.
+//
+// Flags which were set on the command line override the manifest, and values
+// for flags which the command does not have are ignored. The output and
+// output format of the manifest are only used by the root command, as the
+// outputs of other commands are different kinds of file.
+func applyManifest(cmd *cobra.Command) error {
+	if cmd.Flags().Lookup("manifest") == nil {
+		return nil
+	}
+
+	manifestFilepath, err := cmd.Flags().GetString("manifest")
+
+	if err != nil {
+		return fmt.Errorf("failed to get manifest filepath: %w", err)
+	}
+
+	if manifestFilepath == "" {
+		return nil
+	}
+
+	manifest, err := runner.ReadManifest(manifestFilepath)
+
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(manifest).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("flag")
+		value, set := manifestValue(v.Field(i))
+
+		if !set || cmd.Flags().Lookup(name) == nil || cmd.Flags().Changed(name) {
+			continue
+		}
+
+		if (name == "output" || name == "output-format") && cmd.HasParent() {
+			continue
+		}
+
+		err = cmd.Flags().Set(name, value)
+
+		if err != nil {
+			return fmt.Errorf("invalid %s in manifest: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// manifestValue formats a field of a Manifest as the value of a flag, and
+// gets whether it is set.
+func manifestValue(field reflect.Value) (string, bool) {
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), field.String() != ""
+	case reflect.Pointer:
+		if field.IsNil() {
+			return "", false
+		}
+		return fmt.Sprint(field.Elem().Interface()), true
+	case reflect.Slice:
+		if field.IsNil() {
+			return "", false
+		}
+		values := make([]string, field.Len())
+		for i := range values {
+			values[i] = fmt.Sprint(field.Index(i).Interface())
+		}
+		return strings.Join(values, ","), true
+	default:
+		return "", false
+	}
+}
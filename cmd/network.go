@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// networkCmd exports the network and states of a full output file
+var networkCmd = &cobra.Command{
+	Use:   "network",
+	Short: "Export the network and states of a full output file to GraphML or GEXF",
+	Long: `Export the network of friends in a full output file (e.g., full.json.zst),
+with the state of each agent, to GraphML or GEXF, so it can be visualised in
+Gephi.
+
+Each node is an agent, identified by its UUID, with a behaviour attribute
+naming the behaviour it performed, and an attribute for each belief, named by
+the beliefs file, with its activation. Each edge is directed from an agent to
+a friend, weighted by the weight of the friend.
+
+The state is the state at the last tick from --from to --to. With --dynamic,
+the GEXF network instead has the state at every tick from --from to --to, with
+the tick as its timestamp, so Gephi can animate the spread of beliefs over
+time.
+
+The state at the end of a run can also be exported by the run, with
+--network-output.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := zap.NewProduction()
+		if err != nil {
+			return
+		}
+
+		inputFilepath, err := cmd.Flags().GetString("input")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get input filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		outputFilepath, err := cmd.Flags().GetString("output")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get output filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if inputFilepath == "" || outputFilepath == "" {
+			logger.Error("--input and --output are required")
+
+			return
+		}
+
+		formatName, err := cmd.Flags().GetString("output-format")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get output format",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		dynamic, err := cmd.Flags().GetBool("dynamic")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get dynamic flag",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		format, err := readNetworkOutputFormat(outputFilepath, formatName, dynamic)
+
+		if err != nil {
+			logger.Error(
+				"Invalid output format",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		from, err := cmd.Flags().GetUint32("from")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get first tick",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		to, err := cmd.Flags().GetUint32("to")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get last tick",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		behavioursFilepath, err := cmd.Flags().GetString("behaviours")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get behaviours filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		beliefsFilepath, err := cmd.Flags().GetString("beliefs")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get beliefs filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		behaviours, err := readBehavioursJson(behavioursFilepath)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read behaviours",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		beliefs, err := readBeliefsJson(beliefsFilepath, behaviours, false)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read beliefs",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		inputFile, err := os.Open(inputFilepath)
+
+		if err != nil {
+			logger.Error(
+				"Failed to open input file",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		defer inputFile.Close()
+
+		agents, err := runner.ReadFullOutputAgents(
+			inputFile,
+			runner.FullOutputFilter{
+				Ticks: []runner.TickRange{{From: b.SimTime(from), To: b.SimTime(to)}},
+			},
+			behaviours,
+			beliefs,
+		)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read full output",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		err = writeNetworkFile(outputFilepath, format, dynamic, agents, beliefs, lastAgentTick(agents))
+
+		if err != nil {
+			logger.Error(
+				"Failed to write network",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		logger.Info(
+			"Exported network",
+			zap.String("Input", inputFilepath),
+			zap.String("Output", outputFilepath),
+			zap.String("Format", string(format)),
+			zap.Int("n agents", len(agents)),
+		)
+	},
+}
+
+// readNetworkOutputFormat gets the format in which a network is exported to
+// path, which is formatName, or detected from the extension of path if it is
+// empty.
+//
+// Only GraphML and GEXF can be exported, and only GEXF if dynamic.
+func readNetworkOutputFormat(path string, formatName string, dynamic bool) (runner.NetworkFormat, error) {
+	var format runner.NetworkFormat
+	var err error
+
+	if formatName == "" {
+		format, err = runner.NetworkFormatOf(path)
+	} else {
+		format, err = runner.ParseNetworkFormat(formatName)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if format != runner.NetworkFormatGraphml && format != runner.NetworkFormatGexf {
+		return "", fmt.Errorf("a network can only be exported as graphml or gexf, not %s", format)
+	}
+
+	if dynamic && format != runner.NetworkFormatGexf {
+		return "", fmt.Errorf("a dynamic network can only be exported as gexf, not %s", format)
+	}
+
+	return format, nil
+}
+
+// writeNetworkFile writes the network of agents to a new file at path in the
+// format, with their states at tick time, or at every tick if dynamic.
+func writeNetworkFile(
+	path string,
+	format runner.NetworkFormat,
+	dynamic bool,
+	agents []*b.Agent,
+	beliefs []*b.Belief,
+	time b.SimTime,
+) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	if dynamic {
+		err = runner.WriteDynamicGexf(file, agents, beliefs)
+	} else {
+		err = runner.WriteNetwork(file, format, agents, beliefs, time)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// lastAgentTick gets the last tick with an activation or action of any agent.
+func lastAgentTick(agents []*b.Agent) b.SimTime {
+	var last b.SimTime
+
+	for _, a := range agents {
+		for time := range a.Activations {
+			last = max(last, time)
+		}
+
+		for time := range a.Actions {
+			last = max(last, time)
+		}
+	}
+
+	return last
+}
+
+func init() {
+	rootCmd.AddCommand(networkCmd)
+	networkCmd.Flags().StringP("manifest", "m", "", "A JSON or YAML scenario manifest, whose behaviours and beliefs are overridden by the other flags")
+	networkCmd.Flags().StringP("behaviours", "b", "", "The behaviours.json file")
+	networkCmd.Flags().StringP("beliefs", "c", "", "The beliefs.json file")
+	networkCmd.Flags().StringP("input", "i", "", "The full output file (e.g., full.json.zst)")
+	networkCmd.Flags().StringP("output", "o", "", "The network file (e.g., network.gexf)")
+	networkCmd.Flags().String("output-format", "", "The format of the network (graphml or gexf) (default detected from the extension)")
+	networkCmd.Flags().Bool("dynamic", false, "Export the state at every tick as a dynamic GEXF network")
+	networkCmd.Flags().Uint32("from", 0, "The first tick of the full output which is read")
+	networkCmd.Flags().Uint32("to", math.MaxUint32, "The last tick of the full output which is read")
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// runReplicates runs nReplicates replicates of the simulation in config, and
+// writes the distribution of their summary statistics to output.
+//
+// Replicate i uses the seed config.Seed+i. Every replicate other than the first
+// reads the scenario again, so replicates have their own agents.
+func runReplicates(
+	ctx context.Context,
+	cmd *cobra.Command,
+	logger *zap.Logger,
+	config *runner.Configuration,
+	output io.Writer,
+	nReplicates int,
+) error {
+	concurrency, err := cmd.Flags().GetInt("replicate-concurrency")
+
+	if err != nil {
+		return fmt.Errorf("failed to get replicate concurrency: %w", err)
+	}
+
+	keepReplicates, err := cmd.Flags().GetBool("keep-replicates")
+
+	if err != nil {
+		return fmt.Errorf("failed to get keep replicates flag: %w", err)
+	}
+
+	percentiles, err := cmd.Flags().GetFloat64Slice("percentiles")
+
+	if err != nil {
+		return fmt.Errorf("failed to get percentiles: %w", err)
+	}
+
+	for _, p := range percentiles {
+		if p < 0 || p > 100 {
+			return fmt.Errorf("percentile %g is not in [0, 100]", p)
+		}
+	}
+
+	baseSeed := *config.Seed
+	config.OutputFile = nil
+
+	replicates := runner.Replicates{
+		NewConfiguration: func(replicate int) (*runner.Configuration, error) {
+			if replicate == 0 {
+				return config, nil
+			}
+
+			c, err := readScenario(cmd)
+
+			if err != nil {
+				return nil, err
+			}
+
+			err = readRunOptions(cmd, c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			seed := baseSeed + int64(replicate)
+			c.Seed = &seed
+
+			return c, nil
+		},
+		N:           nReplicates,
+		Concurrency: concurrency,
+		Logger:      logger,
+	}
+
+	results, err := replicates.RunContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	summaries := make([]*runner.OutputSpecs, len(results))
+
+	for i, result := range results {
+		summaries[i] = result.Summary
+	}
+
+	aggregate := runner.AggregateReplicates(summaries, percentiles)
+
+	if keepReplicates {
+		aggregate.Replicates = summaries
+	}
+
+	logger.Info("Writing aggregated output")
+
+	return runner.WriteAggregateOutputSpecs(output, aggregate)
+}
+
+// addReplicateFlags adds the flags which define how replicates are run to a
+// command.
+func addReplicateFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("replicates", 1, "The number of replicates to run with consecutive seeds, writing the distribution of the summary statistics across them")
+	cmd.Flags().Int("replicate-concurrency", runtime.NumCPU(), "The maximum number of replicates to run at once")
+	cmd.Flags().Bool("keep-replicates", false, "Also write the summary statistics of each replicate")
+	cmd.Flags().Float64Slice("percentiles", runner.DefaultPercentiles, "The percentiles of each statistic across replicates")
+}
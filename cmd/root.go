@@ -2,13 +2,13 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	b "github.com/0xr0bert/gobelief/beliefspread"
 	"github.com/0xr0bert/gobelief/runner"
-	"github.com/google/uuid"
-	"github.com/klauspost/compress/zstd"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -23,6 +23,9 @@ examples and usage of using your application. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyManifest(cmd)
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
@@ -30,357 +33,479 @@ to quickly create a Cobra application.`,
 		if err != nil {
 			return
 		}
-		config := new(runner.Configuration)
 
-		startTime, err := cmd.Flags().GetUint32("start")
+		outputFilepath, err := cmd.Flags().GetString("output")
 
 		if err != nil {
 			logger.Error(
-				"Failed to load start time",
+				"Failed to get output filepath",
 				zap.String("errorMessage", err.Error()),
 			)
+
 			return
 		}
 
-		config.StartTime = b.SimTime(startTime)
+		if outputFilepath == "" {
+			logger.Error(
+				"outputFilepath is unset",
+			)
+
+			return
+		}
 
-		endTime, err := cmd.Flags().GetUint32("end")
+		nShards, err := cmd.Flags().GetInt("shards")
 
 		if err != nil {
 			logger.Error(
-				"Failed to load end time",
+				"Failed to get number of shards",
 				zap.String("errorMessage", err.Error()),
 			)
+
 			return
 		}
 
-		config.EndTime = b.SimTime(endTime)
-
-		outputFilepath, err := cmd.Flags().GetString("output")
+		nReplicates, err := cmd.Flags().GetInt("replicates")
 
 		if err != nil {
 			logger.Error(
-				"Failed to get output filepath",
+				"Failed to get number of replicates",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		if outputFilepath == "" {
-			logger.Error(
-				"outputFilepath is unset",
-			)
+		if nShards > 1 && nReplicates > 1 {
+			logger.Error("--shards and --replicates cannot be used together")
 
 			return
 		}
 
-		outputFile, err := os.Create(outputFilepath)
+		networkFilepath, err := cmd.Flags().GetString("network")
 
 		if err != nil {
 			logger.Error(
-				"Failed to create output file",
+				"Failed to get network filepath",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		config.OutputFile = outputFile
+		if nShards > 1 && networkFilepath != "" {
+			logger.Error("--network is not supported with --shards")
 
-		behavioursFilepath, err := cmd.Flags().GetString("behaviours")
+			return
+		}
+
+		var config *runner.Configuration
+		var agentsFilepath string
+
+		if nShards > 1 {
+			config, agentsFilepath, err = readScenarioWithoutAgents(cmd)
+		} else {
+			config, err = readScenario(cmd)
+		}
 
 		if err != nil {
 			logger.Error(
-				"Failed to get behaviours filepath",
+				"Failed to read scenario",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		if behavioursFilepath == "" {
-			logger.Error("behavioursFilepath is unset")
-
-			return
-		}
-
-		behaviours, err := readBehavioursJson(behavioursFilepath)
+		err = readRunOptions(cmd, config)
 
 		if err != nil {
 			logger.Error(
-				"Failed to read behaviours file",
+				"Failed to read run options",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		config.Behaviours = behaviours
-
-		beliefsFilepath, err := cmd.Flags().GetString("beliefs")
+		fullOutput, err := cmd.Flags().GetBool("full")
 
 		if err != nil {
 			logger.Error(
-				"Failed to get beliefs filepath",
+				"Failed to get full output flag",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		if beliefsFilepath == "" {
-			logger.Error("beliefsFilepath unset")
+		config.FullOutput = fullOutput
+
+		if fullOutput && nShards > 1 {
+			logger.Error("Full output is not supported with --shards")
 
 			return
 		}
 
-		beliefs, err := readBeliefsJson(beliefsFilepath, behaviours)
+		if fullOutput && nReplicates > 1 {
+			logger.Error("Full output is not supported with --replicates")
+
+			return
+		}
+
+		outputFormat, err := readOutputFormat(cmd)
 
 		if err != nil {
 			logger.Error(
-				"Failed to read beliefs file",
+				"Failed to read output format",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		config.Beliefs = beliefs
+		config.OutputFormat = outputFormat
 
-		agentsFilepath, err := cmd.Flags().GetString("agents")
-
-		if err != nil {
-			logger.Error(
-				"Failed to get agents filepath",
-				zap.String("errorMessage", err.Error()),
-			)
+		if fullOutput && (outputFormat == runner.OutputFormatCsv || outputFormat == runner.OutputFormatTsv) {
+			logger.Error("--output-format must be json, parquet, arrow, arrow-stream or sqlite with --full")
 
 			return
 		}
 
-		if agentsFilepath == "" {
-			logger.Error("agentsFilepath unset")
+		if outputFormat != runner.OutputFormatJson && nReplicates > 1 {
+			logger.Error("--output-format must be json with --replicates")
 
 			return
 		}
 
-		agents, err := readAgentsJson(agentsFilepath, behaviours, beliefs)
+		networkOutputFilepath, err := cmd.Flags().GetString("network-output")
 
 		if err != nil {
 			logger.Error(
-				"Failed to read agents file",
+				"Failed to get network output filepath",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		config.Agents = agents
-
-		prsFilepath, err := cmd.Flags().GetString("prs")
+		networkDynamic, err := cmd.Flags().GetBool("network-dynamic")
 
 		if err != nil {
 			logger.Error(
-				"Failed to get prs filepath",
+				"Failed to get network dynamic flag",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		if prsFilepath == "" {
-			logger.Error("prsFilepath unset")
+		var networkOutputFormat runner.NetworkFormat
 
-			return
+		if networkOutputFilepath != "" {
+			if nShards > 1 || nReplicates > 1 {
+				logger.Error("--network-output is not supported with --shards or --replicates")
+
+				return
+			}
+
+			// Only the full output keeps every tick of the dense engine in
+			// the agents.
+			if networkDynamic && !fullOutput {
+				logger.Error("--network-dynamic requires --full")
+
+				return
+			}
+
+			networkOutputFormat, err = readNetworkOutputFormat(networkOutputFilepath, "", networkDynamic)
+
+			if err != nil {
+				logger.Error(
+					"Invalid network output format",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
 		}
 
-		prs, err := readPrsJson(prsFilepath, beliefs, behaviours)
+		burnInStateFilepath, err := cmd.Flags().GetString("burn-in-state")
 
 		if err != nil {
 			logger.Error(
-				"Failed to read prs file",
+				"Failed to get burn-in state filepath",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		config.Prs = prs
+		if burnInStateFilepath != "" && (nShards > 1 || nReplicates > 1) {
+			logger.Error("--burn-in-state is not supported with --shards or --replicates")
 
-		fullOutput, err := cmd.Flags().GetBool("full")
+			return
+		}
+
+		if burnInStateFilepath != "" && config.BurnIn == 0 {
+			logger.Error("--burn-in-state requires --burn-in")
+
+			return
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
 
 		if err != nil {
 			logger.Error(
-				"Failed to get full output flag",
+				"Failed to get timeout",
 				zap.String("errorMessage", err.Error()),
 			)
 
 			return
 		}
 
-		config.FullOutput = fullOutput
+		var outputFile *os.File
 
-		simRunner := runner.Runner{
-			Configuration: config,
-			Logger:        logger,
-		}
-		simRunner.Run()
-	},
-}
+		// The sqlite output is written to the database after the run, rather
+		// than to the output file.
+		if outputFormat != runner.OutputFormatSqlite {
+			outputFile, err = os.Create(outputFilepath)
 
-// Execute adds all child commands to the root command and sets flags appropriately.
-// This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
-	}
-}
+			if err != nil {
+				logger.Error(
+					"Failed to create output file",
+					zap.String("errorMessage", err.Error()),
+				)
 
-func init() {
-	rootCmd.Flags().Uint32P("start", "s", 1, "The start time of the simulation")
-	rootCmd.Flags().Uint32P("end", "e", 1, "The end time of the simulation")
-	rootCmd.Flags().StringP("output", "o", "", "The output file (e.g., output.json.zst)")
-	rootCmd.Flags().StringP("behaviours", "b", "", "The behaviours.json file")
-	rootCmd.Flags().StringP("beliefs", "c", "", "The beliefs.json file")
-	rootCmd.Flags().StringP("agents", "a", "", "The agents.json.zst file")
-	rootCmd.Flags().StringP("prs", "p", "", "The prs.json file")
-	rootCmd.Flags().Bool("full", false, "Whether to serialize the full state of the simulation")
-}
+				return
+			}
 
-func readBehavioursJson(path string) ([]*b.Behaviour, error) {
-	data, err := os.ReadFile(path)
+			defer outputFile.Close()
 
-	if err != nil {
-		return nil, err
-	}
+			config.OutputFile = outputFile
+		}
 
-	// var behaviourSpecs
-	var behaviourSpecs []runner.BehaviourSpec
-	err = json.Unmarshal(data, &behaviourSpecs)
+		if fullOutput && outputFormat == runner.OutputFormatParquet {
+			actionsOutputFilepath, err := cmd.Flags().GetString("actions-output")
 
-	if err != nil {
-		return nil, err
-	}
+			if err != nil {
+				logger.Error(
+					"Failed to get actions output filepath",
+					zap.String("errorMessage", err.Error()),
+				)
 
-	behaviours := make([]*b.Behaviour, len(behaviourSpecs))
+				return
+			}
 
-	for i, spec := range behaviourSpecs {
-		behaviours[i] = spec.ToBehaviour()
-	}
+			if actionsOutputFilepath == "" {
+				actionsOutputFilepath = strings.TrimSuffix(outputFilepath, ".parquet") + ".actions.parquet"
+			}
 
-	return behaviours, nil
-}
+			actionsOutputFile, err := os.Create(actionsOutputFilepath)
 
-func readBeliefsJson(path string, behaviours []*b.Behaviour) ([]*b.Belief, error) {
-	data, err := os.ReadFile(path)
+			if err != nil {
+				logger.Error(
+					"Failed to create actions output file",
+					zap.String("errorMessage", err.Error()),
+				)
 
-	if err != nil {
-		return nil, err
-	}
+				return
+			}
 
-	var beliefSpecs []runner.BeliefSpec
-	err = json.Unmarshal(data, &beliefSpecs)
+			defer actionsOutputFile.Close()
 
-	if err != nil {
-		return nil, err
-	}
+			config.ActionsOutputFile = actionsOutputFile
+		}
 
-	beliefs := make([]*b.Belief, len(beliefSpecs))
+		// The JSON full output is an agents file, which cannot record whether
+		// the simulation was truncated, so the summary is written beside it.
+		if fullOutput && (outputFormat == "" || outputFormat == runner.OutputFormatJson) {
+			summaryOutputFilepath, err := cmd.Flags().GetString("summary-output")
 
-	for i, spec := range beliefSpecs {
-		beliefs[i] = spec.ToBelief(behaviours)
-	}
+			if err != nil {
+				logger.Error(
+					"Failed to get summary output filepath",
+					zap.String("errorMessage", err.Error()),
+				)
 
-	for _, spec := range beliefSpecs {
-		spec.LinkBeliefRelationships(beliefs)
-	}
+				return
+			}
 
-	return beliefs, nil
-}
+			if summaryOutputFilepath == "" {
+				summaryOutputFilepath = strings.TrimSuffix(outputFilepath, ".json.zst") + ".summary.json.zst"
+			}
 
-func readAgentsJson(
-	path string,
-	behaviours []*b.Behaviour,
-	beliefs []*b.Belief,
-) ([]*b.Agent, error) {
-	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+			summaryOutputFile, err := os.Create(summaryOutputFilepath)
 
-	if err != nil {
-		return nil, err
-	}
+			if err != nil {
+				logger.Error(
+					"Failed to create summary output file",
+					zap.String("errorMessage", err.Error()),
+				)
 
-	data, err := os.ReadFile(path)
+				return
+			}
 
-	if err != nil {
-		return nil, err
-	}
+			defer summaryOutputFile.Close()
 
-	uncompressedData, err := decoder.DecodeAll(data, nil)
+			config.SummaryOutputFile = summaryOutputFile
+		}
 
-	data = nil
+		if burnInStateFilepath != "" {
+			burnInStateFile, err := os.Create(burnInStateFilepath)
 
-	if err != nil {
-		return nil, err
-	}
+			if err != nil {
+				logger.Error(
+					"Failed to create burn-in state file",
+					zap.String("errorMessage", err.Error()),
+				)
 
-	var agentSpecs []runner.AgentSpec
-	err = json.Unmarshal(uncompressedData, &agentSpecs)
+				return
+			}
 
-	uncompressedData = nil
+			defer burnInStateFile.Close()
 
-	if err != nil {
-		return nil, err
-	}
+			config.BurnInStateFile = burnInStateFile
+		}
 
-	agents := make([]*b.Agent, len(agentSpecs))
+		// Stop at the next tick boundary on SIGINT, SIGTERM or the timeout, so the
+		// output accumulated so far is still written.
+		ctx, stop := signal.NotifyContext(
+			context.Background(),
+			os.Interrupt,
+			syscall.SIGTERM,
+		)
+		defer stop()
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
 
-	for i, spec := range agentSpecs {
-		agents[i] = spec.ToAgent(behaviours, beliefs)
-	}
+		if nReplicates > 1 {
+			err = runReplicates(ctx, cmd, logger, config, outputFile, nReplicates)
 
-	uuidAgents := make(map[uuid.UUID]*b.Agent, len(agents))
+			if err != nil {
+				logger.Error(
+					"Failed to run replicates",
+					zap.String("errorMessage", err.Error()),
+				)
 
-	for _, agent := range agents {
-		uuidAgents[agent.Uuid] = agent
-	}
+				return
+			}
 
-	for _, spec := range agentSpecs {
-		spec.LinkFriends(uuidAgents)
-	}
+			logger.Info(
+				"Replicates finished",
+				zap.Int64("First seed", *config.Seed),
+				zap.Int("n replicates", nReplicates),
+			)
 
-	return agents, nil
-}
+			return
+		}
 
-func readPrsJson(
-	path string,
-	beliefs []*b.Belief,
-	behaviours []*b.Behaviour,
-) (runner.PerformanceRelationships, error) {
-	data, err := os.ReadFile(path)
+		var result *runner.Result
+
+		if nShards > 1 {
+			var strict bool
+			strict, err = readStrict(cmd)
+
+			if err == nil {
+				result, err = runSharded(ctx, logger, config, agentsFilepath, nShards, strict)
+			}
+		} else {
+			simRunner := runner.Runner{
+				Configuration: config,
+				Logger:        logger,
+			}
+			result, err = simRunner.RunContext(ctx)
+		}
 
-	if err != nil {
-		return nil, err
-	}
+		if err != nil {
+			logger.Error(
+				"Failed to run simulation",
+				zap.String("errorMessage", err.Error()),
+			)
 
-	var specs []runner.PerformanceRelationshipSpec
-	err = json.Unmarshal(data, &specs)
+			return
+		}
 
-	if err != nil {
-		return nil, err
-	}
+		logger.Info(
+			"Simulation finished",
+			zap.Int64("Seed", *config.Seed),
+			zap.Duration("Duration", result.Duration),
+			zap.Uint64("Failed updates", result.TotalFailedUpdates()),
+		)
+
+		if outputFormat == runner.OutputFormatSqlite {
+			run := &runner.SqliteRun{
+				StartTime:  config.StartTime,
+				EndTime:    config.EndTime,
+				Behaviours: config.Behaviours,
+				Beliefs:    config.Beliefs,
+				Summary:    result.Summary,
+			}
+
+			if fullOutput {
+				run.Agents = config.Agents
+			}
+
+			err = writeSqliteOutput(cmd, logger, outputFilepath, run)
+
+			if err != nil {
+				logger.Error(
+					"Failed to write output",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
+		}
 
-	uuidBeliefs := make(map[uuid.UUID]*b.Belief, len(beliefs))
-	for _, belief := range beliefs {
-		uuidBeliefs[belief.Uuid] = belief
-	}
+		if networkOutputFilepath != "" {
+			err = writeNetworkFile(
+				networkOutputFilepath,
+				networkOutputFormat,
+				networkDynamic,
+				config.Agents,
+				config.Beliefs,
+				result.Summary.LastTick,
+			)
+
+			if err != nil {
+				logger.Error(
+					"Failed to write network",
+					zap.String("errorMessage", err.Error()),
+				)
 
-	uuidBehaviours := make(map[uuid.UUID]*b.Behaviour, len(behaviours))
+				return
+			}
 
-	for _, behaviour := range behaviours {
-		uuidBehaviours[behaviour.Uuid] = behaviour
+			logger.Info("Wrote network", zap.String("File", networkOutputFilepath))
+		}
+	},
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	err := rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
 	}
+}
 
-	return runner.PRSSpecToPerformanceRelationships(specs, uuidBeliefs, uuidBehaviours), nil
+func init() {
+	addScenarioFlags(rootCmd)
+	rootCmd.Flags().StringP("output", "o", "", "The output file (e.g., output.json.zst)")
+	rootCmd.Flags().Bool("full", false, "Whether to serialize the full state of the simulation")
+	addOutputFormatFlag(rootCmd, runner.OutputFormatJson)
+	addRunLabelFlag(rootCmd)
+	rootCmd.Flags().String("actions-output", "", "With --full and --output-format parquet, the file for the actions table (default the output with the extension .actions.parquet)")
+	rootCmd.Flags().String("summary-output", "", "With --full and --output-format json, the file for the summary, which records whether the simulation was truncated (default the output with the extension .summary.json.zst)")
+	addRunFlags(rootCmd)
+	rootCmd.Flags().String("network-output", "", "Export the network of friends, with the state of each agent at the end of the run, to this GraphML or GEXF file (e.g., network.gexf)")
+	rootCmd.Flags().Bool("network-dynamic", false, "With --full, export the state of each agent at every tick to --network-output as a dynamic GEXF network")
+	rootCmd.Flags().String("burn-in-state", "", "Write the state of the agents at the end of the burn-in to this agents file (e.g., initial.json.zst)")
+	rootCmd.Flags().Duration("timeout", 0, "Stop the simulation after this duration, writing the output so far (e.g., 2h30m)")
+	addReplicateFlags(rootCmd)
+	rootCmd.Flags().Int("shards", 1, "The number of worker processes to partition the agents between, using the dense engine (summary output only)")
 }
@@ -0,0 +1,587 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/dense"
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// addScenarioFlags adds the flags which define the inputs of a simulation to a
+// command.
+//
+// The --manifest flag is applied by the PersistentPreRunE of the root command,
+// so the other flags may be read as usual.
+func addScenarioFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("manifest", "m", "", "A JSON or YAML scenario manifest, whose values are overridden by the other flags")
+	cmd.Flags().Uint32P("start", "s", 1, "The start time of the simulation")
+	cmd.Flags().Uint32P("end", "e", 1, "The end time of the simulation")
+	cmd.Flags().StringP("behaviours", "b", "", "The behaviours.json file")
+	cmd.Flags().StringP("beliefs", "c", "", "The beliefs.json file")
+	cmd.Flags().StringP("agents", "a", "", "The agents.json.zst file, or an Arrow IPC file or stream of agents")
+	cmd.Flags().StringP("prs", "p", "", "The prs.json file")
+	cmd.Flags().Bool("allow-unresolved", false, "Silently ignore references to unknown behaviours, beliefs and agents, rather than failing")
+	cmd.Flags().String("network", "", "A network of friends to attach to the agents, as an edge list CSV or TSV, GraphML or GEXF file")
+	cmd.Flags().String("network-format", "", fmt.Sprintf("The format of the network (%s) (default detected from the extension)", joinNames(runner.NetworkFormats)))
+	cmd.Flags().String("network-ids", "", "A CSV file mapping the node IDs of the network to agent UUIDs, with the columns id and uuid")
+	cmd.Flags().String("network-id-column", "id", "The column of the --network-ids file with the node IDs")
+	cmd.Flags().String("network-uuid-attribute", "", "The node attribute of a GraphML or GEXF network with the UUID of each agent (default the node ID is the UUID)")
+	cmd.Flags().String("network-weight", "weight", "The column or edge attribute of the network with the weight of each edge")
+	cmd.Flags().String("network-weights", string(runner.NetworkWeightsRaw), fmt.Sprintf("How the weights of the network are mapped (%s)", joinNames(runner.AllNetworkWeights)))
+	cmd.Flags().Bool("network-symmetrise", false, "Add the reverse of each directed edge of the network whose reverse is not in it")
+	cmd.Flags().Bool("network-replace", false, "Replace the friends in the agents file with the network, rather than adding to them")
+}
+
+// joinNames joins the names of options, such as formats, for a flag usage.
+func joinNames[T ~string](values []T) string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = string(value)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// addRunFlags adds the flags which define how a simulation is run to a command.
+func addRunFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint32("burn-in", 0, "The number of ticks from the start time which are simulated before the output begins")
+	cmd.Flags().Uint32("history", 0, "The number of ticks of history to retain for each agent (0 retains everything)")
+	cmd.Flags().Uint32("snapshot", 0, "When --history is set, also retain every tick which is a multiple of this for the full output")
+	cmd.Flags().Float64("tolerance", 0, "Stop once the largest change in mean activation and behaviour share is below this for --window ticks (0 disables)")
+	cmd.Flags().Uint32("window", 10, "The number of consecutive ticks within --tolerance after which the simulation has converged")
+	cmd.Flags().String("engine", "map", "The storage engine (map or dense)")
+	cmd.Flags().String("precision", "float64", "The precision with which the dense engine stores state (float64, float32 or int16)")
+	cmd.Flags().Int64("seed", 0, "The seed of the random number generator (default random)")
+}
+
+// readScenario reads the inputs of a simulation from the files given by the
+// flags added by addScenarioFlags.
+func readScenario(cmd *cobra.Command) (*runner.Configuration, error) {
+	config, agentsFilepath, err := readScenarioWithoutAgents(cmd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	strict, err := readStrict(cmd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	agents, err := readAgentsJson(agentsFilepath, config.Behaviours, config.Beliefs, strict)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agents file: %w", err)
+	}
+
+	network, err := readNetwork(cmd)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network: %w", err)
+	}
+
+	if network != nil {
+		replace, err := cmd.Flags().GetBool("network-replace")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get network-replace: %w", err)
+		}
+
+		err = runner.AttachNetwork(agents, network, replace, strict)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach network: %w", err)
+		}
+	}
+
+	config.Agents = agents
+
+	return config, nil
+}
+
+// readNetwork reads the network given by the --network flag and the options
+// of the other network flags, or nil if there is none.
+func readNetwork(cmd *cobra.Command) (runner.Network, error) {
+	networkFilepath, err := cmd.Flags().GetString("network")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network filepath: %w", err)
+	}
+
+	if networkFilepath == "" {
+		return nil, nil
+	}
+
+	var options runner.NetworkOptions
+
+	formatName, err := cmd.Flags().GetString("network-format")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network format: %w", err)
+	}
+
+	if formatName == "" {
+		options.Format, err = runner.NetworkFormatOf(networkFilepath)
+	} else {
+		options.Format, err = runner.ParseNetworkFormat(formatName)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	idsFilepath, err := cmd.Flags().GetString("network-ids")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network IDs filepath: %w", err)
+	}
+
+	if idsFilepath != "" {
+		idColumn, err := cmd.Flags().GetString("network-id-column")
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get network ID column: %w", err)
+		}
+
+		options.NodeIds, err = readNodeIds(idsFilepath, idColumn)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", idsFilepath, err)
+		}
+	}
+
+	options.UuidAttribute, err = cmd.Flags().GetString("network-uuid-attribute")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network UUID attribute: %w", err)
+	}
+
+	options.WeightAttribute, err = cmd.Flags().GetString("network-weight")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network weight: %w", err)
+	}
+
+	weightsName, err := cmd.Flags().GetString("network-weights")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network weights: %w", err)
+	}
+
+	options.Weights, err = runner.ParseNetworkWeights(weightsName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	options.Symmetrise, err = cmd.Flags().GetBool("network-symmetrise")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network-symmetrise: %w", err)
+	}
+
+	file, err := os.Open(networkFilepath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return runner.ReadNetwork(file, options)
+}
+
+// readNodeIds reads the file at path mapping the node IDs of a network to
+// agent UUIDs.
+func readNodeIds(path string, idColumn string) (map[string]uuid.UUID, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return runner.ReadNodeIds(file, idColumn)
+}
+
+// readScenarioWithoutAgents reads the inputs of a simulation other than the
+// agents from the files given by the flags added by addScenarioFlags, and gets
+// the path of the agents file.
+func readScenarioWithoutAgents(cmd *cobra.Command) (*runner.Configuration, string, error) {
+	config := new(runner.Configuration)
+
+	strict, err := readStrict(cmd)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	startTime, err := cmd.Flags().GetUint32("start")
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load start time: %w", err)
+	}
+
+	config.StartTime = b.SimTime(startTime)
+
+	endTime, err := cmd.Flags().GetUint32("end")
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load end time: %w", err)
+	}
+
+	config.EndTime = b.SimTime(endTime)
+
+	behavioursFilepath, err := cmd.Flags().GetString("behaviours")
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get behaviours filepath: %w", err)
+	}
+
+	if behavioursFilepath == "" {
+		return nil, "", errors.New("behavioursFilepath is unset")
+	}
+
+	behaviours, err := readBehavioursJson(behavioursFilepath)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read behaviours file: %w", err)
+	}
+
+	config.Behaviours = behaviours
+
+	beliefsFilepath, err := cmd.Flags().GetString("beliefs")
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get beliefs filepath: %w", err)
+	}
+
+	if beliefsFilepath == "" {
+		return nil, "", errors.New("beliefsFilepath unset")
+	}
+
+	beliefs, err := readBeliefsJson(beliefsFilepath, behaviours, strict)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read beliefs file: %w", err)
+	}
+
+	config.Beliefs = beliefs
+
+	prsFilepath, err := cmd.Flags().GetString("prs")
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get prs filepath: %w", err)
+	}
+
+	if prsFilepath == "" {
+		return nil, "", errors.New("prsFilepath unset")
+	}
+
+	prs, err := readPrsJson(prsFilepath, beliefs, behaviours, strict)
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read prs file: %w", err)
+	}
+
+	config.Prs = prs
+
+	agentsFilepath, err := cmd.Flags().GetString("agents")
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get agents filepath: %w", err)
+	}
+
+	if agentsFilepath == "" {
+		return nil, "", errors.New("agentsFilepath unset")
+	}
+
+	return config, agentsFilepath, nil
+}
+
+// readRunOptions sets the options of config from the flags added by
+// addRunFlags.
+func readRunOptions(cmd *cobra.Command, config *runner.Configuration) error {
+	burnIn, err := cmd.Flags().GetUint32("burn-in")
+
+	if err != nil {
+		return fmt.Errorf("failed to get burn-in: %w", err)
+	}
+
+	if uint64(config.StartTime)+uint64(burnIn) > uint64(config.EndTime) {
+		return fmt.Errorf("the burn-in of %d ticks must end before the end time", burnIn)
+	}
+
+	config.BurnIn = b.SimTime(burnIn)
+
+	historyLength, err := cmd.Flags().GetUint32("history")
+
+	if err != nil {
+		return fmt.Errorf("failed to get history length: %w", err)
+	}
+
+	config.HistoryLength = historyLength
+
+	snapshotInterval, err := cmd.Flags().GetUint32("snapshot")
+
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot interval: %w", err)
+	}
+
+	config.SnapshotInterval = snapshotInterval
+
+	tolerance, err := cmd.Flags().GetFloat64("tolerance")
+
+	if err != nil {
+		return fmt.Errorf("failed to get convergence tolerance: %w", err)
+	}
+
+	window, err := cmd.Flags().GetUint32("window")
+
+	if err != nil {
+		return fmt.Errorf("failed to get convergence window: %w", err)
+	}
+
+	if tolerance > 0 && window < 1 {
+		return errors.New("--window must be at least 1 with --tolerance")
+	}
+
+	if tolerance > 0 {
+		config.Convergence = &runner.ConvergenceCriterion{
+			Tolerance: tolerance,
+			Window:    window,
+		}
+	}
+
+	engineName, err := cmd.Flags().GetString("engine")
+
+	if err != nil {
+		return fmt.Errorf("failed to get engine: %w", err)
+	}
+
+	config.Engine, err = runner.ParseEngine(engineName)
+
+	if err != nil {
+		return err
+	}
+
+	precisionName, err := cmd.Flags().GetString("precision")
+
+	if err != nil {
+		return fmt.Errorf("failed to get precision: %w", err)
+	}
+
+	config.Precision, err = dense.ParsePrecision(precisionName)
+
+	if err != nil {
+		return err
+	}
+
+	seed, err := readSeed(cmd)
+
+	if err != nil {
+		return err
+	}
+
+	config.Seed = &seed
+
+	return nil
+}
+
+// readStrict gets whether references to unknown behaviours, beliefs and
+// agents are an error, which they are unless --allow-unresolved is set.
+func readStrict(cmd *cobra.Command) (bool, error) {
+	allowUnresolved, err := cmd.Flags().GetBool("allow-unresolved")
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get allow-unresolved: %w", err)
+	}
+
+	return !allowUnresolved, nil
+}
+
+// readSeed gets the seed from the flags, or a random seed if it is unset.
+func readSeed(cmd *cobra.Command) (int64, error) {
+	if !cmd.Flags().Changed("seed") {
+		return time.Now().UnixNano(), nil
+	}
+
+	seed, err := cmd.Flags().GetInt64("seed")
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get seed: %w", err)
+	}
+
+	return seed, nil
+}
+
+func readBehavioursJson(path string) ([]*b.Behaviour, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// var behaviourSpecs
+	var behaviourSpecs []runner.BehaviourSpec
+	err = json.Unmarshal(data, &behaviourSpecs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	behaviours := make([]*b.Behaviour, len(behaviourSpecs))
+
+	for i, spec := range behaviourSpecs {
+		behaviours[i] = spec.ToBehaviour()
+	}
+
+	return behaviours, nil
+}
+
+// readBeliefsJson reads the beliefs file at path.
+//
+// If strict, references to unknown behaviours and beliefs are an
+// *runner.UnresolvedReferencesError listing all of them.
+func readBeliefsJson(path string, behaviours []*b.Behaviour, strict bool) ([]*b.Belief, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var beliefSpecs []runner.BeliefSpec
+	err = json.Unmarshal(data, &beliefSpecs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	beliefs := make([]*b.Belief, len(beliefSpecs))
+
+	if !strict {
+		for i, spec := range beliefSpecs {
+			beliefs[i] = spec.ToBelief(behaviours)
+		}
+
+		for _, spec := range beliefSpecs {
+			spec.LinkBeliefRelationships(beliefs)
+		}
+
+		return beliefs, nil
+	}
+
+	unresolved := new(runner.UnresolvedReferencesError)
+
+	for i, spec := range beliefSpecs {
+		beliefs[i], err = spec.ToBeliefStrict(behaviours)
+
+		if err := unresolved.Merge(err); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, spec := range beliefSpecs {
+		if err := unresolved.Merge(spec.LinkBeliefRelationshipsStrict(beliefs)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(unresolved.References) != 0 {
+		return nil, unresolved
+	}
+
+	return beliefs, nil
+}
+
+// readAgentsJson reads the agents file at path, which is either
+// zstd-compressed JSON or Arrow IPC.
+//
+// The file is decompressed and decoded as it is read, so only the agents, and
+// not the file, are held in memory.
+//
+// If strict, references to unknown behaviours, beliefs and agents are an
+// *runner.UnresolvedReferencesError listing all of them.
+func readAgentsJson(
+	path string,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	strict bool,
+) ([]*b.Agent, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return runner.ReadAgents(file, behaviours, beliefs, strict)
+}
+
+// readAgentSpecs gets a function which streams the AgentSpecs from the agents
+// file at path, reading the file again each time it is called.
+func readAgentSpecs(path string) func(f func(*runner.AgentSpec) error) error {
+	return func(f func(*runner.AgentSpec) error) error {
+		file, err := os.Open(path)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		return runner.ReadAgentSpecs(file, f)
+	}
+}
+
+// readPrsJson reads the performance relationships file at path.
+//
+// If strict, references to unknown beliefs and behaviours are an
+// *runner.UnresolvedReferencesError listing all of them.
+func readPrsJson(
+	path string,
+	beliefs []*b.Belief,
+	behaviours []*b.Behaviour,
+	strict bool,
+) (runner.PerformanceRelationships, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []runner.PerformanceRelationshipSpec
+	err = json.Unmarshal(data, &specs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	uuidBeliefs := make(map[uuid.UUID]*b.Belief, len(beliefs))
+	for _, belief := range beliefs {
+		uuidBeliefs[belief.Uuid] = belief
+	}
+
+	uuidBehaviours := make(map[uuid.UUID]*b.Behaviour, len(behaviours))
+
+	for _, behaviour := range behaviours {
+		uuidBehaviours[behaviour.Uuid] = behaviour
+	}
+
+	if strict {
+		return runner.PRSSpecToPerformanceRelationshipsStrict(specs, uuidBeliefs, uuidBehaviours)
+	}
+
+	return runner.PRSSpecToPerformanceRelationships(specs, uuidBeliefs, uuidBehaviours), nil
+}
@@ -0,0 +1,436 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/0xr0bert/gobelief/sensitivity"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// sensitivityCmd runs a global sensitivity analysis of a scenario
+var sensitivityCmd = &cobra.Command{
+	Use:   "sensitivity",
+	Short: "Analyse the sensitivity of the outputs of a scenario to its parameters",
+	Long: `Analyse the sensitivity of the outputs of a scenario to its parameters,
+by running the scenario at the points of a sample design and printing the
+sensitivity indices of each parameter for each metric.
+
+Each --parameter flag gives a parameter and its range, as name=min,max. The
+parameters are those of the sweep command, except startTime and endTime.
+
+Each --metric flag gives an output of the scenario at its last tick, as
+<statistic>:<belief>, where the statistic is meanActivation, sdActivation,
+medianActivation or nonzeroActivationCount, or as <statistic>:<behaviour>,
+where the statistic is nPerformers or behaviourShare.
+
+The methods are:
+
+  morris  elementary effects, with --samples trajectories through a grid of
+          --levels levels, running samples * (parameters + 1) times; reports
+          mu, muStar (overall importance) and sigma (nonlinearity and
+          interactions)
+  sobol   variance-based indices with the Saltelli design, running
+          samples * (parameters + 2) times; reports the first-order index S1
+          and the total index ST
+
+Every run uses the same seed, which also generates the design.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := zap.NewProduction()
+		if err != nil {
+			return
+		}
+
+		parameters, err := cmd.Flags().GetStringArray("parameter")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get parameters",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		ranges, err := parseRanges(parameters)
+
+		if err != nil {
+			logger.Error(
+				"Failed to parse parameters",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		method, err := cmd.Flags().GetString("method")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get method",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		samples, err := cmd.Flags().GetInt("samples")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get samples",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		levels, err := cmd.Flags().GetInt("levels")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get levels",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get concurrency",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		outputFilepath, err := cmd.Flags().GetString("output")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get output filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		seed, err := readSeed(cmd)
+
+		if err != nil {
+			logger.Error(
+				"Failed to get seed",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		base, err := newBaseConfiguration(cmd, seed)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read scenario",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		metricNames, err := cmd.Flags().GetStringArray("metric")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get metrics",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if len(metricNames) == 0 {
+			logger.Error("There are no metrics")
+
+			return
+		}
+
+		metrics := make([]*runner.Metric, len(metricNames))
+
+		for i, name := range metricNames {
+			metrics[i], err = runner.ParseMetric(name, base.Beliefs, base.Behaviours)
+
+			if err != nil {
+				logger.Error(
+					"Failed to parse metric",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
+		}
+
+		rng := rand.New(rand.NewSource(seed))
+
+		var design sensitivityDesign
+
+		switch method {
+		case "morris":
+			design, err = sensitivity.NewMorrisDesign(ranges, samples, levels, rng)
+		case "sobol":
+			design, err = sensitivity.NewSaltelliDesign(ranges, samples, rng)
+		default:
+			err = fmt.Errorf("unknown method %q", method)
+		}
+
+		if err != nil {
+			logger.Error(
+				"Failed to create design",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		points := rangePoints(ranges, design.Points())
+
+		err = runner.CheckParameters(points, base)
+
+		if err != nil {
+			logger.Error(
+				"Invalid parameters",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(
+			context.Background(),
+			os.Interrupt,
+			syscall.SIGTERM,
+		)
+		defer stop()
+
+		sweep := runner.Sweep{
+			NewConfiguration: func() (*runner.Configuration, error) {
+				return newBaseConfiguration(cmd, seed)
+			},
+			Points:      points,
+			Concurrency: concurrency,
+			Logger:      logger,
+		}
+
+		logger.Info(
+			"Running sensitivity analysis",
+			zap.String("method", method),
+			zap.Int("n points", len(points)),
+		)
+
+		results, err := sweep.RunContext(ctx)
+
+		if err != nil {
+			logger.Error(
+				"Failed to run sensitivity analysis",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		header, rows, err := sensitivityRows(design, metrics, results, len(base.Agents))
+
+		if err != nil {
+			logger.Error(
+				"Failed to analyse outputs",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		err = writeSensitivityTable(os.Stdout, header, rows)
+
+		if err != nil {
+			logger.Error(
+				"Failed to write indices",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if outputFilepath != "" {
+			outputFile, err := os.Create(outputFilepath)
+
+			if err != nil {
+				logger.Error(
+					"Failed to create output file",
+					zap.String("errorMessage", err.Error()),
+				)
+
+				return
+			}
+
+			defer outputFile.Close()
+
+			w := csv.NewWriter(outputFile)
+			w.Write(header)
+			w.WriteAll(rows)
+
+			if w.Error() != nil {
+				logger.Error(
+					"Failed to write output",
+					zap.String("errorMessage", w.Error().Error()),
+				)
+
+				return
+			}
+		}
+
+		logger.Info("Sensitivity analysis finished", zap.Int64("Seed", seed))
+	},
+}
+
+// sensitivityDesign is a sample design of the sensitivity package.
+type sensitivityDesign interface {
+	Points() [][]float64
+}
+
+// parseRanges parses --parameter flags of the form name=min,max.
+func parseRanges(parameters []string) ([]sensitivity.Range, error) {
+	names, values, err := parseGrid(parameters)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("there are no parameters")
+	}
+
+	ranges := make([]sensitivity.Range, len(names))
+
+	for i, name := range names {
+		if len(values[i]) != 2 || values[i][0] >= values[i][1] {
+			return nil, fmt.Errorf("parameter %q should be name=min,max with min < max", parameters[i])
+		}
+
+		if name == "startTime" || name == "endTime" {
+			return nil, fmt.Errorf("parameter %q is not continuous", name)
+		}
+
+		ranges[i] = sensitivity.Range{Name: name, Min: values[i][0], Max: values[i][1]}
+	}
+
+	return ranges, nil
+}
+
+// sensitivityRows calculates the indices of every parameter for every metric
+// from the results of the points of the design, returning a header and a row
+// for each metric and parameter.
+//
+// It is an error for any run to have been truncated, such as by Ctrl-C.
+func sensitivityRows(
+	design sensitivityDesign,
+	metrics []*runner.Metric,
+	results []*runner.Result,
+	nAgents int,
+) ([]string, [][]string, error) {
+	var header []string
+	var rows [][]string
+
+	format := func(x float64) string {
+		return strconv.FormatFloat(x, 'g', 6, 64)
+	}
+
+	// The indices of truncated runs would be meaningless, as they would mix
+	// outputs at different ticks.
+	for i, result := range results {
+		if result.Summary.Truncated {
+			return nil, nil, fmt.Errorf(
+				"run %d was cancelled after tick %d",
+				i,
+				result.Summary.LastTick,
+			)
+		}
+	}
+
+	for _, metric := range metrics {
+		outputs := make([]float64, len(results))
+		for i, result := range results {
+			var err error
+			outputs[i], err = metric.Value(result.Summary, nAgents)
+			if err != nil {
+				return nil, nil, fmt.Errorf("metric %q of run %d: %w", metric.Name, i, err)
+			}
+		}
+
+		switch d := design.(type) {
+		case *sensitivity.MorrisDesign:
+			header = []string{"metric", "parameter", "mu", "muStar", "sigma"}
+			indices, err := d.Analyse(outputs)
+			if err != nil {
+				return nil, nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+			}
+			for _, index := range indices {
+				rows = append(rows, []string{
+					metric.Name, index.Name, format(index.Mu), format(index.MuStar), format(index.Sigma),
+				})
+			}
+		case *sensitivity.SaltelliDesign:
+			header = []string{"metric", "parameter", "S1", "ST"}
+			indices, err := d.Analyse(outputs)
+			if err != nil {
+				return nil, nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+			}
+			for _, index := range indices {
+				rows = append(rows, []string{
+					metric.Name, index.Name, format(index.S1), format(index.ST),
+				})
+			}
+		}
+	}
+
+	return header, rows, nil
+}
+
+// writeSensitivityTable writes the indices as an aligned table.
+func writeSensitivityTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(sensitivityCmd)
+	addScenarioFlags(sensitivityCmd)
+	addRunFlags(sensitivityCmd)
+	sensitivityCmd.Flags().StringArray("parameter", nil, "A parameter and its range, as name=min,max (may be repeated)")
+	sensitivityCmd.Flags().StringArray("metric", nil, "An output of the scenario, as statistic:belief or statistic:behaviour (may be repeated)")
+	sensitivityCmd.Flags().String("method", "morris", "The method (morris or sobol)")
+	sensitivityCmd.Flags().Int("samples", 10, "The number of trajectories (morris) or base samples (sobol)")
+	sensitivityCmd.Flags().Int("levels", 4, "The number of levels of the grid of the morris method")
+	sensitivityCmd.Flags().Int("concurrency", runtime.NumCPU(), "The maximum number of runs at once")
+	sensitivityCmd.Flags().StringP("output", "o", "", "An optional CSV file of the indices (e.g., indices.csv)")
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// shardWorkerCmd runs a worker of a sharded simulation
+var shardWorkerCmd = &cobra.Command{
+	Use:    "shard-worker",
+	Short:  "Run a worker of a sharded simulation",
+	Long:   `Run a worker of a sharded simulation. This is started by gobelief --shards.`,
+	Hidden: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Interrupting the coordinator also interrupts its workers, so they
+		// ignore it, and exit when the coordinator disconnects once it has
+		// written the output of the ticks completed.
+		signal.Ignore(os.Interrupt, syscall.SIGTERM)
+
+		address, err := cmd.Flags().GetString("address")
+
+		if err != nil {
+			return err
+		}
+
+		return runner.ServeShard(address)
+	},
+}
+
+// runSharded runs the simulation in config with nShards worker processes,
+// reading the agents from the agents file at agentsFilepath.
+func runSharded(
+	ctx context.Context,
+	logger *zap.Logger,
+	config *runner.Configuration,
+	agentsFilepath string,
+	nShards int,
+	strict bool,
+) (*runner.Result, error) {
+	executable, err := os.Executable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	simRunner := runner.ShardedRunner{
+		Configuration: &runner.ShardedConfiguration{
+			Behaviours:   config.Behaviours,
+			Beliefs:      config.Beliefs,
+			Prs:          config.Prs,
+			Agents:       readAgentSpecs(agentsFilepath),
+			Strict:       strict,
+			StartTime:    config.StartTime,
+			EndTime:      config.EndTime,
+			BurnIn:       config.BurnIn,
+			OutputFile:   config.OutputFile,
+			OutputFormat: config.OutputFormat,
+			Convergence:  config.Convergence,
+			Precision:    config.Precision,
+			Seed:         config.Seed,
+			NShards:      nShards,
+			WorkerCommand: func(address string) *exec.Cmd {
+				cmd := exec.Command(executable, "shard-worker", "--address", address)
+				cmd.Stderr = os.Stderr
+				return cmd
+			},
+		},
+		Logger: logger,
+	}
+
+	return simRunner.RunContext(ctx)
+}
+
+func init() {
+	rootCmd.AddCommand(shardWorkerCmd)
+	shardWorkerCmd.Flags().String("address", "", "The Unix socket address of the coordinator")
+}
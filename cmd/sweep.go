@@ -0,0 +1,314 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// sweepCmd runs a scenario at every point of a parameter sweep
+var sweepCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Run a scenario with every combination of parameter overrides",
+	Long: `Run a scenario with every combination of parameter overrides, and write
+the summary statistics of every run to a single CSV table.
+
+Each --grid flag gives a parameter and its values, as name=v1,v2,... Every
+combination of the values of every --grid flag is run, with the last flag
+varying fastest. --points gives a JSON file with a list of points, each of
+which maps parameter names to values; every point is combined with every
+combination of the --grid flags.
+
+The parameters are:
+
+  deltaScale                      multiply every delta
+  deltaScale:<belief>             multiply the deltas of one belief
+  friendWeightScale               multiply every friend weight
+  prs:<belief>:<behaviour>        set a performance relationship
+  perception:<belief>:<behaviour> set the perception of a belief to a behaviour
+  startTime, endTime              set the start or end time
+
+Beliefs and behaviours are referred to by name or UUID, but each parameter
+must be referred to the same way in every point. Every run uses the same seed,
+so differences between runs are due to the parameters rather than the random
+numbers.
+
+The table has a row for each run and tick, indexed by the run and tick columns.
+A run which fails has a single row with the stop reason "failed", and the other
+runs are still written.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logger, err := zap.NewProduction()
+		if err != nil {
+			return
+		}
+
+		outputFilepath, err := cmd.Flags().GetString("output")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get output filepath",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if outputFilepath == "" {
+			logger.Error(
+				"outputFilepath is unset",
+			)
+
+			return
+		}
+
+		points, err := readSweepPoints(cmd)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read sweep points",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+
+		if err != nil {
+			logger.Error(
+				"Failed to get concurrency",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		seed, err := readSeed(cmd)
+
+		if err != nil {
+			logger.Error(
+				"Failed to get seed",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		base, err := newBaseConfiguration(cmd, seed)
+
+		if err != nil {
+			logger.Error(
+				"Failed to read scenario",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		err = runner.CheckParameters(points, base)
+
+		if err != nil {
+			logger.Error(
+				"Invalid points",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(
+			context.Background(),
+			os.Interrupt,
+			syscall.SIGTERM,
+		)
+		defer stop()
+
+		sweep := runner.Sweep{
+			NewConfiguration: func() (*runner.Configuration, error) {
+				return newBaseConfiguration(cmd, seed)
+			},
+			Points:      points,
+			Concurrency: concurrency,
+			Logger:      logger,
+		}
+
+		logger.Info("Running sweep", zap.Int("n points", len(points)))
+
+		results, runErr := sweep.RunContext(ctx)
+
+		// The points which failed are recorded in the table, so the runs
+		// which completed are still written.
+		if runErr != nil {
+			logger.Error(
+				"Failed to run sweep",
+				zap.String("errorMessage", runErr.Error()),
+			)
+		}
+
+		summaries := make([]*runner.OutputSpecs, len(results))
+
+		for i, result := range results {
+			if result != nil {
+				summaries[i] = result.Summary
+			}
+		}
+
+		outputFile, err := os.Create(outputFilepath)
+
+		if err != nil {
+			logger.Error(
+				"Failed to create output file",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		defer outputFile.Close()
+
+		err = runner.WriteSweepTable(outputFile, points, summaries, base.Beliefs, base.Behaviours)
+
+		if err != nil {
+			logger.Error(
+				"Failed to write output",
+				zap.String("errorMessage", err.Error()),
+			)
+
+			return
+		}
+
+		if runErr != nil {
+			return
+		}
+
+		logger.Info("Sweep finished", zap.Int64("Seed", seed))
+	},
+}
+
+// newBaseConfiguration reads the scenario and run options of a command, with
+// the specified seed.
+func newBaseConfiguration(cmd *cobra.Command, seed int64) (*runner.Configuration, error) {
+	config, err := readScenario(cmd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = readRunOptions(cmd, config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.Seed = &seed
+
+	return config, nil
+}
+
+// readSweepPoints gets the points of a sweep from the --points and --grid
+// flags.
+func readSweepPoints(cmd *cobra.Command) ([]runner.Parameters, error) {
+	points := []runner.Parameters{{}}
+
+	pointsFilepath, err := cmd.Flags().GetString("points")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get points filepath: %w", err)
+	}
+
+	if pointsFilepath != "" {
+		data, err := os.ReadFile(pointsFilepath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		points = nil
+		err = json.Unmarshal(data, &points)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse points file: %w", err)
+		}
+	}
+
+	grid, err := cmd.Flags().GetStringArray("grid")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grid: %w", err)
+	}
+
+	names, values, err := parseGrid(grid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var combined []runner.Parameters
+
+	for _, point := range points {
+		for _, gridPoint := range runner.Grid(names, values) {
+			p := make(runner.Parameters, len(point)+len(gridPoint))
+			for name, v := range point {
+				p[name] = v
+			}
+			for name, v := range gridPoint {
+				p[name] = v
+			}
+			combined = append(combined, p)
+		}
+	}
+
+	if len(combined) == 0 {
+		return nil, fmt.Errorf("there are no points")
+	}
+
+	return combined, nil
+}
+
+// parseGrid parses --grid flags of the form name=v1,v2,...
+func parseGrid(grid []string) ([]string, [][]float64, error) {
+	names := make([]string, len(grid))
+	values := make([][]float64, len(grid))
+
+	for i, g := range grid {
+		separator := strings.LastIndex(g, "=")
+
+		if separator == -1 {
+			return nil, nil, fmt.Errorf("grid %q should be name=v1,v2,...", g)
+		}
+
+		names[i] = g[:separator]
+
+		for _, v := range strings.Split(g[separator+1:], ",") {
+			value, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid value in grid %q: %w", g, err)
+			}
+
+			values[i] = append(values[i], value)
+		}
+	}
+
+	return names, values, nil
+}
+
+func init() {
+	rootCmd.AddCommand(sweepCmd)
+	addScenarioFlags(sweepCmd)
+	addRunFlags(sweepCmd)
+	sweepCmd.Flags().StringP("output", "o", "", "The output CSV file (e.g., sweep.csv)")
+	sweepCmd.Flags().StringArray("grid", nil, "A parameter and its values, as name=v1,v2,... (may be repeated)")
+	sweepCmd.Flags().String("points", "", "A JSON file with a list of points, each mapping parameter names to values")
+	sweepCmd.Flags().Int("concurrency", runtime.NumCPU(), "The maximum number of runs at once")
+}
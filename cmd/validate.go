@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd checks the input files of a scenario
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the input files of a scenario",
+	Long: `Check the input files of a scenario, printing every problem with the file
+and JSON path where it was found, such as
+
+  agents.json.zst: [3].friends.<uuid>: error: friend weight 1.5 is outside [0, 1]
+
+The errors are:
+
+  - activations, perceptions and performance relationships outside [-1, 1],
+    friend weights outside [0, 1], and deltas which are not finite;
+  - duplicate UUIDs, and duplicate performance relationships;
+  - references to unknown behaviours, beliefs and agents, which are ignored
+    when the scenario is read; and
+  - agents without an activation or delta for every belief at the tick before
+    the start time, which fail to update.
+
+With --network, the weights and agents of the network are also checked.
+
+Beliefs with no performance relationships, and deltas outside [-1, 1], which
+amplify activations until they are clamped, are warnings. This exits with
+status 1 if there are any errors.`,
+	// Flag and file errors are returned, so Execute exits with status 1, and
+	// the usage is not printed for them.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		startTime, err := cmd.Flags().GetUint32("start")
+
+		if err != nil {
+			return fmt.Errorf("failed to get start time: %w", err)
+		}
+
+		paths := make(map[string]string)
+
+		for _, name := range []string{"behaviours", "beliefs", "prs", "agents"} {
+			paths[name], err = cmd.Flags().GetString(name)
+
+			if err != nil {
+				return fmt.Errorf("failed to get %s filepath: %w", name, err)
+			}
+
+			if paths[name] == "" {
+				return fmt.Errorf("--%s is required", name)
+			}
+		}
+
+		networkFilepath, err := cmd.Flags().GetString("network")
+
+		if err != nil {
+			return fmt.Errorf("failed to get network filepath: %w", err)
+		}
+
+		nErrors := 0
+		nWarnings := 0
+
+		validator := runner.Validator{
+			BehavioursFile: paths["behaviours"],
+			BeliefsFile:    paths["beliefs"],
+			PrsFile:        paths["prs"],
+			AgentsFile:     paths["agents"],
+			NetworkFile:    networkFilepath,
+			StartTime:      b.SimTime(startTime),
+			Report: func(p runner.Problem) {
+				if p.Severity == runner.SeverityError {
+					nErrors++
+				} else {
+					nWarnings++
+				}
+				fmt.Println(p)
+			},
+		}
+
+		err = validateScenario(cmd, &validator)
+
+		if err != nil {
+			nErrors++
+			fmt.Println(err)
+		}
+
+		fmt.Printf("%d errors, %d warnings\n", nErrors, nWarnings)
+
+		if nErrors != 0 {
+			return fmt.Errorf("the scenario has %d errors", nErrors)
+		}
+
+		return nil
+	},
+}
+
+// validateScenario reads the input files of a scenario and checks them with
+// validator.
+//
+// A file which cannot be read or parsed is returned as an error, with the line
+// and column of any syntax error. The network, if any, is read with the
+// options of the network flags.
+func validateScenario(cmd *cobra.Command, validator *runner.Validator) error {
+	var behaviourSpecs []runner.BehaviourSpec
+
+	err := readJsonFile(validator.BehavioursFile, &behaviourSpecs)
+
+	if err != nil {
+		return err
+	}
+
+	validator.CheckBehaviours(behaviourSpecs)
+
+	var beliefSpecs []runner.BeliefSpec
+
+	err = readJsonFile(validator.BeliefsFile, &beliefSpecs)
+
+	if err != nil {
+		return err
+	}
+
+	validator.CheckBeliefs(beliefSpecs)
+
+	var prsSpecs []runner.PerformanceRelationshipSpec
+
+	err = readJsonFile(validator.PrsFile, &prsSpecs)
+
+	if err != nil {
+		return err
+	}
+
+	validator.CheckPrs(prsSpecs)
+
+	i := 0
+
+	err = readAgentSpecs(validator.AgentsFile)(func(spec *runner.AgentSpec) error {
+		validator.CheckAgent(i, spec)
+		i++
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("%s: [%d]: error: %w", validator.AgentsFile, i, err)
+	}
+
+	if validator.NetworkFile != "" {
+		network, err := readNetwork(cmd)
+
+		if err != nil {
+			return fmt.Errorf("%s: error: %w", validator.NetworkFile, err)
+		}
+
+		validator.CheckNetwork(network)
+	}
+
+	validator.Finish()
+
+	return nil
+}
+
+// readJsonFile unmarshals the JSON file at path into v.
+//
+// Syntax and type errors are located by line and column.
+func readJsonFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return fmt.Errorf("%s: error: %w", path, err)
+	}
+
+	err = json.Unmarshal(data, v)
+
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		line, column := lineAndColumn(data, syntaxError.Offset)
+		return fmt.Errorf("%s:%d:%d: error: %w", path, line, column, err)
+	case errors.As(err, &typeError):
+		line, column := lineAndColumn(data, typeError.Offset)
+		return fmt.Errorf("%s:%d:%d: error: %w", path, line, column, err)
+	case err != nil:
+		return fmt.Errorf("%s: error: %w", path, err)
+	}
+
+	return nil
+}
+
+// lineAndColumn gets the line and column, both from 1, of a byte offset in
+// data.
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return line, column
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	addScenarioFlags(validateCmd)
+}
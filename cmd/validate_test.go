@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/runner"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeTestScenario writes a scenario with one behaviour, one belief and one
+// agent to dir, with the agent's friend weight set to weight, and returns the
+// flags to validate it.
+func writeTestScenario(t *testing.T, dir string, weight float64) []string {
+	behaviour := uuid.New()
+	belief := uuid.New()
+	agent := uuid.New()
+
+	files := map[string]any{
+		"behaviours": []runner.BehaviourSpec{{Name: "beh0", Uuid: behaviour}},
+		"beliefs": []runner.BeliefSpec{{
+			Name:          "bel0",
+			Uuid:          belief,
+			Perceptions:   map[uuid.UUID]float64{behaviour: 0.5},
+			Relationships: map[uuid.UUID]float64{belief: 1},
+		}},
+		"prs": []runner.PerformanceRelationshipSpec{
+			{BehaviourUuid: behaviour, BeliefUuid: belief, Value: 0.5},
+		},
+	}
+
+	var flags []string
+
+	for name, v := range files {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dir, name+".json")
+		err = os.WriteFile(path, data, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		flags = append(flags, "--"+name, path)
+	}
+
+	agents := []runner.AgentSpec{{
+		Uuid:        agent,
+		Activations: map[b.SimTime]map[uuid.UUID]float64{0: {belief: 0.5}},
+		Deltas:      map[uuid.UUID]float64{belief: 1},
+		Friends:     map[uuid.UUID]float64{agent: weight},
+	}}
+
+	path := filepath.Join(dir, "agents.json.zst")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	encoder, err := zstd.NewWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.NewEncoder(encoder).Encode(agents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = encoder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(flags, "--agents", path)
+}
+
+func TestValidateExitCode(t *testing.T) {
+	valid := writeTestScenario(t, t.TempDir(), 0.5)
+	invalid := writeTestScenario(t, t.TempDir(), 1.5)
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"valid", valid, 0},
+		{"invalid", invalid, 1},
+		{"missing flag", valid[:len(valid)-2], 1},
+		{"missing file", append(valid[:len(valid)-1:len(valid)-1], "missing.json.zst"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=TestValidateProcess")
+			cmd.Env = append(os.Environ(), "GOBELIEF_VALIDATE_ARGS="+strings.Join(tt.args, "\n"))
+			err := cmd.Run()
+
+			code := 0
+			var exitError *exec.ExitError
+			if errors.As(err, &exitError) {
+				code = exitError.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if code != tt.code {
+				t.Errorf("Expected exit status %d, got %d", tt.code, code)
+			}
+		})
+	}
+}
+
+// TestValidateProcess is run as the validate command by
+// TestValidateExitCode.
+func TestValidateProcess(t *testing.T) {
+	args := os.Getenv("GOBELIEF_VALIDATE_ARGS")
+	if args == "" {
+		t.Skip("Not a validate process")
+	}
+
+	rootCmd.SetArgs(append([]string{"validate"}, strings.Split(args, "\n")...))
+	Execute()
+}
@@ -0,0 +1,205 @@
+package dense
+
+import (
+	"bytes"
+	"runtime"
+	"sort"
+	"sync"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// Graph is a weighted, directed social graph in compressed sparse row (CSR)
+// form.
+//
+// The friends of node i are Columns[Offsets[i]:Offsets[i+1]], with the weights
+// at the same indices of Weights.
+type Graph struct {
+	// The offset of the edges of each node, with a final entry equal to the
+	// number of edges.
+	Offsets []int
+	// The friend at the end of each edge.
+	Columns []int32
+	// The weight of each edge.
+	Weights Vector
+}
+
+// NewGraph creates a Graph from the friends of the agents, storing the weights
+// at the specified precision.
+//
+// The node of each agent is its index in agents. Friends which are not in
+// agents are omitted. The friends of each node are ordered by UUID, so the
+// order in which weights are summed does not depend on the order of agents.
+func NewGraph(agents []*b.Agent, p Precision) *Graph {
+	return newGraph(agents, nil, p)
+}
+
+// newGraph creates a Graph with a row for each of the agents, in which the
+// node of ghosts[k] is len(agents)+k.
+//
+// Ghosts have no row, so their friends are omitted.
+func newGraph(agents []*b.Agent, ghosts []*b.Agent, p Precision) *Graph {
+	indices := make(map[*b.Agent]int32, len(agents)+len(ghosts))
+	nEdges := 0
+	for i, agent := range agents {
+		indices[agent] = int32(i)
+		nEdges += len(agent.Friends)
+	}
+	for k, ghost := range ghosts {
+		indices[ghost] = int32(len(agents) + k)
+	}
+
+	g := &Graph{
+		Offsets: make([]int, len(agents)+1),
+		Columns: make([]int32, 0, nEdges),
+	}
+
+	type edge struct {
+		friend *b.Agent
+		weight float64
+	}
+
+	weights := make([]float64, 0, nEdges)
+	var row []edge
+	for i, agent := range agents {
+		row = row[:0]
+		for friend, w := range agent.Friends {
+			if _, found := indices[friend]; found {
+				row = append(row, edge{friend: friend, weight: w})
+			}
+		}
+		sort.Slice(row, func(x, y int) bool {
+			return bytes.Compare(row[x].friend.Uuid[:], row[y].friend.Uuid[:]) < 0
+		})
+		for _, e := range row {
+			g.Columns = append(g.Columns, indices[e.friend])
+			weights = append(weights, e.weight)
+		}
+		g.Offsets[i+1] = len(g.Columns)
+	}
+
+	g.Weights = newVector(p, len(weights))
+	for e, w := range weights {
+		g.Weights.Set(e, w)
+	}
+
+	return g
+}
+
+// CountEdges gets the number of edges of the Graph NewGraph creates from the
+// friends of the agents, without creating it.
+func CountEdges(agents []*b.Agent) int {
+	nodes := make(map[*b.Agent]bool, len(agents))
+	for _, agent := range agents {
+		nodes[agent] = true
+	}
+	n := 0
+	for _, agent := range agents {
+		for friend := range agent.Friends {
+			if nodes[friend] {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// NNodes gets the number of nodes in the Graph which have a row.
+func (g *Graph) NNodes() int {
+	return len(g.Offsets) - 1
+}
+
+// NEdges gets the number of edges in the Graph.
+func (g *Graph) NEdges() int {
+	return len(g.Columns)
+}
+
+// Tally calculates the total weight of the friends of every node who performed
+// each behaviour.
+//
+// actions is the index of the behaviour each node performed, or -1 if it did
+// not perform one. The tally of node i for behaviour k is written to index
+// i*nBehaviours+k of tally, which should have the same precision as the
+// weights.
+//
+// This is a single sparse matrix-vector product of the Graph with the one-hot
+// encoding of actions, and is equivalent to beliefspread.Agent.GetActionsOfFriends
+// for every agent.
+func (g *Graph) Tally(actions []int32, nBehaviours int, tally Vector) {
+	parallelRange(g.NNodes(), func(start, end int) {
+		// Use a specialised loop when the precisions match, as this is the
+		// hot path.
+		switch weights := g.Weights.(type) {
+		case Float64Vector:
+			if t, ok := tally.(Float64Vector); ok {
+				tallyBetween(g, weights, t, actions, nBehaviours, start, end)
+				return
+			}
+		case Float32Vector:
+			if t, ok := tally.(Float32Vector); ok {
+				tallyBetween(g, weights, t, actions, nBehaviours, start, end)
+				return
+			}
+		}
+
+		for i := start; i < end; i++ {
+			row := make([]float64, nBehaviours)
+			for e := g.Offsets[i]; e < g.Offsets[i+1]; e++ {
+				action := actions[g.Columns[e]]
+				if action >= 0 {
+					row[action] += g.Weights.At(e)
+				}
+			}
+			tally.Store(i*nBehaviours, row)
+		}
+	})
+}
+
+// tallyBetween calculates the tally of the nodes in [start, end).
+func tallyBetween[T real](
+	g *Graph,
+	weights []T,
+	tally []T,
+	actions []int32,
+	nBehaviours int,
+	start int,
+	end int,
+) {
+	for i := start; i < end; i++ {
+		row := tally[i*nBehaviours : (i+1)*nBehaviours]
+		for k := range row {
+			row[k] = 0
+		}
+		for e := g.Offsets[i]; e < g.Offsets[i+1]; e++ {
+			action := actions[g.Columns[e]]
+			if action >= 0 {
+				row[action] += weights[e]
+			}
+		}
+	}
+}
+
+// parallelRange calls f with contiguous chunks of [0, n) in parallel, using
+// one goroutine per processor.
+func parallelRange(n int, f func(start, end int)) {
+	nWorkers := runtime.GOMAXPROCS(0)
+	chunkSize := (n + nWorkers - 1) / nWorkers
+	if chunkSize == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += chunkSize {
+		end := start + chunkSize
+		if end > n {
+			end = n
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			f(start, end)
+		}(start, end)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,142 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+func TestNewGraph(t *testing.T) {
+	a1 := b.NewAgent()
+	a2 := b.NewAgent()
+	a3 := b.NewAgent()
+	outsider := b.NewAgent()
+	a1.Friends[a2] = 0.5
+	a1.Friends[outsider] = 1.0
+	a3.Friends[a1] = 0.25
+	a3.Friends[a3] = 0.75
+
+	g := NewGraph([]*b.Agent{a1, a2, a3}, Float64)
+
+	if g.NNodes() != 3 {
+		t.Errorf("NNodes() should be 3; it was %d", g.NNodes())
+	}
+
+	if g.NEdges() != 3 {
+		t.Errorf("NEdges() should be 3; it was %d", g.NEdges())
+	}
+
+	expectedOffsets := []int{0, 1, 1, 3}
+	for i, offset := range expectedOffsets {
+		if g.Offsets[i] != offset {
+			t.Errorf("Offsets[%d] should be %d; it was %d", i, offset, g.Offsets[i])
+		}
+	}
+
+	if g.Columns[0] != 1 || g.Weights.At(0) != 0.5 {
+		t.Errorf("First edge should be to 1 with weight 0.5; it was to %d with weight %f", g.Columns[0], g.Weights.At(0))
+	}
+}
+
+func TestTallyMatchesGetActionsOfFriends(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1"), b.NewBehaviour("b2"), b.NewBehaviour("b3")}
+	agents, actions := newRandomNetwork(rng, 1000, 10, behaviours)
+	// Agents who have not performed an action are ignored.
+	delete(agents[0].Actions, 0)
+	actions[0] = -1
+
+	g := NewGraph(agents, Float64)
+	tally := make(Float64Vector, len(agents)*len(behaviours))
+	g.Tally(actions, len(behaviours), tally)
+
+	for i, agent := range agents {
+		expected := agent.GetActionsOfFriends(0)
+		for k, behaviour := range behaviours {
+			if math.Abs(tally[i*len(behaviours)+k]-expected[behaviour]) > 1e-12 {
+				t.Errorf(
+					"Tally of agent %d for behaviour %d should be %f; it was %f",
+					i,
+					k,
+					expected[behaviour],
+					tally[i*len(behaviours)+k],
+				)
+			}
+		}
+	}
+}
+
+// newRandomNetwork creates agents who each have nFriends random friends and
+// performed a random behaviour at time 0, and the index of each behaviour.
+func newRandomNetwork(
+	rng *rand.Rand,
+	nAgents int,
+	nFriends int,
+	behaviours []*b.Behaviour,
+) ([]*b.Agent, []int32) {
+	agents := make([]*b.Agent, nAgents)
+	actions := make([]int32, nAgents)
+	for i := range agents {
+		agents[i] = &b.Agent{
+			Friends: make(map[*b.Agent]float64, nFriends),
+			Actions: make(map[b.SimTime]*b.Behaviour, 1),
+		}
+		actions[i] = int32(rng.Intn(len(behaviours)))
+		agents[i].Actions[0] = behaviours[actions[i]]
+	}
+
+	for _, agent := range agents {
+		for len(agent.Friends) < nFriends {
+			agent.Friends[agents[rng.Intn(nAgents)]] = rng.Float64()
+		}
+	}
+
+	return agents, actions
+}
+
+// BenchmarkTally compares tallying the actions of the friends of every agent
+// using the maps of the agents with a Graph.
+func BenchmarkTally(bm *testing.B) {
+	sizes := []struct {
+		nAgents  int
+		nFriends int
+	}{
+		{10000, 10},
+		{100000, 10},
+		{1000000, 10},
+	}
+
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1"), b.NewBehaviour("b2"), b.NewBehaviour("b3")}
+
+	for _, size := range sizes {
+		name := fmt.Sprintf("nodes=%d/edges=%d", size.nAgents, size.nAgents*size.nFriends)
+		bm.Run(name, func(bm *testing.B) {
+			if testing.Short() && size.nAgents > 100000 {
+				bm.Skip("skipping large graph in short mode")
+			}
+
+			rng := rand.New(rand.NewSource(1))
+			agents, actions := newRandomNetwork(rng, size.nAgents, size.nFriends, behaviours)
+
+			bm.Run("map", func(bm *testing.B) {
+				for i := 0; i < bm.N; i++ {
+					for _, agent := range agents {
+						agent.GetActionsOfFriends(0)
+					}
+				}
+			})
+
+			bm.Run("csr", func(bm *testing.B) {
+				g := NewGraph(agents, Float64)
+				tally := make(Float64Vector, len(agents)*len(behaviours))
+				bm.ResetTimer()
+				for i := 0; i < bm.N; i++ {
+					g.Tally(actions, len(behaviours), tally)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,484 @@
+// Package dense implements an index-based storage engine for the simulation.
+//
+// Beliefs, behaviours and agents are given dense integer indices (their
+// position in the slices the Model is created from), and the state of the
+// agents is stored in flat slices rather than the maps of each
+// beliefspread.Agent. The maps are only written to when the Model is asked to,
+// so the beliefspread types remain a compatibility façade.
+//
+// The Model follows the same rules as beliefspread.Agent.UpdateActivation,
+// including the errors it returns when a delta or activation is missing.
+package dense
+
+import (
+	"errors"
+	"sync"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+var (
+	errDeltaNotFound      = errors.New("delta not found")
+	errNoActivationAtTime = errors.New("no activation for time")
+	errNoActivation       = errors.New("no activation found for belief")
+)
+
+// Model is the dense representation of the state of a simulation.
+type Model struct {
+	// The agents, indexed by agent.
+	Agents []*b.Agent
+	// The beliefs, indexed by belief.
+	Beliefs []*b.Belief
+	// The behaviours, indexed by behaviour.
+	Behaviours []*b.Behaviour
+	// The ghosts, whose actions are observed but which are not simulated. The
+	// index of Ghosts[k] is len(Agents)+k.
+	Ghosts []*b.Agent
+
+	nAgents     int
+	nBeliefs    int
+	nBehaviours int
+
+	// The index of each behaviour.
+	behaviourIndices map[*b.Behaviour]int
+
+	// The perception of each belief to each behaviour, indexed by
+	// belief*nBehaviours + behaviour.
+	perception []float64
+	// The relationship of each belief to each other belief, indexed by
+	// belief*nBeliefs + belief.
+	relationship []float64
+	// Whether the relationship between two beliefs exists.
+	hasRelationship []bool
+	// The performance relationship of each belief to each behaviour, indexed
+	// by belief*nBehaviours + behaviour, rounded to the precision of the
+	// Model. There are few of them, so they are stored as float64, and
+	// preferences are calculated without converting them.
+	prs []float64
+
+	// The deltas of each agent, indexed by agent*nBeliefs + belief.
+	deltas Vector
+	// Whether the delta exists.
+	hasDelta []bool
+
+	// The friends of each agent.
+	graph *Graph
+	// The number of friends of each agent, including those which are not in
+	// Agents.
+	degree []int
+	// The total weight of the friends of each agent who performed each
+	// behaviour, indexed by agent*nBehaviours + behaviour.
+	tally Vector
+
+	// The time of the current activations.
+	time b.SimTime
+	// The current activations, indexed by agent*nBeliefs + belief.
+	activations Vector
+	// Whether the current activation exists.
+	hasActivation []bool
+	// The previous activations, which are reused to avoid allocation.
+	previous    Vector
+	hasPrevious []bool
+	// The index of the behaviour each agent, and then each ghost, most
+	// recently performed, or -1.
+	actions []int32
+}
+
+// New creates a Model from the state of the agents at the specified time,
+// stored at Float64 precision.
+//
+// Friends which are not in agents are counted when calculating pressure, but
+// their actions are never observed.
+//
+// The friends of the agents are stored as a Graph, so the actions of the
+// friends of every agent are tallied in a single pass.
+func New(
+	agents []*b.Agent,
+	beliefs []*b.Belief,
+	behaviours []*b.Behaviour,
+	prs map[*b.Belief]map[*b.Behaviour]float64,
+	time b.SimTime,
+) *Model {
+	return NewWithPrecision(agents, beliefs, behaviours, prs, time, Float64)
+}
+
+// NewWithPrecision creates a Model from the state of the agents at the
+// specified time, stored at the specified Precision.
+func NewWithPrecision(
+	agents []*b.Agent,
+	beliefs []*b.Belief,
+	behaviours []*b.Behaviour,
+	prs map[*b.Belief]map[*b.Behaviour]float64,
+	time b.SimTime,
+	p Precision,
+) *Model {
+	return NewWithGhosts(agents, nil, beliefs, behaviours, prs, time, p)
+}
+
+// NewWithGhosts creates a Model from the state of the agents at the specified
+// time, in which some of the friends of the agents are ghosts.
+//
+// Ghosts are agents which are simulated elsewhere, such as by another process.
+// They are never updated, but their actions, which are set with SetAction, are
+// observed by their friends in the Model. Friends which are neither agents nor
+// ghosts are counted when calculating pressure, but their actions are never
+// observed.
+func NewWithGhosts(
+	agents []*b.Agent,
+	ghosts []*b.Agent,
+	beliefs []*b.Belief,
+	behaviours []*b.Behaviour,
+	prs map[*b.Belief]map[*b.Behaviour]float64,
+	time b.SimTime,
+	p Precision,
+) *Model {
+	nAgents := len(agents)
+	nBeliefs := len(beliefs)
+	nBehaviours := len(behaviours)
+
+	m := &Model{
+		Agents:           agents,
+		Beliefs:          beliefs,
+		Behaviours:       behaviours,
+		Ghosts:           ghosts,
+		nAgents:          nAgents,
+		nBeliefs:         nBeliefs,
+		nBehaviours:      nBehaviours,
+		behaviourIndices: make(map[*b.Behaviour]int, nBehaviours),
+		perception:       make([]float64, nBeliefs*nBehaviours),
+		relationship:     make([]float64, nBeliefs*nBeliefs),
+		hasRelationship:  make([]bool, nBeliefs*nBeliefs),
+		prs:              make([]float64, nBeliefs*nBehaviours),
+		deltas:           newVector(p, nAgents*nBeliefs),
+		hasDelta:         make([]bool, nAgents*nBeliefs),
+		graph:            newGraph(agents, ghosts, p),
+		degree:           make([]int, nAgents),
+		tally:            newVector(p, nAgents*nBehaviours),
+		time:             time,
+		activations:      newActivationVector(p, nAgents*nBeliefs),
+		hasActivation:    make([]bool, nAgents*nBeliefs),
+		previous:         newActivationVector(p, nAgents*nBeliefs),
+		hasPrevious:      make([]bool, nAgents*nBeliefs),
+		actions:          make([]int32, nAgents+len(ghosts)),
+	}
+
+	for i, behaviour := range behaviours {
+		m.behaviourIndices[behaviour] = i
+	}
+
+	roundedPrs := newVector(p, len(m.prs))
+	for i, belief := range beliefs {
+		for j, behaviour := range behaviours {
+			m.perception[i*nBehaviours+j] = belief.Perception[behaviour]
+			roundedPrs.Set(i*nBehaviours+j, prs[belief][behaviour])
+		}
+		for j, belief2 := range beliefs {
+			r, found := belief.Relationship[belief2]
+			m.relationship[i*nBeliefs+j] = r
+			m.hasRelationship[i*nBeliefs+j] = found
+		}
+	}
+	roundedPrs.Load(0, m.prs)
+
+	for i, agent := range agents {
+		for j, belief := range beliefs {
+			delta, found := agent.Deltas[belief]
+			m.deltas.Set(i*nBeliefs+j, delta)
+			m.hasDelta[i*nBeliefs+j] = found
+			activation, found := agent.Activations[time][belief]
+			m.activations.Set(i*nBeliefs+j, activation)
+			m.hasActivation[i*nBeliefs+j] = found
+		}
+
+		m.degree[i] = len(agent.Friends)
+
+		m.actions[i] = -1
+		action, found := m.behaviourIndices[agent.Actions[time]]
+		if found {
+			m.actions[i] = int32(action)
+		}
+	}
+
+	for k, ghost := range ghosts {
+		m.actions[nAgents+k] = -1
+		action, found := m.behaviourIndices[ghost.Actions[time]]
+		if found {
+			m.actions[nAgents+k] = int32(action)
+		}
+	}
+
+	return m
+}
+
+// NAgents gets the number of agents in the Model, excluding ghosts.
+func (m *Model) NAgents() int {
+	return m.nAgents
+}
+
+// Time gets the time of the current state of the Model.
+func (m *Model) Time() b.SimTime {
+	return m.time
+}
+
+// Activation gets the current activation of a belief for an agent, and whether
+// it exists.
+func (m *Model) Activation(agent, belief int) (float64, bool) {
+	i := agent*m.nBeliefs + belief
+	return m.activations.At(i), m.hasActivation[i]
+}
+
+// Action gets the index of the behaviour the agent or ghost most recently
+// performed, or -1 if it has not performed one.
+func (m *Model) Action(agent int) int {
+	return int(m.actions[agent])
+}
+
+// SetAction sets the behaviour the agent or ghost performed at the current time,
+// or -1 if it did not perform one.
+func (m *Model) SetAction(agent, behaviour int) {
+	m.actions[agent] = int32(behaviour)
+}
+
+// UpdateActivations updates the activations of every agent for the specified
+// time, which must be the time after the current time.
+//
+// This returns the number of agents which failed to update, and the first
+// error encountered. As with beliefspread.Agent.UpdateActivationForAllBeliefs,
+// an agent stops updating at the first belief which fails.
+func (m *Model) UpdateActivations(time b.SimTime) (failed uint64, err error) {
+	m.previous, m.activations = m.activations, m.previous
+	m.hasPrevious, m.hasActivation = m.hasActivation, m.hasPrevious
+	m.time = time
+
+	m.graph.Tally(m.actions, m.nBehaviours, m.tally)
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		firstAt  int
+	)
+
+	parallelRange(m.nAgents, func(start, end int) {
+		var chunkFailed uint64
+		var chunkErr error
+		scratch := m.newAgentScratch()
+		for i := start; i < end; i++ {
+			err := m.updateAgent(i, scratch)
+			if err != nil {
+				if chunkErr == nil {
+					chunkErr = err
+				}
+				chunkFailed++
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		failed += chunkFailed
+		if chunkErr != nil && (firstErr == nil || start < firstAt) {
+			firstErr = chunkErr
+			firstAt = start
+		}
+	})
+
+	return failed, firstErr
+}
+
+// agentScratch is the scratch space used to update an agent, holding its rows
+// of the Vectors of the Model as float64, so that each row is converted with a
+// single call, rather than a call per value.
+type agentScratch struct {
+	// The tally of the actions of the friends of the agent.
+	tally []float64
+	// The previous activations of the agent.
+	previous []float64
+	// The deltas of the agent.
+	deltas []float64
+	// The activations of the agent being calculated.
+	activations []float64
+}
+
+func (m *Model) newAgentScratch() *agentScratch {
+	return &agentScratch{
+		tally:       make([]float64, m.nBehaviours),
+		previous:    make([]float64, m.nBeliefs),
+		deltas:      make([]float64, m.nBeliefs),
+		activations: make([]float64, m.nBeliefs),
+	}
+}
+
+// updateAgent updates the activations of every belief of an agent, using
+// scratch to hold its rows of the Vectors of the Model.
+func (m *Model) updateAgent(agent int, scratch *agentScratch) error {
+	offset := agent * m.nBeliefs
+	for j := 0; j < m.nBeliefs; j++ {
+		m.hasActivation[offset+j] = false
+	}
+	clear(scratch.activations)
+	m.tally.Load(agent*m.nBehaviours, scratch.tally)
+	m.previous.Load(offset, scratch.previous)
+	m.deltas.Load(offset, scratch.deltas)
+
+	err := m.updateBeliefs(agent, scratch)
+	m.activations.Store(offset, scratch.activations)
+	return err
+}
+
+// updateBeliefs calculates the activations of every belief of an agent from
+// the rows in scratch, stopping at the first belief which fails.
+func (m *Model) updateBeliefs(agent int, scratch *agentScratch) error {
+	offset := agent * m.nBeliefs
+	hasTime := false
+	for j := 0; j < m.nBeliefs; j++ {
+		hasTime = hasTime || m.hasPrevious[offset+j]
+	}
+
+	for j := 0; j < m.nBeliefs; j++ {
+		if !m.hasDelta[offset+j] {
+			return errDeltaNotFound
+		}
+		if !hasTime {
+			return errNoActivationAtTime
+		}
+		if !m.hasPrevious[offset+j] {
+			return errNoActivation
+		}
+
+		activation := scratch.previous[j]
+		change := m.activationChange(agent, j, activation, scratch.tally)
+		scratch.activations[j] = b.Max(-1.0, b.Min(1.0, scratch.deltas[j]*activation+change))
+		m.hasActivation[offset+j] = true
+	}
+
+	return nil
+}
+
+// activationChange gets the change in activation of a belief for an agent,
+// given its previous activation and the tally of the actions of its friends.
+//
+// This is equivalent to beliefspread.Agent.ActivationChange.
+func (m *Model) activationChange(
+	agent int,
+	belief int,
+	activation float64,
+	tally []float64,
+) float64 {
+	pressure := 0.0
+	if m.degree[agent] != 0 {
+		perception := m.perception[belief*m.nBehaviours : (belief+1)*m.nBehaviours]
+		for k, w := range tally {
+			if w != 0 {
+				pressure += perception[k] * w
+			}
+		}
+		pressure /= float64(m.degree[agent])
+	}
+
+	context := 0.0
+	if m.nBeliefs != 0 {
+		offset := belief * m.nBeliefs
+		for j := 0; j < m.nBeliefs; j++ {
+			if m.hasRelationship[offset+j] {
+				context += activation * m.relationship[offset+j]
+			}
+		}
+		context /= float64(m.nBeliefs)
+	}
+
+	if pressure > 0.0 {
+		return (1.0 + context) / 2.0 * pressure
+	} else {
+		return (1.0 - context) / 2.0 * pressure
+	}
+}
+
+// Preferences gets the unnormalized preference of an agent for each behaviour,
+// given its current activations.
+//
+// values must have a length of at least the number of behaviours.
+func (m *Model) Preferences(agent int, values []float64) {
+	offset := agent * m.nBeliefs
+	clear(values[:m.nBehaviours])
+	for j := 0; j < m.nBeliefs; j++ {
+		activation := m.activations.At(offset + j)
+		prs := m.prs[j*m.nBehaviours : (j+1)*m.nBehaviours]
+		for k, pr := range prs {
+			values[k] += pr * activation
+		}
+	}
+}
+
+// WriteActivations writes the current activations of every agent to the
+// Activations of the agent at the current time.
+func (m *Model) WriteActivations() {
+	row := make([]float64, m.nBeliefs)
+	for i, agent := range m.Agents {
+		offset := i * m.nBeliefs
+		m.activations.Load(offset, row)
+		var acts map[*b.Belief]float64
+		for j, belief := range m.Beliefs {
+			if m.hasActivation[offset+j] {
+				if acts == nil {
+					acts = make(map[*b.Belief]float64, m.nBeliefs)
+				}
+				acts[belief] = row[j]
+			}
+		}
+		if acts != nil {
+			agent.Activations[m.time] = acts
+		}
+	}
+}
+
+// WriteActions writes the current action of every agent to the Actions of the
+// agent at the current time.
+func (m *Model) WriteActions() {
+	for i, agent := range m.Agents {
+		if m.actions[i] >= 0 {
+			agent.Actions[m.time] = m.Behaviours[m.actions[i]]
+		}
+	}
+}
+
+// BehaviourIndex gets the index of a behaviour, or -1 if it is not in the Model.
+func (m *Model) BehaviourIndex(behaviour *b.Behaviour) int {
+	i, found := m.behaviourIndices[behaviour]
+	if !found {
+		return -1
+	}
+	return i
+}
+
+// Graph gets the social graph of the agents.
+func (m *Model) Graph() *Graph {
+	return m.graph
+}
+
+// Bytes estimates the number of bytes used to store the state of the Model,
+// excluding the agents, beliefs and behaviours it was created from.
+func (m *Model) Bytes() int {
+	n := vectorBytes(m.activations) +
+		vectorBytes(m.previous) +
+		vectorBytes(m.deltas) +
+		vectorBytes(m.tally) +
+		vectorBytes(m.graph.Weights)
+	n += len(m.hasActivation) + len(m.hasPrevious) + len(m.hasDelta)
+	n += 8*len(m.graph.Offsets) + 4*len(m.graph.Columns)
+	n += 4*len(m.actions) + 8*len(m.degree)
+	n += 8*(len(m.perception)+len(m.relationship)+len(m.prs)) + len(m.hasRelationship)
+	return n
+}
+
+// StateBytes calculates the number of bytes Model.Bytes estimates are used by
+// a Model of nAgents agents, without ghosts, holding nBeliefs beliefs about
+// nBehaviours behaviours, whose Graph has nEdges edges, stored at the
+// specified Precision, without creating the Model.
+func StateBytes(nAgents, nBeliefs, nBehaviours, nEdges int, p Precision) int {
+	n := 2*activationBytes(p)*nAgents*nBeliefs +
+		valueBytes(p)*(nAgents*nBeliefs+nAgents*nBehaviours+nEdges)
+	n += 3 * nAgents * nBeliefs
+	n += 8*(nAgents+1) + 4*nEdges
+	n += 4*nAgents + 8*nAgents
+	n += 8*(2*nBeliefs*nBehaviours+nBeliefs*nBeliefs) + nBeliefs*nBeliefs
+	return n
+}
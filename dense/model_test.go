@@ -0,0 +1,227 @@
+package dense
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// newRandomAgents creates agents holding the beliefs with random activations,
+// deltas, friends and actions at time 0.
+func newRandomAgents(
+	rng *rand.Rand,
+	nAgents int,
+	nFriends int,
+	beliefs []*b.Belief,
+	behaviours []*b.Behaviour,
+) []*b.Agent {
+	agents := make([]*b.Agent, nAgents)
+	for i := range agents {
+		agents[i] = b.NewAgent()
+	}
+
+	for _, agent := range agents {
+		agent.Activations[0] = make(map[*b.Belief]float64)
+		for _, belief := range beliefs {
+			agent.Activations[0][belief] = rng.Float64()*2 - 1
+			agent.Deltas[belief] = rng.Float64()
+		}
+		for j := 0; j < nFriends; j++ {
+			agent.Friends[agents[rng.Intn(nAgents)]] = rng.Float64()
+		}
+		agent.Actions[0] = behaviours[rng.Intn(len(behaviours))]
+	}
+
+	return agents
+}
+
+func newRandomBeliefs(rng *rand.Rand, n int, behaviours []*b.Behaviour) []*b.Belief {
+	beliefs := make([]*b.Belief, n)
+	for i := range beliefs {
+		beliefs[i] = b.NewBelief("belief")
+		for _, behaviour := range behaviours {
+			beliefs[i].Perception[behaviour] = rng.Float64()*2 - 1
+		}
+	}
+	for _, belief := range beliefs {
+		for _, belief2 := range beliefs {
+			belief.Relationship[belief2] = rng.Float64()*2 - 1
+		}
+	}
+	return beliefs
+}
+
+func TestUpdateActivationsMatchesAgent(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1"), b.NewBehaviour("b2")}
+	beliefs := newRandomBeliefs(rng, 3, behaviours)
+	agents := newRandomAgents(rng, 100, 5, beliefs, behaviours)
+
+	m := New(agents, beliefs, behaviours, nil, 0)
+	failed, err := m.UpdateActivations(1)
+	if failed != 0 || err != nil {
+		t.Fatalf("Unexpected failures: %d, %v", failed, err)
+	}
+
+	for i, agent := range agents {
+		err := agent.UpdateActivationForAllBeliefs(1, beliefs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, belief := range beliefs {
+			expected := agent.Activations[1][belief]
+			act, found := m.Activation(i, j)
+			if !found {
+				t.Fatalf("Activation of agent %d for belief %d should exist", i, j)
+			}
+			if math.Abs(act-expected) > 1e-12 {
+				t.Errorf("Activation should be %f; it was %f", expected, act)
+			}
+		}
+	}
+}
+
+func TestUpdateActivationsWhenDeltaMissing(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1")}
+	beliefs := newRandomBeliefs(rng, 2, behaviours)
+	agents := newRandomAgents(rng, 3, 1, beliefs, behaviours)
+	delete(agents[1].Deltas, beliefs[1])
+
+	m := New(agents, beliefs, behaviours, nil, 0)
+	failed, err := m.UpdateActivations(1)
+
+	if failed != 1 {
+		t.Errorf("failed should be 1; it was %d", failed)
+	}
+
+	if err == nil || err.Error() != "delta not found" {
+		t.Errorf("Expected delta not found error; got %v", err)
+	}
+
+	if _, found := m.Activation(1, 0); !found {
+		t.Error("Activation of the first belief should have been updated")
+	}
+
+	if _, found := m.Activation(1, 1); found {
+		t.Error("Activation of the second belief should not have been updated")
+	}
+}
+
+func TestUpdateActivationsWhenActivationMissing(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1")}
+	beliefs := newRandomBeliefs(rng, 2, behaviours)
+	agents := newRandomAgents(rng, 3, 1, beliefs, behaviours)
+	delete(agents[2].Activations, 0)
+
+	m := New(agents, beliefs, behaviours, nil, 0)
+	failed, err := m.UpdateActivations(1)
+
+	if failed != 1 {
+		t.Errorf("failed should be 1; it was %d", failed)
+	}
+
+	if err == nil || err.Error() != "no activation for time" {
+		t.Errorf("Expected no activation for time error; got %v", err)
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	behaviour1 := b.NewBehaviour("b1")
+	behaviour2 := b.NewBehaviour("b2")
+	belief1 := b.NewBelief("belief1")
+	belief2 := b.NewBelief("belief2")
+	agent := b.NewAgent()
+	agent.Activations[0] = map[*b.Belief]float64{belief1: 0.5, belief2: -1.0}
+	prs := map[*b.Belief]map[*b.Behaviour]float64{
+		belief1: {behaviour1: 0.5, behaviour2: -0.5},
+		belief2: {behaviour1: 0.25},
+	}
+
+	m := New(
+		[]*b.Agent{agent},
+		[]*b.Belief{belief1, belief2},
+		[]*b.Behaviour{behaviour1, behaviour2},
+		prs,
+		0,
+	)
+	values := make([]float64, 2)
+	m.Preferences(0, values)
+
+	if values[0] != 0.0 {
+		t.Errorf("values[0] should be 0; it was %f", values[0])
+	}
+
+	if values[1] != -0.25 {
+		t.Errorf("values[1] should be -0.25; it was %f", values[1])
+	}
+}
+
+func TestWriteActivationsAndActions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1"), b.NewBehaviour("b2")}
+	beliefs := newRandomBeliefs(rng, 2, behaviours)
+	agents := newRandomAgents(rng, 3, 1, beliefs, behaviours)
+
+	m := New(agents, beliefs, behaviours, nil, 0)
+	_, err := m.UpdateActivations(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetAction(0, 1)
+	m.WriteActivations()
+	m.WriteActions()
+
+	act, _ := m.Activation(2, 1)
+	if agents[2].Activations[1][beliefs[1]] != act {
+		t.Errorf("Activation should be %f; it was %f", act, agents[2].Activations[1][beliefs[1]])
+	}
+
+	if agents[0].Actions[1] != behaviours[1] {
+		t.Error("Action should have been written")
+	}
+}
+
+func TestGhostsMatchFullModel(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1"), b.NewBehaviour("b2")}
+	beliefs := newRandomBeliefs(rng, 3, behaviours)
+	agents := newRandomAgents(rng, 100, 5, beliefs, behaviours)
+
+	full := New(agents, beliefs, behaviours, nil, 0)
+	shard := NewWithGhosts(agents[:50], agents[50:], beliefs, behaviours, nil, 0, Float64)
+
+	for time := b.SimTime(1); time <= 3; time++ {
+		_, err := full.UpdateActivations(time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = shard.UpdateActivations(time)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range agents {
+			action := rng.Intn(len(behaviours))
+			full.SetAction(i, action)
+			shard.SetAction(i, action)
+		}
+	}
+
+	if shard.NAgents() != 50 {
+		t.Errorf("shard.NAgents() should be 50; it was %d", shard.NAgents())
+	}
+
+	for i := 0; i < shard.NAgents(); i++ {
+		for j := range beliefs {
+			expected, _ := full.Activation(i, j)
+			act, _ := shard.Activation(i, j)
+			if act != expected {
+				t.Errorf("Activation should be %f; it was %f", expected, act)
+			}
+		}
+	}
+}
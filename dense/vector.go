@@ -0,0 +1,208 @@
+package dense
+
+import (
+	"fmt"
+	"math"
+)
+
+// Precision is the precision with which a Model stores the state of the
+// simulation.
+//
+// Reduced precisions use less memory, at the cost of some drift from a Model
+// stored at Float64 precision. Calculations are always carried out with
+// float64, and only the stored values are rounded.
+type Precision int
+
+const (
+	// Float64 stores every value as a float64.
+	Float64 Precision = iota
+	// Float32 stores activations, deltas and friend weights as float32,
+	// halving the memory they use, and rounds performance relationships to
+	// float32.
+	Float32
+	// Int16 stores activations as int16, quantised to steps of 1/32767 in the
+	// range [-1, +1], and everything else as with Float32.
+	Int16
+)
+
+// String gets the name of the Precision.
+func (p Precision) String() string {
+	switch p {
+	case Float64:
+		return "float64"
+	case Float32:
+		return "float32"
+	case Int16:
+		return "int16"
+	default:
+		return fmt.Sprintf("Precision(%d)", int(p))
+	}
+}
+
+// ParsePrecision gets the Precision with the specified name.
+func ParsePrecision(name string) (Precision, error) {
+	switch name {
+	case "float64":
+		return Float64, nil
+	case "float32":
+		return Float32, nil
+	case "int16":
+		return Int16, nil
+	default:
+		return Float64, fmt.Errorf("unknown precision %q", name)
+	}
+}
+
+// Vector is a fixed-length vector of values, which may be stored with reduced
+// precision.
+type Vector interface {
+	// Len gets the length of the Vector.
+	Len() int
+	// At gets the value at index i.
+	At(i int) float64
+	// Set sets the value at index i, rounding it to the precision of the
+	// Vector.
+	Set(i int, v float64)
+	// Load gets the values from index i into dst, converting a whole row with
+	// a single call, rather than a call per value.
+	Load(i int, dst []float64)
+	// Store sets the values from index i to src, rounding them to the
+	// precision of the Vector.
+	Store(i int, src []float64)
+}
+
+// Float64Vector is a Vector which stores values as float64.
+type Float64Vector []float64
+
+// Len gets the length of the Vector.
+func (v Float64Vector) Len() int { return len(v) }
+
+// At gets the value at index i.
+func (v Float64Vector) At(i int) float64 { return v[i] }
+
+// Set sets the value at index i.
+func (v Float64Vector) Set(i int, x float64) { v[i] = x }
+
+// Load gets the values from index i into dst.
+func (v Float64Vector) Load(i int, dst []float64) { copy(dst, v[i:i+len(dst)]) }
+
+// Store sets the values from index i to src.
+func (v Float64Vector) Store(i int, src []float64) { copy(v[i:i+len(src)], src) }
+
+// Float32Vector is a Vector which stores values as float32.
+type Float32Vector []float32
+
+// Len gets the length of the Vector.
+func (v Float32Vector) Len() int { return len(v) }
+
+// At gets the value at index i.
+func (v Float32Vector) At(i int) float64 { return float64(v[i]) }
+
+// Set sets the value at index i, rounding it to the nearest float32.
+func (v Float32Vector) Set(i int, x float64) { v[i] = float32(x) }
+
+// Load gets the values from index i into dst.
+func (v Float32Vector) Load(i int, dst []float64) {
+	for k, x := range v[i : i+len(dst)] {
+		dst[k] = float64(x)
+	}
+}
+
+// Store sets the values from index i to src, rounding them to the nearest
+// float32.
+func (v Float32Vector) Store(i int, src []float64) {
+	row := v[i : i+len(src)]
+	for k, x := range src {
+		row[k] = float32(x)
+	}
+}
+
+// Int16Vector is a Vector which stores values in the range [-1, +1] as int16,
+// quantised to steps of 1/Int16Scale.
+type Int16Vector []int16
+
+// Int16Scale is the value of +1 in an Int16Vector.
+const Int16Scale = math.MaxInt16
+
+// Len gets the length of the Vector.
+func (v Int16Vector) Len() int { return len(v) }
+
+// At gets the value at index i.
+func (v Int16Vector) At(i int) float64 { return float64(v[i]) / Int16Scale }
+
+// Set sets the value at index i, clamping it to [-1, +1] and rounding it to the
+// nearest step.
+func (v Int16Vector) Set(i int, x float64) {
+	v[i] = int16(math.Round(math.Max(-1.0, math.Min(1.0, x)) * Int16Scale))
+}
+
+// Load gets the values from index i into dst.
+func (v Int16Vector) Load(i int, dst []float64) {
+	for k, x := range v[i : i+len(dst)] {
+		dst[k] = float64(x) / Int16Scale
+	}
+}
+
+// Store sets the values from index i to src, clamping them to [-1, +1] and
+// rounding them to the nearest step.
+func (v Int16Vector) Store(i int, src []float64) {
+	row := v[i : i+len(src)]
+	for k, x := range src {
+		row[k] = int16(math.Round(math.Max(-1.0, math.Min(1.0, x)) * Int16Scale))
+	}
+}
+
+// newVector creates a Vector of length n at the specified precision, for values
+// other than activations.
+func newVector(p Precision, n int) Vector {
+	if p == Float64 {
+		return make(Float64Vector, n)
+	}
+	return make(Float32Vector, n)
+}
+
+// newActivationVector creates a Vector of length n at the specified precision,
+// for activations.
+func newActivationVector(p Precision, n int) Vector {
+	if p == Int16 {
+		return make(Int16Vector, n)
+	}
+	return newVector(p, n)
+}
+
+// valueBytes gets the number of bytes used by each value of a Vector for values
+// other than activations at the specified precision.
+func valueBytes(p Precision) int {
+	if p == Float64 {
+		return 8
+	}
+	return 4
+}
+
+// activationBytes gets the number of bytes used by each value of a Vector for
+// activations at the specified precision.
+func activationBytes(p Precision) int {
+	if p == Int16 {
+		return 2
+	}
+	return valueBytes(p)
+}
+
+// vectorBytes gets the number of bytes used by the values of a Vector.
+func vectorBytes(v Vector) int {
+	switch v.(type) {
+	case Float64Vector:
+		return 8 * v.Len()
+	case Float32Vector:
+		return 4 * v.Len()
+	case Int16Vector:
+		return 2 * v.Len()
+	default:
+		return 8 * v.Len()
+	}
+}
+
+// real is the type of the values of a Vector which is not quantised.
+type real interface {
+	~float32 | ~float64
+}
@@ -0,0 +1,135 @@
+package dense
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+func TestInt16VectorQuantisesAndClamps(t *testing.T) {
+	v := make(Int16Vector, 3)
+	v.Set(0, 1.5)
+	v.Set(1, -0.5)
+	v.Set(2, 1.0/Int16Scale*0.4)
+
+	if v.At(0) != 1.0 {
+		t.Errorf("v.At(0) should be 1; it was %f", v.At(0))
+	}
+
+	if math.Abs(v.At(1)+0.5) > 0.5/Int16Scale {
+		t.Errorf("v.At(1) should be -0.5; it was %f", v.At(1))
+	}
+
+	if v.At(2) != 0.0 {
+		t.Errorf("v.At(2) should be 0; it was %f", v.At(2))
+	}
+}
+
+func TestFloat32VectorRounds(t *testing.T) {
+	v := make(Float32Vector, 1)
+	v.Set(0, 0.1)
+
+	if v.At(0) != float64(float32(0.1)) {
+		t.Errorf("v.At(0) should be %f; it was %f", float64(float32(0.1)), v.At(0))
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	for _, p := range []Precision{Float64, Float32, Int16} {
+		parsed, err := ParsePrecision(p.String())
+		if err != nil || parsed != p {
+			t.Errorf("ParsePrecision(%q) should be %v; it was %v, %v", p.String(), p, parsed, err)
+		}
+	}
+
+	_, err := ParsePrecision("float16")
+	if err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestReducedPrecisionIsCloseToFloat64(t *testing.T) {
+	tolerances := map[Precision]float64{
+		Float32: 1e-6,
+		Int16:   1e-3,
+	}
+
+	for precision, tolerance := range tolerances {
+		rng := rand.New(rand.NewSource(1))
+		behaviours := []*b.Behaviour{b.NewBehaviour("b1"), b.NewBehaviour("b2")}
+		beliefs := newRandomBeliefs(rng, 3, behaviours)
+		agents := newRandomAgents(rng, 100, 5, beliefs, behaviours)
+
+		reference := New(agents, beliefs, behaviours, nil, 0)
+		reduced := NewWithPrecision(agents, beliefs, behaviours, nil, 0, precision)
+
+		for time := b.SimTime(1); time <= 3; time++ {
+			_, err := reference.UpdateActivations(time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = reduced.UpdateActivations(time)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i := range agents {
+			for j := range beliefs {
+				expected, _ := reference.Activation(i, j)
+				act, _ := reduced.Activation(i, j)
+				if math.Abs(act-expected) > tolerance {
+					t.Errorf(
+						"%s activation should be within %g of %f; it was %f",
+						precision,
+						tolerance,
+						expected,
+						act,
+					)
+				}
+			}
+		}
+
+		if reduced.Bytes() >= reference.Bytes() {
+			t.Errorf("%s should use fewer bytes than float64", precision)
+		}
+	}
+}
+
+func TestStateBytesMatchesModel(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	behaviours := []*b.Behaviour{b.NewBehaviour("b1"), b.NewBehaviour("b2")}
+	beliefs := newRandomBeliefs(rng, 3, behaviours)
+	agents := newRandomAgents(rng, 100, 5, beliefs, behaviours)
+
+	for _, precision := range []Precision{Float64, Float32, Int16} {
+		m := NewWithPrecision(agents, beliefs, behaviours, nil, 0, precision)
+		n := StateBytes(len(agents), len(beliefs), len(behaviours), CountEdges(agents), precision)
+		if n != m.Bytes() {
+			t.Errorf("%s StateBytes should be %d; it was %d", precision, m.Bytes(), n)
+		}
+	}
+}
+
+func TestLoadAndStoreMatchAtAndSet(t *testing.T) {
+	values := []float64{0.1, -0.5, 1.5}
+
+	for _, precision := range []Precision{Float64, Float32, Int16} {
+		stored := newActivationVector(precision, 4)
+		set := newActivationVector(precision, 4)
+		stored.Store(1, values)
+		for k, x := range values {
+			set.Set(1+k, x)
+		}
+
+		loaded := make([]float64, 3)
+		stored.Load(1, loaded)
+		for k := range loaded {
+			if loaded[k] != set.At(1+k) {
+				t.Errorf("%s Load(1)[%d] should be %f; it was %f", precision, k, set.At(1+k), loaded[k])
+			}
+		}
+	}
+}
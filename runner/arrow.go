@@ -0,0 +1,528 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/google/uuid"
+)
+
+// The number of agents in each record batch written by WriteArrowAgents.
+const arrowBatchSize = 1024
+
+// The magic bytes at the start of an Arrow IPC file, which are followed by
+// padding to 8 bytes and then the IPC stream.
+const arrowFileMagic = "ARROW1"
+
+// arrowAgentSchema is the schema of an agents table in Arrow, with a row for
+// each agent, and a list column for each map of an AgentSpec.
+var arrowAgentSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "uuid", Type: arrow.BinaryTypes.String},
+	{Name: "actions", Type: arrow.ListOf(arrow.StructOf(
+		arrow.Field{Name: "tick", Type: arrow.PrimitiveTypes.Uint32},
+		arrow.Field{Name: "behaviour", Type: arrow.BinaryTypes.String},
+	))},
+	{Name: "activations", Type: arrow.ListOf(arrow.StructOf(
+		arrow.Field{Name: "tick", Type: arrow.PrimitiveTypes.Uint32},
+		arrow.Field{Name: "belief", Type: arrow.BinaryTypes.String},
+		arrow.Field{Name: "activation", Type: arrow.PrimitiveTypes.Float64},
+	))},
+	{Name: "deltas", Type: arrow.ListOf(arrow.StructOf(
+		arrow.Field{Name: "belief", Type: arrow.BinaryTypes.String},
+		arrow.Field{Name: "delta", Type: arrow.PrimitiveTypes.Float64},
+	))},
+	{Name: "friends", Type: arrow.ListOf(arrow.StructOf(
+		arrow.Field{Name: "friend", Type: arrow.BinaryTypes.String},
+		arrow.Field{Name: "weight", Type: arrow.PrimitiveTypes.Float64},
+	))},
+}, nil)
+
+// arrowSummarySchema is the schema of the tidy table of WriteTidySummary in
+// Arrow.
+var arrowSummarySchema = arrow.NewSchema([]arrow.Field{
+	{Name: "tick", Type: arrow.PrimitiveTypes.Uint32},
+	{Name: "entityType", Type: arrow.BinaryTypes.String},
+	{Name: "entityUuid", Type: arrow.BinaryTypes.String},
+	{Name: "entityName", Type: arrow.BinaryTypes.String},
+	{Name: "statistic", Type: arrow.BinaryTypes.String},
+	{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+}, nil)
+
+// arrowWriter writes record batches as an Arrow IPC stream or file.
+type arrowWriter interface {
+	Write(rec arrow.Record) error
+	Close() error
+}
+
+// newArrowWriter creates a writer of an Arrow IPC file, or an IPC stream if
+// stream.
+//
+// The buffers are not compressed, so that readers can use them without
+// copying.
+func newArrowWriter(w io.Writer, schema *arrow.Schema, stream bool) (arrowWriter, error) {
+	if stream {
+		return ipc.NewWriter(w, ipc.WithSchema(schema)), nil
+	}
+	return ipc.NewFileWriter(w, ipc.WithSchema(schema))
+}
+
+// withArrowMetadata gets schema with metadata, in order of key, or schema if
+// metadata is empty.
+func withArrowMetadata(schema *arrow.Schema, metadata map[string]string) *arrow.Schema {
+	if len(metadata) == 0 {
+		return schema
+	}
+	keys := sortedKeys(metadata)
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = metadata[key]
+	}
+	md := arrow.NewMetadata(keys, values)
+	return arrow.NewSchema(schema.Fields(), &md)
+}
+
+// writeArrowRecord writes the rows appended to builder since the last record
+// as a record batch.
+func writeArrowRecord(writer arrowWriter, builder *array.RecordBuilder) error {
+	rec := builder.NewRecord()
+	defer rec.Release()
+	return writer.Write(rec)
+}
+
+// WriteArrowAgents writes the state of every agent, including its history, to
+// w as an Arrow IPC file, or an IPC stream if stream.
+//
+// The table has a row for each agent, with the columns uuid, and actions
+// (tick, behaviour), activations (tick, belief, activation), deltas (belief,
+// delta) and friends (friend, weight), which are lists of structs. UUIDs are
+// strings. This can be read as an agents file by DecodeArrowAgentSpecs.
+//
+// metadata is written as the metadata of the schema, such as the StopMetadata
+// of the simulation, and may be nil.
+func WriteArrowAgents(w io.Writer, agents []*b.Agent, stream bool, metadata map[string]string) error {
+	schema := withArrowMetadata(arrowAgentSchema, metadata)
+	writer, err := newArrowWriter(w, schema, stream)
+	if err != nil {
+		return err
+	}
+
+	builder := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer builder.Release()
+
+	for i, a := range agents {
+		appendArrowAgentSpec(builder, NewAgentSpecFromAgent(a))
+		if (i+1)%arrowBatchSize == 0 || i == len(agents)-1 {
+			err = writeArrowRecord(writer, builder)
+			if err != nil {
+				writer.Close()
+				return err
+			}
+		}
+	}
+
+	return writer.Close()
+}
+
+// appendArrowAgentSpec appends a row for spec to a builder of
+// arrowAgentSchema, with the lists sorted by tick and UUID.
+func appendArrowAgentSpec(builder *array.RecordBuilder, spec *AgentSpec) {
+	builder.Field(0).(*array.StringBuilder).Append(spec.Uuid.String())
+
+	actions := builder.Field(1).(*array.ListBuilder)
+	actions.Append(true)
+	action := actions.ValueBuilder().(*array.StructBuilder)
+	times := make([]b.SimTime, 0, len(spec.Actions))
+	for time := range spec.Actions {
+		times = append(times, time)
+	}
+	sortTimes(times)
+	for _, time := range times {
+		action.Append(true)
+		action.FieldBuilder(0).(*array.Uint32Builder).Append(uint32(time))
+		action.FieldBuilder(1).(*array.StringBuilder).Append(spec.Actions[time].String())
+	}
+
+	activations := builder.Field(2).(*array.ListBuilder)
+	activations.Append(true)
+	activation := activations.ValueBuilder().(*array.StructBuilder)
+	times = times[:0]
+	for time := range spec.Activations {
+		times = append(times, time)
+	}
+	sortTimes(times)
+	for _, time := range times {
+		for _, u := range sortedUuids(spec.Activations[time]) {
+			activation.Append(true)
+			activation.FieldBuilder(0).(*array.Uint32Builder).Append(uint32(time))
+			activation.FieldBuilder(1).(*array.StringBuilder).Append(u.String())
+			activation.FieldBuilder(2).(*array.Float64Builder).Append(spec.Activations[time][u])
+		}
+	}
+
+	for _, c := range []struct {
+		field int
+		m     map[uuid.UUID]float64
+	}{
+		{3, spec.Deltas},
+		{4, spec.Friends},
+	} {
+		list := builder.Field(c.field).(*array.ListBuilder)
+		list.Append(true)
+		value := list.ValueBuilder().(*array.StructBuilder)
+		for _, u := range sortedUuids(c.m) {
+			value.Append(true)
+			value.FieldBuilder(0).(*array.StringBuilder).Append(u.String())
+			value.FieldBuilder(1).(*array.Float64Builder).Append(c.m[u])
+		}
+	}
+}
+
+// writeArrowSummary writes the tidy table of WriteTidySummary to w as an
+// Arrow IPC file, or an IPC stream if stream, with a record batch for each
+// tick. Missing values are null.
+//
+// The StopMetadata of summary is written as the metadata of the schema,
+// rather than as columns.
+func writeArrowSummary(
+	w io.Writer,
+	summary *OutputSpecs,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	stream bool,
+) error {
+	schema := withArrowMetadata(arrowSummarySchema, StopMetadata(summary))
+	writer, err := newArrowWriter(w, schema, stream)
+	if err != nil {
+		return err
+	}
+
+	builder := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer builder.Release()
+
+	rows := 0
+	var tick b.SimTime
+	err = forEachTidyRow(summary, behaviours, beliefs, func(row tidyRow) error {
+		if rows != 0 && row.Tick != tick {
+			err := writeArrowRecord(writer, builder)
+			if err != nil {
+				return err
+			}
+		}
+		rows++
+		tick = row.Tick
+
+		builder.Field(0).(*array.Uint32Builder).Append(uint32(row.Tick))
+		builder.Field(1).(*array.StringBuilder).Append(row.EntityType)
+		builder.Field(2).(*array.StringBuilder).Append(row.EntityUuid.String())
+		builder.Field(3).(*array.StringBuilder).Append(row.EntityName)
+		builder.Field(4).(*array.StringBuilder).Append(row.Statistic)
+		if math.IsNaN(row.Value) {
+			builder.Field(5).AppendNull()
+		} else {
+			builder.Field(5).(*array.Float64Builder).Append(row.Value)
+		}
+		return nil
+	})
+	if err == nil && rows != 0 {
+		err = writeArrowRecord(writer, builder)
+	}
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+// DecodeArrowAgentSpecs decodes an agents table from the Arrow IPC stream or
+// file in r, calling f with the AgentSpec of each row as it is decoded.
+//
+// The table has the columns written by WriteArrowAgents. Only the uuid column
+// is required; the list columns may be missing or null. Ticks may be any
+// integer type, values any floating point type, and UUIDs strings or large
+// strings, so tables written by other tools can be read.
+//
+// Only one record batch is held in memory at a time.
+func DecodeArrowAgentSpecs(r io.Reader, f func(*AgentSpec) error) error {
+	buffered := bufio.NewReader(r)
+
+	// An IPC file is the IPC stream after the magic bytes and padding, with
+	// a footer which is not needed to read it in order.
+	magic, err := buffered.Peek(len(arrowFileMagic))
+	if err == nil && string(magic) == arrowFileMagic {
+		_, err = buffered.Discard(8)
+		if err != nil {
+			return err
+		}
+	}
+
+	reader, err := ipc.NewReader(buffered)
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+
+	row := 0
+	for reader.Next() {
+		rec := reader.Record()
+		columns, err := newArrowAgentColumns(rec)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			spec, err := columns.spec(i)
+			if err != nil {
+				return fmt.Errorf("agent %d: %w", row, err)
+			}
+			err = f(spec)
+			if err != nil {
+				return err
+			}
+			row++
+		}
+	}
+
+	return reader.Err()
+}
+
+// arrowAgentColumns reads AgentSpecs from the columns of a record batch of an
+// agents table.
+type arrowAgentColumns struct {
+	uuid        arrow.Array
+	actions     *arrowListColumn
+	activations *arrowListColumn
+	deltas      *arrowListColumn
+	friends     *arrowListColumn
+}
+
+func newArrowAgentColumns(rec arrow.Record) (*arrowAgentColumns, error) {
+	indices := rec.Schema().FieldIndices("uuid")
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("missing uuid column")
+	}
+	columns := &arrowAgentColumns{uuid: rec.Column(indices[0])}
+	var err error
+	for _, c := range []struct {
+		list   **arrowListColumn
+		name   string
+		fields []string
+	}{
+		{&columns.actions, "actions", []string{"tick", "behaviour"}},
+		{&columns.activations, "activations", []string{"tick", "belief", "activation"}},
+		{&columns.deltas, "deltas", []string{"belief", "delta"}},
+		{&columns.friends, "friends", []string{"friend", "weight"}},
+	} {
+		*c.list, err = newArrowListColumn(rec, c.name, c.fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s column: %w", c.name, err)
+		}
+	}
+
+	return columns, nil
+}
+
+// spec gets the AgentSpec of row i.
+func (c *arrowAgentColumns) spec(i int) (*AgentSpec, error) {
+	spec := &AgentSpec{
+		Actions:     make(map[b.SimTime]uuid.UUID),
+		Activations: make(map[b.SimTime]map[uuid.UUID]float64),
+		Deltas:      make(map[uuid.UUID]float64),
+		Friends:     make(map[uuid.UUID]float64),
+	}
+	var err error
+	spec.Uuid, err = arrowValue{c.uuid, i}.uuid()
+	if err != nil {
+		return nil, fmt.Errorf("uuid: %w", err)
+	}
+
+	err = c.actions.forEach(i, func(fields []arrowValue) error {
+		tick, err := fields[0].uint32()
+		if err != nil {
+			return err
+		}
+		spec.Actions[b.SimTime(tick)], err = fields[1].uuid()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("actions: %w", err)
+	}
+
+	err = c.activations.forEach(i, func(fields []arrowValue) error {
+		tick, err := fields[0].uint32()
+		if err != nil {
+			return err
+		}
+		belief, err := fields[1].uuid()
+		if err != nil {
+			return err
+		}
+		activation, err := fields[2].float64()
+		if err != nil {
+			return err
+		}
+		time := b.SimTime(tick)
+		if spec.Activations[time] == nil {
+			spec.Activations[time] = make(map[uuid.UUID]float64)
+		}
+		spec.Activations[time][belief] = activation
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("activations: %w", err)
+	}
+
+	for _, c := range []struct {
+		list *arrowListColumn
+		m    map[uuid.UUID]float64
+		name string
+	}{
+		{c.deltas, spec.Deltas, "deltas"},
+		{c.friends, spec.Friends, "friends"},
+	} {
+		err = c.list.forEach(i, func(fields []arrowValue) error {
+			u, err := fields[0].uuid()
+			if err != nil {
+				return err
+			}
+			c.m[u], err = fields[1].float64()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+	}
+
+	return spec, nil
+}
+
+// arrowListColumn is a column which is a list of structs, which may be
+// missing from the record batch.
+type arrowListColumn struct {
+	list   *array.List
+	fields []arrow.Array
+}
+
+// newArrowListColumn finds the column name of rec, which is a list of structs
+// with fields, or returns nil if there is no such column.
+func newArrowListColumn(rec arrow.Record, name string, fields []string) (*arrowListColumn, error) {
+	indices := rec.Schema().FieldIndices(name)
+	if len(indices) == 0 {
+		return nil, nil
+	}
+
+	list, ok := rec.Column(indices[0]).(*array.List)
+	if !ok {
+		return nil, fmt.Errorf("expected a list, found %v", rec.Column(indices[0]).DataType())
+	}
+	values, ok := list.ListValues().(*array.Struct)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of structs, found %v", list.DataType())
+	}
+
+	column := &arrowListColumn{list: list}
+	structType := values.DataType().(*arrow.StructType)
+	for _, field := range fields {
+		index, found := structType.FieldIdx(field)
+		if !found {
+			return nil, fmt.Errorf("missing struct field %s", field)
+		}
+		column.fields = append(column.fields, values.Field(index))
+	}
+	return column, nil
+}
+
+// forEach calls f with the fields of every struct in the list of row i, unless
+// the column is missing or the list is null.
+func (c *arrowListColumn) forEach(i int, f func(fields []arrowValue) error) error {
+	if c == nil || c.list.IsNull(i) {
+		return nil
+	}
+
+	start, end := c.list.ValueOffsets(i)
+	fields := make([]arrowValue, len(c.fields))
+	for j := start; j < end; j++ {
+		for k, field := range c.fields {
+			fields[k] = arrowValue{field, int(j)}
+		}
+		err := f(fields)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arrowValue is the value at an index of an array.
+type arrowValue struct {
+	array arrow.Array
+	index int
+}
+
+func (v arrowValue) uint32() (uint32, error) {
+	if v.array.IsNull(v.index) {
+		return 0, fmt.Errorf("null tick")
+	}
+	var value int64
+	switch a := v.array.(type) {
+	case *array.Uint8:
+		value = int64(a.Value(v.index))
+	case *array.Uint16:
+		value = int64(a.Value(v.index))
+	case *array.Uint32:
+		value = int64(a.Value(v.index))
+	case *array.Uint64:
+		if a.Value(v.index) > math.MaxUint32 {
+			return 0, fmt.Errorf("tick %d is out of range", a.Value(v.index))
+		}
+		return uint32(a.Value(v.index)), nil
+	case *array.Int8:
+		value = int64(a.Value(v.index))
+	case *array.Int16:
+		value = int64(a.Value(v.index))
+	case *array.Int32:
+		value = int64(a.Value(v.index))
+	case *array.Int64:
+		value = a.Value(v.index)
+	default:
+		return 0, fmt.Errorf("expected an integer tick, found %v", v.array.DataType())
+	}
+	if value < 0 || value > math.MaxUint32 {
+		return 0, fmt.Errorf("tick %d is out of range", value)
+	}
+	return uint32(value), nil
+}
+
+func (v arrowValue) float64() (float64, error) {
+	if v.array.IsNull(v.index) {
+		return 0, fmt.Errorf("null value")
+	}
+	switch a := v.array.(type) {
+	case *array.Float32:
+		return float64(a.Value(v.index)), nil
+	case *array.Float64:
+		return a.Value(v.index), nil
+	default:
+		return 0, fmt.Errorf("expected a floating point value, found %v", v.array.DataType())
+	}
+}
+
+func (v arrowValue) uuid() (uuid.UUID, error) {
+	if v.array.IsNull(v.index) {
+		return uuid.UUID{}, fmt.Errorf("null UUID")
+	}
+	switch a := v.array.(type) {
+	case *array.String:
+		return uuid.Parse(a.Value(v.index))
+	case *array.LargeString:
+		return uuid.Parse(a.Value(v.index))
+	default:
+		return uuid.UUID{}, fmt.Errorf("expected a string UUID, found %v", v.array.DataType())
+	}
+}
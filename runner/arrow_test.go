@@ -0,0 +1,164 @@
+package runner
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestWriteArrowAgentsRoundTrips(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		_, behaviour, belief, agents := newTestFullOutput(t)
+
+		var buf bytes.Buffer
+		err := WriteArrowAgents(&buf, agents, stream, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := ReadAgents(&buf, []*b.Behaviour{behaviour}, []*b.Belief{belief}, true)
+		if err != nil {
+			t.Fatalf("stream %v: %v", stream, err)
+		}
+
+		if len(read) != 3 || read[0].Uuid != agents[0].Uuid || read[2].Uuid != agents[2].Uuid {
+			t.Fatalf("stream %v: unexpected agents %v", stream, read)
+		}
+		if read[0].Friends[read[1]] != 0.5 || read[0].Friends[read[2]] != 0.25 || read[2].Friends[read[0]] != 1 {
+			t.Errorf("stream %v: unexpected friends %v %v", stream, read[0].Friends, read[2].Friends)
+		}
+		if read[1].Activations[3][belief] != 0.3 || read[1].Actions[4] != behaviour {
+			t.Errorf("stream %v: unexpected state %v %v", stream, read[1].Activations, read[1].Actions)
+		}
+		if read[2].Deltas[belief] != 1.1 {
+			t.Errorf("stream %v: unexpected deltas %v", stream, read[2].Deltas)
+		}
+	}
+}
+
+func TestReadAgentSpecsAcceptsOtherArrowTypes(t *testing.T) {
+	activation := arrow.StructOf(
+		arrow.Field{Name: "tick", Type: arrow.PrimitiveTypes.Int64},
+		arrow.Field{Name: "belief", Type: arrow.BinaryTypes.LargeString},
+		arrow.Field{Name: "activation", Type: arrow.PrimitiveTypes.Float32},
+	)
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "uuid", Type: arrow.BinaryTypes.LargeString},
+		{Name: "activations", Type: arrow.ListOf(activation), Nullable: true},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.NewGoAllocator(), schema)
+	defer builder.Release()
+
+	agent := b.NewAgent()
+	belief := b.NewBelief("belief")
+
+	builder.Field(0).(*array.LargeStringBuilder).Append(agent.Uuid.String())
+	activations := builder.Field(1).(*array.ListBuilder)
+	activations.Append(true)
+	values := activations.ValueBuilder().(*array.StructBuilder)
+	values.Append(true)
+	values.FieldBuilder(0).(*array.Int64Builder).Append(7)
+	values.FieldBuilder(1).(*array.LargeStringBuilder).Append(belief.Uuid.String())
+	values.FieldBuilder(2).(*array.Float32Builder).Append(0.5)
+
+	rec := builder.NewRecord()
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	if err := writer.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var specs []*AgentSpec
+	err := ReadAgentSpecs(&buf, func(spec *AgentSpec) error {
+		specs = append(specs, spec)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(specs) != 1 || specs[0].Uuid != agent.Uuid {
+		t.Fatalf("Unexpected specs %v", specs)
+	}
+	if specs[0].Activations[7][belief.Uuid] != 0.5 {
+		t.Errorf("Unexpected activations %v", specs[0].Activations)
+	}
+}
+
+func TestWriteSummaryAsArrow(t *testing.T) {
+	summary, behaviours, beliefs := newTestSummary()
+
+	var buf bytes.Buffer
+	err := WriteSummary(&buf, summary, behaviours, beliefs, OutputFormatArrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := ipc.NewFileReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if reader.NumRecords() != 2 {
+		t.Fatalf("Expected a record batch for each tick, got %d", reader.NumRecords())
+	}
+
+	rec, err := reader.Record(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := rec.Column(5).(*array.Float64)
+	if rec.NumRows() != 5 || value.Value(0) != 0.25 || !value.IsNull(1) {
+		t.Errorf("Unexpected record %v", rec)
+	}
+}
+
+func TestWriteSummaryAsArrowRecordsStopMetadata(t *testing.T) {
+	summary, behaviours, beliefs := newTestSummary()
+	summary.Truncated = true
+	summary.StopReason = StopReasonCancelled
+	expected := map[string]string{"seed": "3", "truncated": "true", "lastTick": "2", "stopReason": "cancelled"}
+
+	for _, format := range []OutputFormat{OutputFormatArrow, OutputFormatArrowStream} {
+		var buf bytes.Buffer
+		err := WriteSummary(&buf, summary, behaviours, beliefs, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var schema *arrow.Schema
+		if format == OutputFormatArrow {
+			reader, err := ipc.NewFileReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			schema = reader.Schema()
+			reader.Close()
+		} else {
+			reader, err := ipc.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schema = reader.Schema()
+			reader.Release()
+		}
+
+		metadata := schema.Metadata().ToMap()
+		if !reflect.DeepEqual(metadata, expected) {
+			t.Errorf("%s: expected metadata %v, got %v", format, expected, metadata)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"errors"
+	"math"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// ConvergenceCriterion defines when the dynamics of the simulation are deemed to
+// have settled, so it can stop before its end time.
+type ConvergenceCriterion struct {
+	// The largest change between consecutive ticks in the mean activation of
+	// any belief, or in the share of agents performing any behaviour, for a
+	// tick to be considered settled.
+	Tolerance float64
+	// The number of consecutive settled ticks after which the simulation has
+	// converged, which must be at least 1 if the Tolerance is positive.
+	Window uint32
+}
+
+// convergenceDetector detects whether a simulation has converged according to a
+// ConvergenceCriterion.
+type convergenceDetector struct {
+	criterion  ConvergenceCriterion
+	beliefs    []*b.Belief
+	behaviours []*b.Behaviour
+	// The mean activation of each belief at the previous tick.
+	means []float64
+	// The share of agents performing each behaviour at the previous tick.
+	shares []float64
+	// Whether the means and shares have been observed.
+	observed bool
+	// The number of consecutive settled ticks.
+	settled uint32
+}
+
+// newConvergenceDetector creates a detector of the criterion, returning an
+// error if its Window is 0 while its Tolerance is positive, as the simulation
+// would converge before any tick is settled.
+func newConvergenceDetector(
+	criterion ConvergenceCriterion,
+	beliefs []*b.Belief,
+	behaviours []*b.Behaviour,
+) (*convergenceDetector, error) {
+	if criterion.Tolerance > 0 && criterion.Window < 1 {
+		return nil, errors.New("the convergence window must be at least 1")
+	}
+	return &convergenceDetector{
+		criterion:  criterion,
+		beliefs:    beliefs,
+		behaviours: behaviours,
+	}, nil
+}
+
+// observe the summary statistics of nAgents agents at a tick, which must follow
+// the tick previously observed.
+func (d *convergenceDetector) observe(o *OutputSpec, nAgents int) {
+	means := make([]float64, len(d.beliefs))
+	shares := make([]float64, len(d.behaviours))
+
+	for i, belief := range d.beliefs {
+		means[i] = o.MeanActivation[belief.Uuid]
+	}
+
+	for i, behaviour := range d.behaviours {
+		shares[i] = float64(o.NPerformers[behaviour.Uuid]) / float64(nAgents)
+	}
+
+	if d.observed {
+		change := 0.0
+		for i := range means {
+			change = math.Max(change, math.Abs(means[i]-d.means[i]))
+		}
+		for i := range shares {
+			change = math.Max(change, math.Abs(shares[i]-d.shares[i]))
+		}
+
+		if change < d.criterion.Tolerance {
+			d.settled++
+		} else {
+			d.settled = 0
+		}
+	}
+
+	d.means = means
+	d.shares = shares
+	d.observed = true
+}
+
+// converged reports whether the simulation has been settled for at least the
+// window of the criterion.
+func (d *convergenceDetector) converged() bool {
+	return d.settled >= d.criterion.Window
+}
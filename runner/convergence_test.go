@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"go.uber.org/zap"
+)
+
+func TestConvergenceDetectorConvergesAfterWindow(t *testing.T) {
+	behaviour := b.NewBehaviour("behaviour")
+	belief := b.NewBelief("belief")
+	agent := b.NewAgent()
+
+	d, err := newConvergenceDetector(
+		ConvergenceCriterion{Tolerance: 0.1, Window: 2},
+		[]*b.Belief{belief},
+		[]*b.Behaviour{behaviour},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activations := []float64{0.0, 0.5, 0.55, 0.6, 0.65}
+	expected := []bool{false, false, false, true, true}
+
+	for i, act := range activations {
+		time := b.SimTime(i)
+		agent.Activations[time] = map[*b.Belief]float64{belief: act}
+		agent.Actions[time] = behaviour
+		d.observe(NewOutputSpecAtTime([]*b.Agent{agent}, []*b.Belief{belief}, time), 1)
+
+		if d.converged() != expected[i] {
+			t.Errorf("converged() at time %d should be %t", i, expected[i])
+		}
+	}
+}
+
+func TestConvergenceDetectorResetsWhenBehaviourSharesChange(t *testing.T) {
+	behaviour1 := b.NewBehaviour("behaviour1")
+	behaviour2 := b.NewBehaviour("behaviour2")
+	belief := b.NewBelief("belief")
+	agent := b.NewAgent()
+
+	d, err := newConvergenceDetector(
+		ConvergenceCriterion{Tolerance: 0.1, Window: 1},
+		[]*b.Belief{belief},
+		[]*b.Behaviour{behaviour1, behaviour2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := []*b.Behaviour{behaviour1, behaviour1, behaviour2}
+	expected := []bool{false, true, false}
+
+	for i, action := range actions {
+		time := b.SimTime(i)
+		agent.Activations[time] = map[*b.Belief]float64{belief: 0.5}
+		agent.Actions[time] = action
+		d.observe(NewOutputSpecAtTime([]*b.Agent{agent}, []*b.Belief{belief}, time), 1)
+
+		if d.converged() != expected[i] {
+			t.Errorf("converged() at time %d should be %t", i, expected[i])
+		}
+	}
+}
+
+func TestRunStopsWhenConverged(t *testing.T) {
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.EndTime = 10
+	r.Configuration.Convergence = &ConvergenceCriterion{Tolerance: 1e-9, Window: 1}
+
+	_, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := readTestOutput(t, r.Configuration)
+
+	if specs.StopReason != StopReasonConverged {
+		t.Errorf("StopReason should be %s; it was %s", StopReasonConverged, specs.StopReason)
+	}
+
+	// The activations are 0.5, 0.75, 1.0, 1.0 at times 1 to 4.
+	if specs.LastTick != 4 {
+		t.Errorf("LastTick should be 4; it was %d", specs.LastTick)
+	}
+
+	if specs.Truncated {
+		t.Error("Output should not be truncated")
+	}
+}
+
+func TestConvergenceDetectorRejectsZeroWindow(t *testing.T) {
+	_, err := newConvergenceDetector(ConvergenceCriterion{Tolerance: 0.1}, nil, nil)
+	if err == nil {
+		t.Error("Expected an error for a window of 0")
+	}
+
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.Convergence = &ConvergenceCriterion{Tolerance: 0.1}
+	_, err = r.Run()
+	if err == nil {
+		t.Error("Expected Run to fail with a window of 0")
+	}
+}
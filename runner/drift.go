@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"math"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// Drift is the difference between the summary statistics of two runs of a
+// simulation, such as a run with a reduced dense.Precision and a run of the
+// same simulation with dense.Float64 precision and the same seed.
+type Drift struct {
+	// The largest absolute difference in the mean activation of any belief, at
+	// each tick.
+	MeanActivation map[b.SimTime]float64
+	// The largest absolute difference in the median activation of any belief,
+	// at each tick.
+	MedianActivation map[b.SimTime]float64
+	// The largest absolute difference in the share of agents performing any
+	// behaviour, at each tick.
+	BehaviourShare map[b.SimTime]float64
+}
+
+// NewDrift calculates the Drift of other from reference, at every tick in
+// reference, for a simulation of nAgents agents.
+func NewDrift(reference, other *OutputSpecs, nAgents int) *Drift {
+	d := &Drift{
+		MeanActivation:   make(map[b.SimTime]float64, len(reference.Data)),
+		MedianActivation: make(map[b.SimTime]float64, len(reference.Data)),
+		BehaviourShare:   make(map[b.SimTime]float64, len(reference.Data)),
+	}
+
+	for time, ref := range reference.Data {
+		o := other.Data[time]
+		d.MeanActivation[time] = maxAbsDifference(ref.MeanActivation, o.MeanActivation)
+		d.MedianActivation[time] = maxAbsDifference(ref.MedianActivation, o.MedianActivation)
+		d.BehaviourShare[time] = float64(maxAbsDifference(ref.NPerformers, o.NPerformers)) /
+			float64(nAgents)
+	}
+
+	return d
+}
+
+// MaxMeanActivation gets the largest drift in mean activation at any tick.
+func (d *Drift) MaxMeanActivation() float64 {
+	return maxValue(d.MeanActivation)
+}
+
+// MaxMedianActivation gets the largest drift in median activation at any tick.
+func (d *Drift) MaxMedianActivation() float64 {
+	return maxValue(d.MedianActivation)
+}
+
+// MaxBehaviourShare gets the largest drift in behaviour share at any tick.
+func (d *Drift) MaxBehaviourShare() float64 {
+	return maxValue(d.BehaviourShare)
+}
+
+// maxAbsDifference gets the largest absolute difference between the values of
+// the same key in a and b, where a missing value is 0.
+func maxAbsDifference[K comparable, V float64 | uint64](a, b map[K]V) (diff V) {
+	absDiff := func(x, y V) V {
+		if x > y {
+			return x - y
+		}
+		return y - x
+	}
+
+	for k, v := range a {
+		diff = V(math.Max(float64(diff), float64(absDiff(v, b[k]))))
+	}
+	for k, v := range b {
+		diff = V(math.Max(float64(diff), float64(absDiff(v, a[k]))))
+	}
+	return
+}
+
+// maxValue gets the largest value in m, or 0 if it is empty.
+func maxValue[K comparable](m map[K]float64) (max float64) {
+	for _, v := range m {
+		max = math.Max(max, v)
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+func TestNewDrift(t *testing.T) {
+	belief := uuid.New()
+	behaviour1 := uuid.New()
+	behaviour2 := uuid.New()
+
+	reference := &OutputSpecs{Data: map[b.SimTime]OutputSpec{
+		1: {
+			MeanActivation:   map[uuid.UUID]float64{belief: 0.5},
+			MedianActivation: map[uuid.UUID]float64{belief: 0.25},
+			NPerformers:      map[uuid.UUID]uint64{behaviour1: 6, behaviour2: 4},
+		},
+	}}
+	other := &OutputSpecs{Data: map[b.SimTime]OutputSpec{
+		1: {
+			MeanActivation:   map[uuid.UUID]float64{belief: 0.25},
+			MedianActivation: map[uuid.UUID]float64{belief: 0.5},
+			NPerformers:      map[uuid.UUID]uint64{behaviour1: 4, behaviour2: 6},
+		},
+	}}
+
+	d := NewDrift(reference, other, 10)
+
+	if d.MaxMeanActivation() != 0.25 {
+		t.Errorf("MaxMeanActivation() should be 0.25; it was %f", d.MaxMeanActivation())
+	}
+
+	if d.MaxMedianActivation() != 0.25 {
+		t.Errorf("MaxMedianActivation() should be 0.25; it was %f", d.MaxMedianActivation())
+	}
+
+	if d.MaxBehaviourShare() != 0.2 {
+		t.Errorf("MaxBehaviourShare() should be 0.2; it was %f", d.MaxBehaviourShare())
+	}
+}
+
+func TestNewDriftWhenMissingValue(t *testing.T) {
+	behaviour := uuid.New()
+
+	reference := &OutputSpecs{Data: map[b.SimTime]OutputSpec{
+		1: {NPerformers: map[uuid.UUID]uint64{behaviour: 5}},
+	}}
+	other := &OutputSpecs{Data: map[b.SimTime]OutputSpec{
+		1: {NPerformers: map[uuid.UUID]uint64{}},
+	}}
+
+	d := NewDrift(reference, other, 10)
+
+	if d.MaxBehaviourShare() != 0.5 {
+		t.Errorf("MaxBehaviourShare() should be 0.5; it was %f", d.MaxBehaviourShare())
+	}
+}
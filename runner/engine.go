@@ -0,0 +1,172 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/0xr0bert/gobelief/dense"
+)
+
+// Engine is the storage engine used to run the simulation.
+type Engine int
+
+const (
+	// MapEngine stores the state of the simulation in the maps of each agent.
+	MapEngine Engine = iota
+	// DenseEngine stores the state of the simulation in flat slices, using a
+	// dense.Model.
+	//
+	// The maps of each agent are written to at every tick if there are
+	// Observers or FullOutput is set, and otherwise only at the end of the
+	// simulation.
+	DenseEngine
+)
+
+// String gets the name of the Engine.
+func (e Engine) String() string {
+	switch e {
+	case MapEngine:
+		return "map"
+	case DenseEngine:
+		return "dense"
+	default:
+		return fmt.Sprintf("Engine(%d)", int(e))
+	}
+}
+
+// ParseEngine gets the Engine with the specified name.
+func ParseEngine(name string) (Engine, error) {
+	switch name {
+	case "map":
+		return MapEngine, nil
+	case "dense":
+		return DenseEngine, nil
+	default:
+		return MapEngine, fmt.Errorf("unknown engine %q", name)
+	}
+}
+
+// Perform actions for all agents at the current time of a dense model, deriving
+// random numbers from seed.
+func performActionsDense(m *dense.Model, seed int64) {
+	values := make([]float64, len(m.Behaviours))
+	unnormalizedProbs := make([]probPair, len(m.Behaviours))
+
+	for i := 0; i < m.NAgents(); i++ {
+		m.Preferences(i, values)
+		for k, behaviour := range m.Behaviours {
+			unnormalizedProbs[k] = probPair{behaviour: behaviour, value: values[k]}
+		}
+		rv := behaviourRandom(seed, m.Agents[i].Uuid, m.Time())
+		m.SetAction(i, m.BehaviourIndex(chooseBehaviour(rv, unnormalizedProbs)))
+	}
+}
+
+// newOutputSpecFromModel calculates the summary statistics of the current state
+// of a dense model.
+//
+// This is equivalent to NewOutputSpecAtTime.
+func newOutputSpecFromModel(m *dense.Model) *OutputSpec {
+	o := NewOutputSpec()
+	nAgents := m.NAgents()
+
+	for j, belief := range m.Beliefs {
+		sum := newExactSum()
+		var nonzero uint64
+		found := false
+		acts := make([]float64, nAgents)
+
+		for i := 0; i < nAgents; i++ {
+			act, ok := m.Activation(i, j)
+			if ok {
+				found = true
+				sum.Add(act)
+				if act != 0.0 {
+					nonzero++
+				}
+			}
+			acts[i] = act
+		}
+
+		if found {
+			mean := sum.Float64() / float64(nAgents)
+			sd := newExactSum()
+			for i := 0; i < nAgents; i++ {
+				act, ok := m.Activation(i, j)
+				if ok {
+					sd.Add(math.Pow(act-mean, 2.0))
+				}
+			}
+			o.MeanActivation[belief.Uuid] = mean
+			o.SDActivation[belief.Uuid] = math.Sqrt(sd.Float64() / float64(nAgents-1))
+		}
+
+		if nonzero != 0 {
+			o.NonzeroActivationCount[belief.Uuid] = nonzero
+		}
+
+		if nAgents != 0 {
+			o.MedianActivation[belief.Uuid] = selectNth(acts, nAgents/2)
+		}
+	}
+
+	counts := make([]uint64, len(m.Behaviours))
+	for i := 0; i < nAgents; i++ {
+		action := m.Action(i)
+		if action >= 0 {
+			counts[action]++
+		}
+	}
+
+	for k, behaviour := range m.Behaviours {
+		if counts[k] != 0 {
+			o.NPerformers[behaviour.Uuid] = counts[k]
+		}
+	}
+
+	return o
+}
+
+// selectNth gets the value which would be at index n if values were sorted,
+// reordering values in place.
+func selectNth(values []float64, n int) float64 {
+	lo, hi := 0, len(values)-1
+	for lo < hi {
+		// Use the median of three as the pivot.
+		mid := lo + (hi-lo)/2
+		if values[mid] < values[lo] {
+			values[mid], values[lo] = values[lo], values[mid]
+		}
+		if values[hi] < values[lo] {
+			values[hi], values[lo] = values[lo], values[hi]
+		}
+		if values[hi] < values[mid] {
+			values[hi], values[mid] = values[mid], values[hi]
+		}
+		pivot := values[mid]
+
+		i, j := lo, hi
+		for i <= j {
+			for values[i] < pivot {
+				i++
+			}
+			for pivot < values[j] {
+				j--
+			}
+			if i <= j {
+				values[i], values[j] = values[j], values[i]
+				i++
+				j--
+			}
+		}
+
+		if n <= j {
+			hi = j
+		} else if n >= i {
+			lo = i
+		} else {
+			return values[n]
+		}
+	}
+	return values[n]
+}
@@ -0,0 +1,172 @@
+package runner
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// newRandomConfiguration creates a random simulation with the specified number
+// of agents, each with nFriends friends.
+//
+// Every value is a multiple of 1/8, so sums are exact regardless of the order
+// in which they are calculated, and every UUID and the Seed are derived from
+// the seed, so configurations created with the same seed are identical.
+func newRandomConfiguration(seed int64, nAgents, nFriends int) *Configuration {
+	rng := rand.New(rand.NewSource(seed))
+	value := func() float64 {
+		return float64(rng.Intn(17)-8) / 8.0
+	}
+
+	behaviours := []*b.Behaviour{
+		b.NewBehaviour("b1"),
+		b.NewBehaviour("b2"),
+		b.NewBehaviour("b3"),
+	}
+	beliefs := []*b.Belief{b.NewBelief("bel1"), b.NewBelief("bel2")}
+	prs := make(PerformanceRelationships)
+
+	for _, belief := range beliefs {
+		prs[belief] = make(map[*b.Behaviour]float64)
+		for _, behaviour := range behaviours {
+			belief.Perception[behaviour] = value()
+			prs[belief][behaviour] = value()
+		}
+		for _, belief2 := range beliefs {
+			belief.Relationship[belief2] = value()
+		}
+	}
+
+	agents := make([]*b.Agent, nAgents)
+	for i := range agents {
+		agents[i] = b.NewAgent()
+	}
+
+	for _, behaviour := range behaviours {
+		behaviour.Uuid = uuid.Must(uuid.NewRandomFromReader(rng))
+	}
+	for _, belief := range beliefs {
+		belief.Uuid = uuid.Must(uuid.NewRandomFromReader(rng))
+	}
+	for _, agent := range agents {
+		agent.Uuid = uuid.Must(uuid.NewRandomFromReader(rng))
+	}
+
+	for _, agent := range agents {
+		agent.Activations[0] = make(map[*b.Belief]float64)
+		for _, belief := range beliefs {
+			agent.Activations[0][belief] = value()
+			agent.Deltas[belief] = float64(rng.Intn(9)) / 8.0
+		}
+		for j := 0; j < nFriends; j++ {
+			agent.Friends[agents[rng.Intn(nAgents)]] = float64(rng.Intn(9)) / 8.0
+		}
+		agent.Actions[0] = behaviours[rng.Intn(len(behaviours))]
+	}
+
+	return &Configuration{
+		Behaviours: behaviours,
+		Beliefs:    beliefs,
+		Agents:     agents,
+		Prs:        prs,
+		StartTime:  1,
+		EndTime:    5,
+		Seed:       &seed,
+	}
+}
+
+func TestSelectNth(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 1; n < 50; n++ {
+		values := make([]float64, n)
+		for i := range values {
+			values[i] = float64(rng.Intn(10))
+		}
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+
+		for k := 0; k < n; k++ {
+			v := selectNth(append([]float64(nil), values...), k)
+			if v != sorted[k] {
+				t.Errorf("selectNth(%v, %d) should be %f; it was %f", values, k, sorted[k], v)
+			}
+		}
+	}
+}
+
+func TestDenseEngineMatchesMapEngine(t *testing.T) {
+	results := make([]*Result, 2)
+	configurations := make([]*Configuration, 2)
+
+	for i, engine := range []Engine{MapEngine, DenseEngine} {
+		configurations[i] = newRandomConfiguration(1, 200, 5)
+		configurations[i].Engine = engine
+		r := Runner{Configuration: configurations[i], Logger: zap.NewNop()}
+
+		res, err := r.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		results[i] = res
+	}
+
+	if !reflect.DeepEqual(results[0].Summary, results[1].Summary) {
+		t.Error("Summary of dense engine should match the map engine")
+	}
+
+	for i, agent := range configurations[0].Agents {
+		other := configurations[1].Agents[i]
+		if agent.Actions[5].Name != other.Actions[5].Name {
+			t.Errorf("Action of agent %d should match", i)
+		}
+		for j, belief := range configurations[0].Beliefs {
+			if agent.Activations[5][belief] != other.Activations[5][configurations[1].Beliefs[j]] {
+				t.Errorf("Activation of agent %d should match", i)
+			}
+		}
+	}
+}
+
+func TestParseEngine(t *testing.T) {
+	for _, engine := range []Engine{MapEngine, DenseEngine} {
+		parsed, err := ParseEngine(engine.String())
+		if err != nil || parsed != engine {
+			t.Errorf("ParseEngine(%q) should be %v; it was %v, %v", engine.String(), engine, parsed, err)
+		}
+	}
+
+	_, err := ParseEngine("unknown")
+	if err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func benchmarkEngine(bm *testing.B, engine Engine) {
+	for i := 0; i < bm.N; i++ {
+		bm.StopTimer()
+		c := newRandomConfiguration(1, 100000, 10)
+		c.EndTime = 20
+		c.Engine = engine
+		c.HistoryLength = 1
+		r := Runner{Configuration: c, Logger: zap.NewNop()}
+		bm.StartTimer()
+
+		_, err := r.Run()
+		if err != nil {
+			bm.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMapEngine(bm *testing.B) {
+	benchmarkEngine(bm, MapEngine)
+}
+
+func BenchmarkDenseEngine(bm *testing.B) {
+	benchmarkEngine(bm, DenseEngine)
+}
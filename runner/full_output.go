@@ -0,0 +1,192 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+// TickRange is the ticks from From to To inclusive.
+type TickRange struct {
+	From b.SimTime
+	To   b.SimTime
+}
+
+// Contains checks whether time is in the range.
+func (t TickRange) Contains(time b.SimTime) bool {
+	return t.From <= time && time <= t.To
+}
+
+// FullOutputFilter selects the part of a full output file which is read.
+type FullOutputFilter struct {
+	// The UUIDs of the agents to read, or nil to read every agent.
+	Agents []uuid.UUID
+	// The ticks whose activations and actions are read, or nil to read every
+	// tick.
+	Ticks []TickRange
+}
+
+// containsTick checks whether time is in any of the Ticks of the filter.
+func (f *FullOutputFilter) containsTick(time b.SimTime) bool {
+	for _, t := range f.Ticks {
+		if t.Contains(time) {
+			return true
+		}
+	}
+	return false
+}
+
+// FullOutputReader reads the AgentSpecs of a full output file one at a time,
+// so that the file does not need to be held in memory.
+//
+// Use it like a bufio.Scanner:
+//
+//	for reader.Next() {
+//		spec := reader.Spec()
+//		...
+//	}
+//	if err := reader.Err(); err != nil {
+//		...
+//	}
+type FullOutputReader struct {
+	zstdDecoder *zstd.Decoder
+	decoder     *json.Decoder
+	filter      FullOutputFilter
+	agents      map[uuid.UUID]bool
+	spec        *AgentSpec
+	err         error
+	done        bool
+}
+
+// NewFullOutputReader creates a reader for the zstd-compressed full output in
+// r, which only reads the agents and ticks selected by filter.
+//
+// The reader should be closed when it is no longer needed.
+func NewFullOutputReader(r io.Reader, filter FullOutputFilter) (*FullOutputReader, error) {
+	zstdDecoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &FullOutputReader{
+		zstdDecoder: zstdDecoder,
+		decoder:     json.NewDecoder(zstdDecoder),
+		filter:      filter,
+	}
+
+	if filter.Agents != nil {
+		reader.agents = make(map[uuid.UUID]bool, len(filter.Agents))
+		for _, u := range filter.Agents {
+			reader.agents[u] = true
+		}
+	}
+
+	token, err := reader.decoder.Token()
+	if err != nil {
+		zstdDecoder.Close()
+		return nil, err
+	}
+	if token != json.Delim('[') {
+		zstdDecoder.Close()
+		return nil, fmt.Errorf("expected an array of agents, found %v", token)
+	}
+
+	return reader, nil
+}
+
+// Next reads the next AgentSpec selected by the filter, returning false when
+// there are no more or there is an error.
+func (r *FullOutputReader) Next() bool {
+	r.spec = nil
+	if r.done {
+		return false
+	}
+
+	for r.decoder.More() {
+		spec := new(AgentSpec)
+		err := r.decoder.Decode(spec)
+		if err != nil {
+			r.err = err
+			r.done = true
+			return false
+		}
+
+		if r.agents != nil && !r.agents[spec.Uuid] {
+			continue
+		}
+
+		if r.filter.Ticks != nil {
+			for time := range spec.Activations {
+				if !r.filter.containsTick(time) {
+					delete(spec.Activations, time)
+				}
+			}
+			for time := range spec.Actions {
+				if !r.filter.containsTick(time) {
+					delete(spec.Actions, time)
+				}
+			}
+		}
+
+		r.spec = spec
+		return true
+	}
+
+	_, r.err = r.decoder.Token()
+	r.done = true
+	return false
+}
+
+// Spec gets the AgentSpec read by the last call to Next.
+func (r *FullOutputReader) Spec() *AgentSpec {
+	return r.spec
+}
+
+// Err gets the first error encountered by Next, if any.
+func (r *FullOutputReader) Err() error {
+	return r.err
+}
+
+// Close releases the resources of the reader.
+//
+// This does not close the underlying io.Reader.
+func (r *FullOutputReader) Close() {
+	r.zstdDecoder.Close()
+}
+
+// ReadFullOutputAgents rebuilds the agents selected by filter from the
+// zstd-compressed full output in r, in the order of the file.
+//
+// Only one AgentSpec is held in memory at a time. Friends which are not
+// selected by the filter, and references to unknown behaviours and beliefs,
+// are ignored.
+func ReadFullOutputAgents(
+	r io.Reader,
+	filter FullOutputFilter,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+) ([]*b.Agent, error) {
+	reader, err := NewFullOutputReader(r, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return linkAgentSpecs(
+		func(f func(*AgentSpec) error) error {
+			for reader.Next() {
+				err := f(reader.Spec())
+				if err != nil {
+					return err
+				}
+			}
+			return reader.Err()
+		},
+		newAgentLookup(behaviours, beliefs),
+		nil,
+	)
+}
@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+// newTestFullOutput writes the full output of three friends who hold a belief
+// and perform a behaviour at ticks 0 to 4.
+func newTestFullOutput(t *testing.T) (*bytes.Buffer, *b.Behaviour, *b.Belief, []*b.Agent) {
+	t.Helper()
+
+	behaviour := b.NewBehaviour("behaviour")
+	belief := b.NewBelief("belief")
+
+	agents := make([]*b.Agent, 3)
+	for i := range agents {
+		agents[i] = b.NewAgent()
+		for time := b.SimTime(0); time < 5; time++ {
+			agents[i].Activations[time] = map[*b.Belief]float64{belief: float64(time) / 10}
+			agents[i].Actions[time] = behaviour
+		}
+		agents[i].Deltas[belief] = 1.1
+	}
+	agents[0].Friends[agents[1]] = 0.5
+	agents[0].Friends[agents[2]] = 0.25
+	agents[2].Friends[agents[0]] = 1
+
+	var buf bytes.Buffer
+	err := writeAgentSpecs(&buf, agents, NewAgentSpecFromAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &buf, behaviour, belief, agents
+}
+
+func TestFullOutputReaderFiltersAgentsAndTicks(t *testing.T) {
+	buf, _, belief, agents := newTestFullOutput(t)
+
+	reader, err := NewFullOutputReader(buf, FullOutputFilter{
+		Agents: []uuid.UUID{agents[0].Uuid, agents[2].Uuid},
+		Ticks:  []TickRange{{From: 1, To: 1}, {From: 3, To: 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var read []uuid.UUID
+	for reader.Next() {
+		spec := reader.Spec()
+		read = append(read, spec.Uuid)
+
+		var times []b.SimTime
+		for time := range spec.Activations {
+			times = append(times, time)
+		}
+		sortTimes(times)
+		if !reflect.DeepEqual(times, []b.SimTime{1, 3, 4}) {
+			t.Errorf("Expected activations at ticks 1, 3 and 4, got %v", times)
+		}
+		if len(spec.Actions) != 3 {
+			t.Errorf("Expected 3 actions, got %d", len(spec.Actions))
+		}
+		if spec.Deltas[belief.Uuid] != 1.1 {
+			t.Errorf("Expected the delta to be read, got %v", spec.Deltas)
+		}
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, []uuid.UUID{agents[0].Uuid, agents[2].Uuid}) {
+		t.Errorf("Unexpected agents %v", read)
+	}
+	if reader.Next() {
+		t.Error("Next should return false after the end of the file")
+	}
+}
+
+func TestReadFullOutputAgentsRebuildsSelectedAgents(t *testing.T) {
+	buf, behaviour, belief, agents := newTestFullOutput(t)
+
+	rebuilt, err := ReadFullOutputAgents(
+		buf,
+		FullOutputFilter{Agents: []uuid.UUID{agents[0].Uuid, agents[2].Uuid}},
+		[]*b.Behaviour{behaviour},
+		[]*b.Belief{belief},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rebuilt) != 2 || rebuilt[0].Uuid != agents[0].Uuid || rebuilt[1].Uuid != agents[2].Uuid {
+		t.Fatalf("Unexpected agents %v", rebuilt)
+	}
+	if !reflect.DeepEqual(rebuilt[0].Friends, map[*b.Agent]float64{rebuilt[1]: 0.25}) {
+		t.Errorf("Friends which are not selected should be removed, got %v", rebuilt[0].Friends)
+	}
+	if rebuilt[1].Friends[rebuilt[0]] != 1 {
+		t.Errorf("Unexpected friends %v", rebuilt[1].Friends)
+	}
+	if rebuilt[0].Activations[4][belief] != 0.4 || rebuilt[0].Actions[4] != behaviour {
+		t.Errorf("Unexpected state %v %v", rebuilt[0].Activations, rebuilt[0].Actions)
+	}
+}
@@ -0,0 +1,94 @@
+// Package shardrpc defines the messages exchanged between the coordinator and
+// the workers of a sharded simulation.
+//
+// The messages are sent with net/rpc, which requires them to be exported.
+package shardrpc
+
+import (
+	"github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+// The name of the service each worker serves.
+const ServiceName = "Shard"
+
+// Empty is an empty argument or reply.
+type Empty struct{}
+
+// SetupArgs defines the scenario of a shard, and which agents it simulates.
+type SetupArgs struct {
+	// The behaviours, beliefs and performance relationships, encoded as JSON
+	// in the same form as the input files.
+	Behaviours []byte
+	Beliefs    []byte
+	Prs        []byte
+	// The time of the initial state of the agents.
+	Time beliefspread.SimTime
+	// The seed from which random numbers are derived.
+	Seed int64
+	// The dense.Precision of the state of the shard.
+	Precision int
+	// The agents simulated by the shard.
+	Agents []uuid.UUID
+	// The agents simulated by other shards which are friends of the agents
+	// of the shard.
+	Ghosts []uuid.UUID
+	// The agents of the shard which are ghosts of other shards, whose actions
+	// are sent to the coordinator at every tick.
+	Exports []uuid.UUID
+}
+
+// AddAgentsArgs are the agents of the shard, encoded as JSON AgentSpecs.
+type AddAgentsArgs struct {
+	Agents [][]byte
+}
+
+// StepArgs are the arguments of a tick.
+type StepArgs struct {
+	// The time of the tick.
+	Time beliefspread.SimTime
+	// The actions of the ghosts at the previous tick, in the order of
+	// SetupArgs.Ghosts.
+	GhostActions []int32
+}
+
+// StepReply is the result of a tick.
+type StepReply struct {
+	// The actions of the exported agents, in the order of SetupArgs.Exports.
+	Exports []int32
+	// The number of agents which failed to update, and the first error.
+	Failed uint64
+	Error  string
+	// The exact sum of the activations of each belief, as the limbs of an
+	// exact sum.
+	Sums [][]int64
+	// Whether any agent has an activation for each belief.
+	Found []bool
+	// The number of agents with non-zero activation for each belief.
+	Nonzero []uint64
+	// The number of agents performing each behaviour.
+	Performers []uint64
+}
+
+// DeviationsArgs are the mean activations of each belief.
+type DeviationsArgs struct {
+	Means []float64
+}
+
+// DeviationsReply is the exact sum of the squared deviations of the
+// activations of each belief from the mean.
+type DeviationsReply struct {
+	Sums [][]int64
+}
+
+// CountArgs are the thresholds of the search for the median activation of each
+// belief, as order-preserving keys of the activations.
+type CountArgs struct {
+	Thresholds []uint64
+}
+
+// CountReply is the number of agents whose activation of each belief is no
+// greater than the threshold.
+type CountReply struct {
+	Counts []uint64
+}
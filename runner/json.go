@@ -1,11 +1,17 @@
 package runner
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"math"
 	"sort"
 
 	b "github.com/0xr0bert/gobelief/beliefspread"
 	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
 )
 
 type BehaviourSpec struct {
@@ -27,6 +33,20 @@ type BeliefSpec struct {
 }
 
 func (spec *BeliefSpec) ToBelief(behaviours []*b.Behaviour) *b.Belief {
+	return spec.toBelief(behaviours, nil)
+}
+
+// ToBeliefStrict is ToBelief, but returns an *UnresolvedReferencesError if any
+// perception is of an unknown behaviour.
+func (spec *BeliefSpec) ToBeliefStrict(behaviours []*b.Behaviour) (*b.Belief, error) {
+	refs := new(UnresolvedReferencesError)
+	belief := spec.toBelief(behaviours, refs)
+	return belief, refs.orNil()
+}
+
+// toBelief converts the spec, adding any unresolved references to refs, which
+// may be nil.
+func (spec *BeliefSpec) toBelief(behaviours []*b.Behaviour, refs *UnresolvedReferencesError) *b.Belief {
 	belief := b.NewBelief(spec.Name)
 	belief.Uuid = spec.Uuid
 
@@ -37,10 +57,32 @@ func (spec *BeliefSpec) ToBelief(behaviours []*b.Behaviour) *b.Belief {
 		}
 	}
 
+	if refs != nil && len(belief.Perception) != len(spec.Perceptions) {
+		for _, u := range sortedUuids(spec.Perceptions) {
+			if !hasBehaviour(behaviours, u) {
+				refs.add(spec.holder(), "perceptions", "behaviour", u)
+			}
+		}
+	}
+
 	return belief
 }
 
 func (spec *BeliefSpec) LinkBeliefRelationships(beliefs []*b.Belief) {
+	spec.linkBeliefRelationships(beliefs, nil)
+}
+
+// LinkBeliefRelationshipsStrict is LinkBeliefRelationships, but returns an
+// *UnresolvedReferencesError if the belief or any related belief is unknown.
+func (spec *BeliefSpec) LinkBeliefRelationshipsStrict(beliefs []*b.Belief) error {
+	refs := new(UnresolvedReferencesError)
+	spec.linkBeliefRelationships(beliefs, refs)
+	return refs.orNil()
+}
+
+// linkBeliefRelationships links the relationships, adding any unresolved
+// references to refs, which may be nil.
+func (spec *BeliefSpec) linkBeliefRelationships(beliefs []*b.Belief, refs *UnresolvedReferencesError) {
 	uuidBeliefs := make(map[uuid.UUID]*b.Belief)
 	for _, belief := range beliefs {
 		uuidBeliefs[belief.Uuid] = belief
@@ -49,6 +91,7 @@ func (spec *BeliefSpec) LinkBeliefRelationships(beliefs []*b.Belief) {
 	thisBelief := uuidBeliefs[spec.Uuid]
 
 	if thisBelief == nil {
+		refs.add(spec.holder(), "uuid", "belief", spec.Uuid)
 		return
 	}
 
@@ -58,6 +101,29 @@ func (spec *BeliefSpec) LinkBeliefRelationships(beliefs []*b.Belief) {
 			thisBelief.Relationship[b2] = v
 		}
 	}
+
+	if refs != nil && len(thisBelief.Relationship) != len(spec.Relationships) {
+		for _, u := range sortedUuids(spec.Relationships) {
+			if uuidBeliefs[u] == nil {
+				refs.add(spec.holder(), "relationships", "belief", u)
+			}
+		}
+	}
+}
+
+// holder describes the belief as the holder of an UnresolvedReference.
+func (spec *BeliefSpec) holder() string {
+	return fmt.Sprintf("belief %q (%v)", spec.Name, spec.Uuid)
+}
+
+// hasBehaviour gets whether any of behaviours has the UUID u.
+func hasBehaviour(behaviours []*b.Behaviour, u uuid.UUID) bool {
+	for _, behaviour := range behaviours {
+		if behaviour.Uuid == u {
+			return true
+		}
+	}
+	return false
 }
 
 type PerformanceRelationshipSpec struct {
@@ -107,17 +173,72 @@ func NewAgentSpecFromAgent(a *b.Agent) (spec *AgentSpec) {
 	return
 }
 
+// newAgentSpecAtTime creates the AgentSpec of an agent with only its
+// activations and action at the specified time.
+func newAgentSpecAtTime(a *b.Agent, time b.SimTime) *AgentSpec {
+	spec := NewAgentSpecFromAgent(a)
+	for t := range spec.Actions {
+		if t != time {
+			delete(spec.Actions, t)
+		}
+	}
+	for t := range spec.Activations {
+		if t != time {
+			delete(spec.Activations, t)
+		}
+	}
+	return spec
+}
+
 func (spec *AgentSpec) ToAgent(
 	behaviours []*b.Behaviour,
 	beliefs []*b.Belief,
 ) *b.Agent {
-	a := b.NewAgent()
-	a.Uuid = spec.Uuid
+	return spec.toAgent(newAgentLookup(behaviours, beliefs), nil)
+}
+
+// ToAgentStrict is ToAgent, but returns an *UnresolvedReferencesError if any
+// action is of an unknown behaviour, or any activation or delta is of an
+// unknown belief.
+func (spec *AgentSpec) ToAgentStrict(
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+) (*b.Agent, error) {
+	refs := new(UnresolvedReferencesError)
+	a := spec.toAgent(newAgentLookup(behaviours, beliefs), refs)
+	return a, refs.orNil()
+}
+
+// agentLookup finds the behaviours and beliefs referred to by AgentSpecs by
+// UUID.
+//
+// This is built once, rather than for every AgentSpec converted.
+type agentLookup struct {
+	behaviours map[uuid.UUID]*b.Behaviour
+	beliefs    map[uuid.UUID]*b.Belief
+}
 
-	uuidBehaviours := make(map[uuid.UUID]*b.Behaviour)
+func newAgentLookup(behaviours []*b.Behaviour, beliefs []*b.Belief) *agentLookup {
+	lookup := &agentLookup{
+		behaviours: make(map[uuid.UUID]*b.Behaviour, len(behaviours)),
+		beliefs:    make(map[uuid.UUID]*b.Belief, len(beliefs)),
+	}
 	for _, behaviour := range behaviours {
-		uuidBehaviours[behaviour.Uuid] = behaviour
+		lookup.behaviours[behaviour.Uuid] = behaviour
+	}
+	for _, belief := range beliefs {
+		lookup.beliefs[belief.Uuid] = belief
 	}
+	return lookup
+}
+
+// toAgent converts the spec, adding any unresolved references to refs, which
+// may be nil.
+func (spec *AgentSpec) toAgent(lookup *agentLookup, refs *UnresolvedReferencesError) *b.Agent {
+	a := b.NewAgent()
+	a.Uuid = spec.Uuid
+
+	uuidBehaviours := lookup.behaviours
 
 	for time, actionUuid := range spec.Actions {
 		action := uuidBehaviours[actionUuid]
@@ -126,11 +247,22 @@ func (spec *AgentSpec) ToAgent(
 		}
 	}
 
-	uuidBeliefs := make(map[uuid.UUID]*b.Belief)
-	for _, belief := range beliefs {
-		uuidBeliefs[belief.Uuid] = belief
+	if refs != nil && len(a.Actions) != len(spec.Actions) {
+		times := make([]b.SimTime, 0, len(spec.Actions))
+		for time := range spec.Actions {
+			times = append(times, time)
+		}
+		sortTimes(times)
+		for _, time := range times {
+			if uuidBehaviours[spec.Actions[time]] == nil {
+				refs.add(spec.holder(), fmt.Sprintf("actions at %d", time), "behaviour", spec.Actions[time])
+			}
+		}
 	}
 
+	uuidBeliefs := lookup.beliefs
+
+	unresolvedActivations := false
 	for time, acts := range spec.Activations {
 		a.Activations[time] = make(map[*b.Belief]float64)
 		for beliefUuid, act := range acts {
@@ -139,6 +271,24 @@ func (spec *AgentSpec) ToAgent(
 				a.Activations[time][belief] = act
 			}
 		}
+		if len(a.Activations[time]) != len(acts) {
+			unresolvedActivations = true
+		}
+	}
+
+	if refs != nil && unresolvedActivations {
+		times := make([]b.SimTime, 0, len(spec.Activations))
+		for time := range spec.Activations {
+			times = append(times, time)
+		}
+		sortTimes(times)
+		for _, time := range times {
+			for _, u := range sortedUuids(spec.Activations[time]) {
+				if uuidBeliefs[u] == nil {
+					refs.add(spec.holder(), fmt.Sprintf("activations at %d", time), "belief", u)
+				}
+			}
+		}
 	}
 
 	for beliefUuid, value := range spec.Deltas {
@@ -148,21 +298,59 @@ func (spec *AgentSpec) ToAgent(
 		}
 	}
 
+	if refs != nil && len(a.Deltas) != len(spec.Deltas) {
+		for _, u := range sortedUuids(spec.Deltas) {
+			if uuidBeliefs[u] == nil {
+				refs.add(spec.holder(), "deltas", "belief", u)
+			}
+		}
+	}
+
 	return a
 }
 
 func (spec *AgentSpec) LinkFriends(agents map[uuid.UUID]*b.Agent) {
+	spec.linkFriends(agents, nil)
+}
+
+// LinkFriendsStrict is LinkFriends, but returns an
+// *UnresolvedReferencesError if the agent or any friend is not in agents.
+func (spec *AgentSpec) LinkFriendsStrict(agents map[uuid.UUID]*b.Agent) error {
+	refs := new(UnresolvedReferencesError)
+	spec.linkFriends(agents, refs)
+	return refs.orNil()
+}
+
+// linkFriends links the friends, adding any unresolved references to refs,
+// which may be nil.
+func (spec *AgentSpec) linkFriends(agents map[uuid.UUID]*b.Agent, refs *UnresolvedReferencesError) {
 	thisAgent := agents[spec.Uuid]
-	if thisAgent != nil {
-		for friendUuid, w := range spec.Friends {
-			friend := agents[friendUuid]
-			if friend != nil {
-				thisAgent.Friends[friend] = w
+	if thisAgent == nil {
+		refs.add(spec.holder(), "uuid", "agent", spec.Uuid)
+		return
+	}
+
+	for friendUuid, w := range spec.Friends {
+		friend := agents[friendUuid]
+		if friend != nil {
+			thisAgent.Friends[friend] = w
+		}
+	}
+
+	if refs != nil && len(thisAgent.Friends) != len(spec.Friends) {
+		for _, u := range sortedUuids(spec.Friends) {
+			if agents[u] == nil {
+				refs.add(spec.holder(), "friends", "agent", u)
 			}
 		}
 	}
 }
 
+// holder describes the agent as the holder of an UnresolvedReference.
+func (spec *AgentSpec) holder() string {
+	return fmt.Sprintf("agent %v", spec.Uuid)
+}
+
 type OutputSpec struct {
 	MeanActivation         map[uuid.UUID]float64 `json:"meanActivation"`
 	SDActivation           map[uuid.UUID]float64 `json:"sdActivation"`
@@ -183,7 +371,15 @@ func NewOutputSpec() *OutputSpec {
 }
 
 type OutputSpecs struct {
-	Data map[b.SimTime]OutputSpec `json:"data"`
+	// The seed of the random number generator used to choose behaviours.
+	Seed int64 `json:"seed"`
+	// Whether the simulation was cancelled before its end time.
+	Truncated bool `json:"truncated"`
+	// The last tick which was completed.
+	LastTick b.SimTime `json:"lastTick"`
+	// Why the simulation stopped.
+	StopReason StopReason               `json:"stopReason"`
+	Data       map[b.SimTime]OutputSpec `json:"data"`
 }
 
 func NewOutputSpecs(
@@ -195,75 +391,310 @@ func NewOutputSpecs(
 	data := make(map[b.SimTime]OutputSpec, endTime-startTime+1)
 
 	for time := startTime; time <= endTime; time++ {
-		o := NewOutputSpec()
+		data[time] = *NewOutputSpecAtTime(agents, beliefs, time)
+	}
+
+	return &OutputSpecs{
+		LastTick:   endTime,
+		StopReason: StopReasonCompleted,
+		Data:       data,
+	}
+}
 
-		// Calculate mean activation
-		for _, agent := range agents {
-			acts := agent.Activations[time]
-			for belief, act := range acts {
-				o.MeanActivation[belief.Uuid] += act
+// NewOutputSpecAtTime calculates the summary statistics of the agents at a
+// single time.
+//
+// This only needs the activations and actions of the agents at that time, so
+// it can be calculated as the simulation runs.
+func NewOutputSpecAtTime(
+	agents []*b.Agent,
+	beliefs []*b.Belief,
+	time b.SimTime,
+) *OutputSpec {
+	o := NewOutputSpec()
+
+	// Calculate mean activation, summing exactly so the mean doesn't depend
+	// on the order of the agents
+	sums := make(map[uuid.UUID]*exactSum)
+	for _, agent := range agents {
+		acts := agent.Activations[time]
+		for belief, act := range acts {
+			sum, found := sums[belief.Uuid]
+			if !found {
+				sum = newExactSum()
+				sums[belief.Uuid] = sum
 			}
+			sum.Add(act)
 		}
+	}
 
-		nAgents := len(agents)
-		for u := range o.MeanActivation {
-			o.MeanActivation[u] /= float64(nAgents)
+	nAgents := len(agents)
+	for u, sum := range sums {
+		o.MeanActivation[u] = sum.Float64() / float64(nAgents)
+	}
+
+	// Calculate sd activation
+	for _, sum := range sums {
+		*sum = *newExactSum()
+	}
+	for _, agent := range agents {
+		acts := agent.Activations[time]
+		for belief, act := range acts {
+			sums[belief.Uuid].Add(math.Pow(
+				act-o.MeanActivation[belief.Uuid],
+				2.0,
+			))
 		}
+	}
 
-		// Calculate sd activation
-		for _, agent := range agents {
-			acts := agent.Activations[time]
-			for belief, act := range acts {
-				o.SDActivation[belief.Uuid] += math.Pow(
-					act-o.MeanActivation[belief.Uuid],
-					2.0,
-				)
+	for u, sum := range sums {
+		o.SDActivation[u] = math.Sqrt(sum.Float64() / float64(nAgents-1))
+	}
+
+	// Calculate median activation
+	activationsByUuid := make(map[uuid.UUID][]float64)
+
+	for i, agent := range agents {
+		for _, belief := range beliefs {
+			_, found := activationsByUuid[belief.Uuid]
+			if !found {
+				activationsByUuid[belief.Uuid] = make([]float64, nAgents)
 			}
+			activationsByUuid[belief.Uuid][i] = agent.Activations[time][belief]
 		}
+	}
 
-		for u, sd := range o.SDActivation {
-			o.SDActivation[u] = math.Sqrt(sd / float64(nAgents-1))
-		}
+	middleIndex := nAgents / 2
 
-		// Calculate median activation
-		activationsByUuid := make(map[uuid.UUID][]float64)
+	for u, acts := range activationsByUuid {
+		sort.Float64s(acts)
+		o.MedianActivation[u] = acts[middleIndex]
+	}
 
-		for i, agent := range agents {
-			for _, belief := range beliefs {
-				_, found := activationsByUuid[belief.Uuid]
-				if !found {
-					activationsByUuid[belief.Uuid] = make([]float64, nAgents)
-				}
-				activationsByUuid[belief.Uuid][i] = agent.Activations[time][belief]
+	// Calculate non zero activation count
+	for _, agent := range agents {
+		for belief, activation := range agent.Activations[time] {
+			if activation != 0.0 {
+				o.NonzeroActivationCount[belief.Uuid]++
 			}
 		}
+	}
+
+	// Calculate n performers
+	for _, agent := range agents {
+		action := agent.Actions[time]
+		if action != nil {
+			o.NPerformers[action.Uuid]++
+		}
+	}
+
+	return o
+}
 
-		middleIndex := nAgents / 2
+// DecodeAgentSpecs decodes a JSON array of AgentSpecs from r, calling f with
+// each AgentSpec as it is decoded.
+//
+// Only one AgentSpec is held in memory at a time, so this can read arrays
+// which are too large to unmarshal at once. Decoding stops at the first error,
+// including any error returned by f.
+func DecodeAgentSpecs(r io.Reader, f func(*AgentSpec) error) error {
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != json.Delim('[') {
+		return fmt.Errorf("expected an array of agents, found %v", token)
+	}
 
-		for u, acts := range activationsByUuid {
-			sort.Float64s(acts)
-			o.MedianActivation[u] = acts[middleIndex]
+	for decoder.More() {
+		spec := new(AgentSpec)
+		err = decoder.Decode(spec)
+		if err != nil {
+			return err
+		}
+		err = f(spec)
+		if err != nil {
+			return err
 		}
+	}
 
-		// Calculate non zero activation count
-		for _, agent := range agents {
-			for belief, activation := range agent.Activations[time] {
-				if activation != 0.0 {
-					o.NonzeroActivationCount[belief.Uuid]++
-				}
-			}
+	_, err = decoder.Token()
+	return err
+}
+
+// DecodeAgents decodes a JSON array of AgentSpecs from r, converting each to
+// an agent and linking its friends as it is decoded.
+//
+// This is equivalent to unmarshalling the array, then calling ToAgent and
+// LinkFriends on every AgentSpec, but only one AgentSpec is held in memory at
+// a time. Agents are returned in the order of the array.
+//
+// If strict, references to unknown behaviours, beliefs and friends are an
+// *UnresolvedReferencesError listing all of them. Otherwise, they are
+// ignored.
+func DecodeAgents(
+	r io.Reader,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	strict bool,
+) ([]*b.Agent, error) {
+	return decodeAgents(
+		func(f func(*AgentSpec) error) error { return DecodeAgentSpecs(r, f) },
+		behaviours,
+		beliefs,
+		strict,
+	)
+}
+
+// ReadAgents is DecodeAgents for an agents file in any of the formats read by
+// ReadAgentSpecs.
+func ReadAgents(
+	r io.Reader,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	strict bool,
+) ([]*b.Agent, error) {
+	return decodeAgents(
+		func(f func(*AgentSpec) error) error { return ReadAgentSpecs(r, f) },
+		behaviours,
+		beliefs,
+		strict,
+	)
+}
+
+func decodeAgents(
+	specs func(f func(*AgentSpec) error) error,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	strict bool,
+) ([]*b.Agent, error) {
+	var refs *UnresolvedReferencesError
+	if strict {
+		refs = new(UnresolvedReferencesError)
+	}
+
+	agents, err := linkAgentSpecs(specs, newAgentLookup(behaviours, beliefs), refs)
+	if err != nil {
+		return nil, err
+	}
+
+	if refs != nil {
+		if err := refs.orNil(); err != nil {
+			return nil, err
 		}
+	}
+
+	return agents, nil
+}
 
-		// Calculate n performers
-		for _, agent := range agents {
-			action := agent.Actions[time]
-			if action != nil {
-				o.NPerformers[action.Uuid]++
+// The magic number at the start of a zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// The continuation marker at the start of each message of an Arrow IPC
+// stream.
+var arrowContinuation = []byte{0xff, 0xff, 0xff, 0xff}
+
+// ReadAgentSpecs reads the AgentSpecs of an agents file from r, calling f with
+// each AgentSpec as it is read.
+//
+// The file is either a zstd-compressed JSON array of AgentSpecs, or an Arrow
+// IPC file or stream read by DecodeArrowAgentSpecs, which is detected from its
+// first bytes. Only one AgentSpec, or Arrow record batch, is held in memory at
+// a time.
+func ReadAgentSpecs(r io.Reader, f func(*AgentSpec) error) error {
+	buffered := bufio.NewReader(r)
+
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil {
+		return fmt.Errorf("failed to detect the format of the agents file: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer decoder.Close()
+
+		return DecodeAgentSpecs(decoder, f)
+	case bytes.Equal(magic, []byte(arrowFileMagic[:len(magic)])), bytes.Equal(magic, arrowContinuation):
+		return DecodeArrowAgentSpecs(buffered, f)
+	default:
+		return fmt.Errorf("the agents file is neither zstd-compressed JSON nor Arrow IPC")
+	}
+}
+
+// linkAgentSpecs converts every AgentSpec which specs calls f with to an agent,
+// linking its friends as it is converted, and adding any unresolved references
+// to refs, which may be nil.
+//
+// Friends which are not converted are removed.
+func linkAgentSpecs(
+	specs func(f func(*AgentSpec) error) error,
+	lookup *agentLookup,
+	refs *UnresolvedReferencesError,
+) ([]*b.Agent, error) {
+	var agents []*b.Agent
+	uuidAgents := make(map[uuid.UUID]*b.Agent)
+
+	// Friends which are referred to before they are converted are linked to a
+	// placeholder, which is filled in when the friend is converted.
+	placeholders := make(map[uuid.UUID]*b.Agent)
+
+	err := specs(func(spec *AgentSpec) error {
+		a := spec.toAgent(lookup, refs)
+
+		if placeholder, ok := placeholders[spec.Uuid]; ok {
+			*placeholder = *a
+			a = placeholder
+			delete(placeholders, spec.Uuid)
+		}
+
+		agents = append(agents, a)
+		uuidAgents[spec.Uuid] = a
+
+		for friendUuid, w := range spec.Friends {
+			friend := uuidAgents[friendUuid]
+			if friend == nil {
+				friend = &b.Agent{Uuid: friendUuid}
+				placeholders[friendUuid] = friend
+				uuidAgents[friendUuid] = friend
 			}
+			a.Friends[friend] = w
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Any remaining placeholders are friends which were never converted.
+	if len(placeholders) != 0 {
+		undefined := make(map[*b.Agent]bool, len(placeholders))
+		for _, placeholder := range placeholders {
+			undefined[placeholder] = true
 		}
 
-		data[time] = *o
+		for _, a := range agents {
+			var unresolved map[uuid.UUID]bool
+			for friend := range a.Friends {
+				if undefined[friend] {
+					if unresolved == nil {
+						unresolved = make(map[uuid.UUID]bool)
+					}
+					unresolved[friend.Uuid] = true
+					delete(a.Friends, friend)
+				}
+			}
+			for _, u := range sortedUuids(unresolved) {
+				refs.add(fmt.Sprintf("agent %v", a.Uuid), "friends", "agent", u)
+			}
+		}
 	}
 
-	return &OutputSpecs{Data: data}
+	return agents, nil
 }
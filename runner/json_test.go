@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+func TestDecodeAgentsLinksFriendsInEitherOrder(t *testing.T) {
+	behaviour := b.NewBehaviour("behaviour")
+	belief := b.NewBelief("belief")
+	uuids := []uuid.UUID{
+		uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+		uuid.MustParse("00000000-0000-0000-0000-000000000003"),
+	}
+	unknown := uuid.MustParse("00000000-0000-0000-0000-000000000009")
+
+	// The first agent refers to the second before it is decoded, and the
+	// second refers back to the first.
+	specs := []AgentSpec{
+		{
+			Uuid:        uuids[0],
+			Actions:     map[b.SimTime]uuid.UUID{0: behaviour.Uuid},
+			Activations: map[b.SimTime]map[uuid.UUID]float64{0: {belief.Uuid: 0.5}},
+			Deltas:      map[uuid.UUID]float64{belief.Uuid: 1.1},
+			Friends:     map[uuid.UUID]float64{uuids[1]: 0.5, unknown: 1},
+		},
+		{
+			Uuid:    uuids[1],
+			Friends: map[uuid.UUID]float64{uuids[0]: 0.25},
+		},
+		{
+			Uuid:    uuids[2],
+			Friends: map[uuid.UUID]float64{uuids[0]: 1, uuids[1]: 0.75},
+		},
+	}
+	data, err := json.Marshal(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	behaviours := []*b.Behaviour{behaviour}
+	beliefs := []*b.Belief{belief}
+
+	agents, err := DecodeAgents(bytes.NewReader(data), behaviours, beliefs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]*b.Agent, len(specs))
+	uuidAgents := make(map[uuid.UUID]*b.Agent)
+	for i := range specs {
+		expected[i] = specs[i].ToAgent(behaviours, beliefs)
+		uuidAgents[expected[i].Uuid] = expected[i]
+	}
+	for i := range specs {
+		specs[i].LinkFriends(uuidAgents)
+	}
+
+	if len(agents) != len(expected) {
+		t.Fatalf("Expected %d agents, got %d", len(expected), len(agents))
+	}
+	for i := range agents {
+		got := NewAgentSpecFromAgent(agents[i])
+		want := NewAgentSpecFromAgent(expected[i])
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Agent %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if _, ok := agents[0].Friends[agents[1]]; !ok {
+		t.Error("A friend decoded later should be linked to the decoded agent")
+	}
+
+	_, err = DecodeAgents(bytes.NewReader(data), behaviours, beliefs, true)
+	var refs *UnresolvedReferencesError
+	expectedRef := UnresolvedReference{
+		Holder: "agent " + uuids[0].String(),
+		Field:  "friends",
+		Kind:   "agent",
+		Uuid:   unknown,
+	}
+	if !errors.As(err, &refs) || !reflect.DeepEqual(refs.References, []UnresolvedReference{expectedRef}) {
+		t.Errorf("Unexpected unresolved references %v", err)
+	}
+}
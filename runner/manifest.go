@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes a scenario, and how it is run, in a single JSON or YAML
+// file, so it can be versioned and shared as one unit.
+//
+// Every field is optional. Paths are relative to the directory of the
+// manifest. The flag tag of each field is the name of the command line flag
+// it corresponds to, which overrides it.
+type Manifest struct {
+	// The input files of the scenario.
+	Behaviours string `json:"behaviours,omitempty" yaml:"behaviours,omitempty" flag:"behaviours"`
+	Beliefs    string `json:"beliefs,omitempty" yaml:"beliefs,omitempty" flag:"beliefs"`
+	Agents     string `json:"agents,omitempty" yaml:"agents,omitempty" flag:"agents"`
+	Prs        string `json:"prs,omitempty" yaml:"prs,omitempty" flag:"prs"`
+	// Whether references to unknown behaviours, beliefs and agents are
+	// ignored, rather than an error.
+	AllowUnresolved *bool `json:"allowUnresolved,omitempty" yaml:"allowUnresolved,omitempty" flag:"allow-unresolved"`
+
+	// The network of friends attached to the agents, and how it is read.
+	Network              string `json:"network,omitempty" yaml:"network,omitempty" flag:"network"`
+	NetworkFormat        string `json:"networkFormat,omitempty" yaml:"networkFormat,omitempty" flag:"network-format"`
+	NetworkIds           string `json:"networkIds,omitempty" yaml:"networkIds,omitempty" flag:"network-ids"`
+	NetworkIdColumn      string `json:"networkIdColumn,omitempty" yaml:"networkIdColumn,omitempty" flag:"network-id-column"`
+	NetworkUuidAttribute string `json:"networkUuidAttribute,omitempty" yaml:"networkUuidAttribute,omitempty" flag:"network-uuid-attribute"`
+	NetworkWeight        string `json:"networkWeight,omitempty" yaml:"networkWeight,omitempty" flag:"network-weight"`
+	NetworkWeights       string `json:"networkWeights,omitempty" yaml:"networkWeights,omitempty" flag:"network-weights"`
+	NetworkSymmetrise    *bool  `json:"networkSymmetrise,omitempty" yaml:"networkSymmetrise,omitempty" flag:"network-symmetrise"`
+	NetworkReplace       *bool  `json:"networkReplace,omitempty" yaml:"networkReplace,omitempty" flag:"network-replace"`
+
+	// The start and end times of the simulation.
+	Start *uint32 `json:"start,omitempty" yaml:"start,omitempty" flag:"start"`
+	End   *uint32 `json:"end,omitempty" yaml:"end,omitempty" flag:"end"`
+
+	// The options of a run.
+	Output               string    `json:"output,omitempty" yaml:"output,omitempty" flag:"output"`
+	OutputFormat         string    `json:"outputFormat,omitempty" yaml:"outputFormat,omitempty" flag:"output-format"`
+	ActionsOutput        string    `json:"actionsOutput,omitempty" yaml:"actionsOutput,omitempty" flag:"actions-output"`
+	RunLabel             string    `json:"runLabel,omitempty" yaml:"runLabel,omitempty" flag:"run-label"`
+	Full                 *bool     `json:"full,omitempty" yaml:"full,omitempty" flag:"full"`
+	BurnIn               *uint32   `json:"burnIn,omitempty" yaml:"burnIn,omitempty" flag:"burn-in"`
+	BurnInState          string    `json:"burnInState,omitempty" yaml:"burnInState,omitempty" flag:"burn-in-state"`
+	NetworkOutput        string    `json:"networkOutput,omitempty" yaml:"networkOutput,omitempty" flag:"network-output"`
+	NetworkDynamic       *bool     `json:"networkDynamic,omitempty" yaml:"networkDynamic,omitempty" flag:"network-dynamic"`
+	History              *uint32   `json:"history,omitempty" yaml:"history,omitempty" flag:"history"`
+	Snapshot             *uint32   `json:"snapshot,omitempty" yaml:"snapshot,omitempty" flag:"snapshot"`
+	Tolerance            *float64  `json:"tolerance,omitempty" yaml:"tolerance,omitempty" flag:"tolerance"`
+	Window               *uint32   `json:"window,omitempty" yaml:"window,omitempty" flag:"window"`
+	Engine               string    `json:"engine,omitempty" yaml:"engine,omitempty" flag:"engine"`
+	Precision            string    `json:"precision,omitempty" yaml:"precision,omitempty" flag:"precision"`
+	Seed                 *int64    `json:"seed,omitempty" yaml:"seed,omitempty" flag:"seed"`
+	Timeout              string    `json:"timeout,omitempty" yaml:"timeout,omitempty" flag:"timeout"`
+	Shards               *int      `json:"shards,omitempty" yaml:"shards,omitempty" flag:"shards"`
+	Replicates           *int      `json:"replicates,omitempty" yaml:"replicates,omitempty" flag:"replicates"`
+	ReplicateConcurrency *int      `json:"replicateConcurrency,omitempty" yaml:"replicateConcurrency,omitempty" flag:"replicate-concurrency"`
+	KeepReplicates       *bool     `json:"keepReplicates,omitempty" yaml:"keepReplicates,omitempty" flag:"keep-replicates"`
+	Percentiles          []float64 `json:"percentiles,omitempty" yaml:"percentiles,omitempty" flag:"percentiles"`
+}
+
+// ReadManifest reads a Manifest from a file, resolving its paths relative to
+// the directory of the file.
+//
+// Files with a .yaml or .yml extension are YAML, and other files are JSON.
+// Unknown fields are an error.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(Manifest)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(m)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for _, p := range []*string{
+		&m.Behaviours,
+		&m.Beliefs,
+		&m.Agents,
+		&m.Prs,
+		&m.Network,
+		&m.NetworkIds,
+		&m.Output,
+		&m.ActionsOutput,
+		&m.BurnInState,
+		&m.NetworkOutput,
+	} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	yamlManifest := `behaviours: behaviours.json
+beliefs: /data/beliefs.json
+agents: agents/agents.json.zst
+end: 20
+burnIn: 5
+seed: -3
+full: true
+percentiles: [5, 95]
+`
+	jsonManifest := `{
+  "behaviours": "behaviours.json",
+  "beliefs": "/data/beliefs.json",
+  "agents": "agents/agents.json.zst",
+  "end": 20,
+  "burnIn": 5,
+  "seed": -3,
+  "full": true,
+  "percentiles": [5, 95]
+}`
+
+	var manifests []*Manifest
+	for name, data := range map[string]string{
+		"scenario.yaml": yamlManifest,
+		"scenario.json": jsonManifest,
+	} {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(data), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ReadManifest(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifests = append(manifests, m)
+	}
+
+	m := manifests[0]
+	if m.Behaviours != filepath.Join(dir, "behaviours.json") {
+		t.Errorf("Relative paths should be resolved against the manifest; got %s", m.Behaviours)
+	}
+	if m.Beliefs != "/data/beliefs.json" {
+		t.Errorf("Absolute paths should be unchanged; got %s", m.Beliefs)
+	}
+	if m.Agents != filepath.Join(dir, "agents", "agents.json.zst") {
+		t.Errorf("Unexpected agents path %s", m.Agents)
+	}
+	if m.Prs != "" || m.Start != nil {
+		t.Error("Missing fields should be unset")
+	}
+	if *m.End != 20 || *m.BurnIn != 5 || *m.Seed != -3 || !*m.Full {
+		t.Errorf("Unexpected options %+v", m)
+	}
+	if !reflect.DeepEqual(manifests[0], manifests[1]) {
+		t.Error("YAML and JSON manifests should be equal")
+	}
+
+	path := filepath.Join(dir, "unknown.yml")
+	err := os.WriteFile(path, []byte("agent: agents.json.zst\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadManifest(path)
+	if err == nil {
+		t.Error("Expected error for unknown field")
+	}
+}
@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+// Metric is a scalar output of a simulation, calculated from its summary
+// statistics at the last tick it completed.
+type Metric struct {
+	// The name of the Metric, as given to ParseMetric.
+	Name string
+	// The statistic, and the belief or behaviour it is of.
+	statistic string
+	uuid      uuid.UUID
+}
+
+// ParseMetric parses the name of a Metric.
+//
+// The name is "<statistic>:<belief>", where the statistic is meanActivation,
+// sdActivation, medianActivation or nonzeroActivationCount, or
+// "<statistic>:<behaviour>", where the statistic is nPerformers or
+// behaviourShare, the fraction of agents performing the behaviour. Beliefs and
+// behaviours are referred to by name or by UUID.
+func ParseMetric(name string, beliefs []*b.Belief, behaviours []*b.Behaviour) (*Metric, error) {
+	statistic, entity, found := strings.Cut(name, ":")
+	if !found {
+		return nil, fmt.Errorf("metric %q should be <statistic>:<belief or behaviour>", name)
+	}
+
+	m := &Metric{Name: name, statistic: statistic}
+	switch statistic {
+	case "meanActivation", "sdActivation", "medianActivation", "nonzeroActivationCount":
+		belief := findBelief(beliefs, entity)
+		if belief == nil {
+			return nil, fmt.Errorf("unknown belief %q in metric %q", entity, name)
+		}
+		m.uuid = belief.Uuid
+	case "nPerformers", "behaviourShare":
+		behaviour := findBehaviour(behaviours, entity)
+		if behaviour == nil {
+			return nil, fmt.Errorf("unknown behaviour %q in metric %q", entity, name)
+		}
+		m.uuid = behaviour.Uuid
+	default:
+		return nil, fmt.Errorf("unknown statistic %q in metric %q", statistic, name)
+	}
+
+	return m, nil
+}
+
+// Value gets the value of the Metric at the last tick of a summary of a
+// simulation of nAgents agents.
+//
+// Missing statistics are 0, but it is an error for the summary to have no
+// statistics at its last tick, such as when no tick was completed.
+func (m *Metric) Value(summary *OutputSpecs, nAgents int) (float64, error) {
+	spec, found := summary.Data[summary.LastTick]
+	if !found {
+		return 0, fmt.Errorf("the summary has no statistics at its last tick, %d", summary.LastTick)
+	}
+	switch m.statistic {
+	case "meanActivation":
+		return spec.MeanActivation[m.uuid], nil
+	case "sdActivation":
+		return spec.SDActivation[m.uuid], nil
+	case "medianActivation":
+		return spec.MedianActivation[m.uuid], nil
+	case "nonzeroActivationCount":
+		return float64(spec.NonzeroActivationCount[m.uuid]), nil
+	case "nPerformers":
+		return float64(spec.NPerformers[m.uuid]), nil
+	default:
+		return float64(spec.NPerformers[m.uuid]) / float64(nAgents), nil
+	}
+}
@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+func TestMetric(t *testing.T) {
+	c := newRandomConfiguration(1, 10, 2)
+	belief := c.Beliefs[0]
+	behaviour := c.Behaviours[1]
+
+	o := NewOutputSpec()
+	o.MeanActivation[belief.Uuid] = 0.5
+	o.NPerformers[behaviour.Uuid] = 4
+	summary := &OutputSpecs{LastTick: 3, Data: map[b.SimTime]OutputSpec{3: *o}}
+
+	for name, expected := range map[string]float64{
+		"meanActivation:" + belief.Name:        0.5,
+		"sdActivation:" + belief.Uuid.String(): 0,
+		"nPerformers:" + behaviour.Name:        4,
+		"behaviourShare:" + behaviour.Name:     0.4,
+	} {
+		m, err := ParseMetric(name, c.Beliefs, c.Behaviours)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := m.Value(summary, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Errorf("%s should be %f; it was %f", name, expected, value)
+		}
+	}
+
+	m, err := ParseMetric("meanActivation:"+belief.Name, c.Beliefs, c.Behaviours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Value(&OutputSpecs{LastTick: 0, Data: summary.Data}, 10)
+	if err == nil {
+		t.Error("Expected an error for a summary with no statistics at its last tick")
+	}
+
+	for _, name := range []string{"meanActivation", "unknown:bel1", "nPerformers:bel1"} {
+		_, err := ParseMetric(name, c.Beliefs, c.Behaviours)
+		if err == nil {
+			t.Errorf("Expected error for %q", name)
+		}
+	}
+}
@@ -0,0 +1,727 @@
+package runner
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+// NetworkFormat is a format of a social network file.
+type NetworkFormat string
+
+const (
+	// NetworkFormatCsv is an edge list as a CSV table, with a header naming
+	// the source and target columns, and optionally a weight column and a
+	// type column, whose value is "undirected" for an undirected edge. The
+	// names of the columns are not case sensitive, so the edge tables
+	// exported by Gephi can be read.
+	NetworkFormatCsv NetworkFormat = "csv"
+	// NetworkFormatTsv is NetworkFormatCsv, separated by tabs.
+	NetworkFormatTsv NetworkFormat = "tsv"
+	// NetworkFormatGraphml is GraphML.
+	NetworkFormatGraphml NetworkFormat = "graphml"
+	// NetworkFormatGexf is GEXF, the format of Gephi.
+	NetworkFormatGexf NetworkFormat = "gexf"
+)
+
+// NetworkFormats are the supported NetworkFormats.
+var NetworkFormats = []NetworkFormat{
+	NetworkFormatCsv,
+	NetworkFormatTsv,
+	NetworkFormatGraphml,
+	NetworkFormatGexf,
+}
+
+// ParseNetworkFormat gets the NetworkFormat with the name s.
+func ParseNetworkFormat(s string) (NetworkFormat, error) {
+	for _, format := range NetworkFormats {
+		if string(format) == s {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown network format %q (expected one of %v)", s, NetworkFormats)
+}
+
+// NetworkFormatOf gets the NetworkFormat of a file from the extension of its
+// path.
+func NetworkFormatOf(path string) (NetworkFormat, error) {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	format, err := ParseNetworkFormat(ext)
+	if err != nil {
+		return "", fmt.Errorf("cannot detect the network format of %s from its extension", path)
+	}
+	return format, nil
+}
+
+// NetworkWeights is a mapping of the weights of the edges of a network to the
+// weights of friends.
+type NetworkWeights string
+
+const (
+	// NetworkWeightsRaw uses the weights as they are.
+	NetworkWeightsRaw NetworkWeights = "raw"
+	// NetworkWeightsUnit gives every edge a weight of 1.
+	NetworkWeightsUnit NetworkWeights = "unit"
+	// NetworkWeightsMax divides every weight by the largest weight.
+	NetworkWeightsMax NetworkWeights = "max"
+	// NetworkWeightsMinMax maps the smallest weight to 0 and the largest to 1,
+	// linearly. If every weight is equal, they are all 1.
+	NetworkWeightsMinMax NetworkWeights = "minmax"
+	// NetworkWeightsSum divides the weight of each friend of an agent by the
+	// sum of the weights of its friends, so they sum to 1.
+	NetworkWeightsSum NetworkWeights = "sum"
+)
+
+// AllNetworkWeights are the supported NetworkWeights.
+var AllNetworkWeights = []NetworkWeights{
+	NetworkWeightsRaw,
+	NetworkWeightsUnit,
+	NetworkWeightsMax,
+	NetworkWeightsMinMax,
+	NetworkWeightsSum,
+}
+
+// ParseNetworkWeights gets the NetworkWeights with the name s.
+func ParseNetworkWeights(s string) (NetworkWeights, error) {
+	for _, weights := range AllNetworkWeights {
+		if string(weights) == s {
+			return weights, nil
+		}
+	}
+	return "", fmt.Errorf("unknown network weights %q (expected one of %v)", s, AllNetworkWeights)
+}
+
+// NetworkOptions are the options with which ReadNetwork reads a network.
+type NetworkOptions struct {
+	// The format of the network.
+	Format NetworkFormat
+	// The agent UUID of each node ID. Nodes which are not in NodeIds are
+	// matched by UuidAttribute, or otherwise their ID must be the UUID of
+	// the agent.
+	NodeIds map[string]uuid.UUID
+	// The name of a node attribute of a GraphML or GEXF network holding the
+	// UUID of the agent of each node, or empty if there is none.
+	UuidAttribute string
+	// The name of the column or edge attribute holding the weight of each
+	// edge, or empty for "weight". Edges without a weight have a weight of
+	// 1.
+	WeightAttribute string
+	// Whether to add the reverse of each directed edge whose reverse is not
+	// in the network, with the same weight.
+	Symmetrise bool
+	// The mapping of the weights, which is NetworkWeightsRaw if it is empty.
+	Weights NetworkWeights
+}
+
+// Network is the weight of each friend of each agent, by UUID, as in the
+// Friends of an AgentSpec.
+type Network map[uuid.UUID]map[uuid.UUID]float64
+
+// networkEdge is an edge of a network file, between nodes identified by their
+// IDs in the file.
+type networkEdge struct {
+	source   string
+	target   string
+	weight   float64
+	directed bool
+}
+
+// networkGraph is the nodes and edges read from a network file.
+type networkGraph struct {
+	// The value of the UuidAttribute of each node which has one.
+	uuids map[string]string
+	edges []networkEdge
+}
+
+// ReadNetwork reads a network from r, matching its nodes to agents by the
+// options.
+//
+// An undirected edge is a friendship in both directions. If an edge appears
+// more than once, its last weight is used.
+func ReadNetwork(r io.Reader, options NetworkOptions) (Network, error) {
+	weightAttribute := options.WeightAttribute
+	if weightAttribute == "" {
+		weightAttribute = "weight"
+	}
+
+	var graph *networkGraph
+	var err error
+	switch options.Format {
+	case NetworkFormatCsv:
+		graph, err = readEdgeList(r, ',', weightAttribute)
+	case NetworkFormatTsv:
+		graph, err = readEdgeList(r, '\t', weightAttribute)
+	case NetworkFormatGraphml:
+		graph, err = readGraphml(r, options.UuidAttribute, weightAttribute)
+	case NetworkFormatGexf:
+		graph, err = readGexf(r, options.UuidAttribute, weightAttribute)
+	default:
+		return nil, fmt.Errorf("unknown network format %q", options.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]uuid.UUID)
+	resolve := func(id string) (uuid.UUID, error) {
+		if u, found := nodes[id]; found {
+			return u, nil
+		}
+		u, found := options.NodeIds[id]
+		if !found {
+			s, hasAttribute := graph.uuids[id]
+			if !hasAttribute {
+				s = id
+			}
+			var err error
+			u, err = uuid.Parse(s)
+			if err != nil {
+				return uuid.Nil, fmt.Errorf("node %q does not map to an agent UUID: %w", id, err)
+			}
+		}
+		nodes[id] = u
+		return u, nil
+	}
+
+	network := make(Network)
+	for _, e := range graph.edges {
+		source, err := resolve(e.source)
+		if err != nil {
+			return nil, err
+		}
+		target, err := resolve(e.target)
+		if err != nil {
+			return nil, err
+		}
+		network.set(source, target, e.weight)
+		if !e.directed {
+			network.set(target, source, e.weight)
+		}
+	}
+
+	if options.Symmetrise {
+		network.symmetrise()
+	}
+
+	err = network.mapWeights(options.Weights)
+	if err != nil {
+		return nil, err
+	}
+
+	return network, nil
+}
+
+// set sets the weight of the friend target of source.
+func (n Network) set(source, target uuid.UUID, weight float64) {
+	friends := n[source]
+	if friends == nil {
+		friends = make(map[uuid.UUID]float64)
+		n[source] = friends
+	}
+	friends[target] = weight
+}
+
+// symmetrise adds the reverse of every edge whose reverse is not in n, with the
+// same weight.
+func (n Network) symmetrise() {
+	type edge struct {
+		source, target uuid.UUID
+		weight         float64
+	}
+
+	var reverse []edge
+	for source, friends := range n {
+		for target, weight := range friends {
+			if _, found := n[target][source]; !found {
+				reverse = append(reverse, edge{target, source, weight})
+			}
+		}
+	}
+
+	for _, e := range reverse {
+		n.set(e.source, e.target, e.weight)
+	}
+}
+
+// mapWeights maps the weights of n.
+func (n Network) mapWeights(weights NetworkWeights) error {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, friends := range n {
+		for _, w := range friends {
+			min = math.Min(min, w)
+			max = math.Max(max, w)
+		}
+	}
+
+	var f func(w, sum float64) float64
+	switch weights {
+	case "", NetworkWeightsRaw:
+		return nil
+	case NetworkWeightsUnit:
+		f = func(w, sum float64) float64 { return 1 }
+	case NetworkWeightsMax:
+		if max <= 0 {
+			return errors.New("cannot divide the weights by the largest weight, which is not positive")
+		}
+		f = func(w, sum float64) float64 { return w / max }
+	case NetworkWeightsMinMax:
+		f = func(w, sum float64) float64 {
+			if max == min {
+				return 1
+			}
+			return (w - min) / (max - min)
+		}
+	case NetworkWeightsSum:
+		f = func(w, sum float64) float64 { return w / sum }
+	default:
+		return fmt.Errorf("unknown network weights %q", weights)
+	}
+
+	for source, friends := range n {
+		sum := 0.0
+		for _, w := range friends {
+			sum += w
+		}
+		if weights == NetworkWeightsSum && sum <= 0 {
+			return fmt.Errorf("the weights of the friends of %v do not have a positive sum", source)
+		}
+		for target, w := range friends {
+			friends[target] = f(w, sum)
+		}
+	}
+
+	return nil
+}
+
+// AttachNetwork sets the friends of agents from network.
+//
+// If replace, the friends every agent had before are removed; otherwise the
+// network is added to them, replacing the weight of any friend in both.
+//
+// If strict, agents in the network which are not in agents are an
+// *UnresolvedReferencesError listing all of them; otherwise their edges are
+// ignored.
+func AttachNetwork(agents []*b.Agent, network Network, replace bool, strict bool) error {
+	uuidAgents := make(map[uuid.UUID]*b.Agent, len(agents))
+	for _, a := range agents {
+		uuidAgents[a.Uuid] = a
+		if replace {
+			clear(a.Friends)
+		}
+	}
+
+	var refs *UnresolvedReferencesError
+	if strict {
+		refs = new(UnresolvedReferencesError)
+	}
+
+	unknown := make(map[uuid.UUID]bool)
+	for source, friends := range network {
+		a := uuidAgents[source]
+		if a == nil {
+			unknown[source] = true
+		}
+		for target, w := range friends {
+			friend := uuidAgents[target]
+			if friend == nil {
+				unknown[target] = true
+			} else if a != nil {
+				a.Friends[friend] = w
+			}
+		}
+	}
+
+	for _, u := range sortedUuids(unknown) {
+		refs.add("network", "nodes", "agent", u)
+	}
+
+	if refs != nil {
+		return refs.orNil()
+	}
+
+	return nil
+}
+
+// ReadNodeIds reads a CSV table mapping the node IDs of a network to agent
+// UUIDs, for NetworkOptions.NodeIds.
+//
+// The table has a header, naming the idColumn with the node IDs and the uuid
+// column with the agent UUIDs. Other columns are ignored.
+func ReadNodeIds(r io.Reader, idColumn string) (map[string]uuid.UUID, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := csvColumns(header)
+	id, hasId := columns[strings.ToLower(idColumn)]
+	u, hasUuid := columns["uuid"]
+	if !hasId || !hasUuid {
+		return nil, fmt.Errorf("the header must have the columns %s and uuid", idColumn)
+	}
+
+	ids := make(map[string]uuid.UUID)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ids[strings.TrimSpace(record[id])], err = uuid.Parse(strings.TrimSpace(record[u]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid uuid: %w", line, err)
+		}
+	}
+
+	return ids, nil
+}
+
+// csvColumns gets the index of each column of a header, by its lower case
+// name.
+func csvColumns(header []string) map[string]int {
+	columns := make(map[string]int, len(header))
+	for c, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = c
+	}
+	return columns
+}
+
+// parseWeight parses the weight of an edge, which is 1 if s is empty.
+func parseWeight(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 1, nil
+	}
+	w, err := strconv.ParseFloat(s, 64)
+	if err == nil && (math.IsNaN(w) || math.IsInf(w, 0)) {
+		err = fmt.Errorf("weight %s is not finite", s)
+	}
+	return w, err
+}
+
+// readEdgeList reads a network in NetworkFormatCsv, separated by comma.
+func readEdgeList(r io.Reader, comma rune, weightColumn string) (*networkGraph, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := csvColumns(header)
+	source, hasSource := columns["source"]
+	target, hasTarget := columns["target"]
+	if !hasSource || !hasTarget {
+		return nil, errors.New("the header must have the columns source and target")
+	}
+	weight, hasWeight := columns[strings.ToLower(weightColumn)]
+	edgeType, hasType := columns["type"]
+
+	graph := new(networkGraph)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		e := networkEdge{
+			source:   strings.TrimSpace(record[source]),
+			target:   strings.TrimSpace(record[target]),
+			weight:   1,
+			directed: true,
+		}
+		if hasWeight {
+			e.weight, err = parseWeight(record[weight])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid weight: %w", line, err)
+			}
+		}
+		if hasType {
+			e.directed = !strings.EqualFold(strings.TrimSpace(record[edgeType]), "undirected")
+		}
+		graph.edges = append(graph.edges, e)
+	}
+
+	return graph, nil
+}
+
+// graphmlFile is the part of a GraphML file read by readGraphml.
+//
+// The elements of the file are also written by WriteNetwork.
+type graphmlFile struct {
+	Keys  []graphmlKey `xml:"key"`
+	Graph graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	Id      string  `xml:"id,attr"`
+	For     string  `xml:"for,attr"`
+	Name    string  `xml:"attr.name,attr"`
+	Type    string  `xml:"attr.type,attr,omitempty"`
+	Default *string `xml:"default"`
+}
+
+type graphmlGraph struct {
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source   string        `xml:"source,attr"`
+	Target   string        `xml:"target,attr"`
+	Directed string        `xml:"directed,attr,omitempty"`
+	Data     []graphmlData `xml:"data"`
+}
+
+// graphmlValue gets the value of the key of data, or its default, and whether
+// either is set.
+func graphmlValue(key *graphmlKey, data []graphmlData) (string, bool) {
+	if key == nil {
+		return "", false
+	}
+	for _, d := range data {
+		if d.Key == key.Id {
+			return d.Value, true
+		}
+	}
+	if key.Default != nil {
+		return *key.Default, true
+	}
+	return "", false
+}
+
+// readGraphml reads the first graph of a network in NetworkFormatGraphml.
+//
+// Keys are found by their attr.name, or by their id if they have no name.
+func readGraphml(r io.Reader, uuidAttribute, weightAttribute string) (*networkGraph, error) {
+	var file graphmlFile
+	err := xml.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GraphML: %w", err)
+	}
+
+	findKey := func(domain, name string) *graphmlKey {
+		for i, key := range file.Keys {
+			if (key.For == domain || key.For == "all") && (key.Name == name || (key.Name == "" && key.Id == name)) {
+				return &file.Keys[i]
+			}
+		}
+		return nil
+	}
+
+	graph := &networkGraph{uuids: make(map[string]string)}
+	if uuidAttribute != "" {
+		uuidKey := findKey("node", uuidAttribute)
+		if uuidKey == nil {
+			return nil, fmt.Errorf("there is no node key %q", uuidAttribute)
+		}
+		for _, node := range file.Graph.Nodes {
+			if value, found := graphmlValue(uuidKey, node.Data); found {
+				graph.uuids[node.Id] = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	weightKey := findKey("edge", weightAttribute)
+	directed := file.Graph.EdgeDefault != "undirected"
+	for i, edge := range file.Graph.Edges {
+		e := networkEdge{
+			source:   edge.Source,
+			target:   edge.Target,
+			weight:   1,
+			directed: directed,
+		}
+		if edge.Directed != "" {
+			e.directed = edge.Directed == "true"
+		}
+		if value, found := graphmlValue(weightKey, edge.Data); found {
+			e.weight, err = parseWeight(value)
+			if err != nil {
+				return nil, fmt.Errorf("edge %d: invalid weight: %w", i, err)
+			}
+		}
+		graph.edges = append(graph.edges, e)
+	}
+
+	return graph, nil
+}
+
+// gexfFile is the part of a GEXF file read by readGexf.
+//
+// The elements of the file are also written by WriteNetwork and
+// WriteDynamicGexf.
+type gexfFile struct {
+	Graph gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Mode       string          `xml:"mode,attr,omitempty"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	Id      string  `xml:"id,attr"`
+	Title   string  `xml:"title,attr"`
+	Type    string  `xml:"type,attr,omitempty"`
+	Default *string `xml:"default"`
+}
+
+// gexfAttValues are the attribute values of a node or edge.
+type gexfAttValues struct {
+	Values []gexfAttValue `xml:"attvalue"`
+}
+
+// gexfAttValue is the value of an attribute, which is identified by for since
+// GEXF 1.1, and by id before. A dynamic value is only at its timestamp.
+type gexfAttValue struct {
+	For       string `xml:"for,attr,omitempty"`
+	Id        string `xml:"id,attr,omitempty"`
+	Value     string `xml:"value,attr"`
+	Timestamp string `xml:"timestamp,attr,omitempty"`
+}
+
+type gexfNode struct {
+	Id        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	AttValues *gexfAttValues `xml:"attvalues"`
+}
+
+type gexfEdge struct {
+	Id        string         `xml:"id,attr,omitempty"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Type      string         `xml:"type,attr,omitempty"`
+	Weight    string         `xml:"weight,attr,omitempty"`
+	AttValues *gexfAttValues `xml:"attvalues"`
+}
+
+// gexfValue gets the value of the attribute in values, or its default, and
+// whether either is set.
+func gexfValue(attribute *gexfAttribute, values *gexfAttValues) (string, bool) {
+	if attribute == nil {
+		return "", false
+	}
+	if values != nil {
+		for _, v := range values.Values {
+			if v.For == attribute.Id || (v.For == "" && v.Id == attribute.Id) {
+				return v.Value, true
+			}
+		}
+	}
+	if attribute.Default != nil {
+		return *attribute.Default, true
+	}
+	return "", false
+}
+
+// readGexf reads a network in NetworkFormatGexf.
+//
+// Attributes are found by their title. The weight of an edge is its weight
+// attribute when the weight attribute is "weight", and otherwise the edge
+// attribute with that title. Mutual edges are undirected.
+func readGexf(r io.Reader, uuidAttribute, weightAttribute string) (*networkGraph, error) {
+	var file gexfFile
+	err := xml.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GEXF: %w", err)
+	}
+
+	findAttribute := func(class, title string) *gexfAttribute {
+		for _, attributes := range file.Graph.Attributes {
+			if attributes.Class != class {
+				continue
+			}
+			for i, attribute := range attributes.Attributes {
+				if attribute.Title == title {
+					return &attributes.Attributes[i]
+				}
+			}
+		}
+		return nil
+	}
+
+	graph := &networkGraph{uuids: make(map[string]string)}
+	if uuidAttribute != "" {
+		uuidAttr := findAttribute("node", uuidAttribute)
+		if uuidAttr == nil {
+			return nil, fmt.Errorf("there is no node attribute %q", uuidAttribute)
+		}
+		for _, node := range file.Graph.Nodes {
+			if value, found := gexfValue(uuidAttr, node.AttValues); found {
+				graph.uuids[node.Id] = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	var weightAttr *gexfAttribute
+	if weightAttribute != "weight" {
+		weightAttr = findAttribute("edge", weightAttribute)
+		if weightAttr == nil {
+			return nil, fmt.Errorf("there is no edge attribute %q", weightAttribute)
+		}
+	}
+
+	for i, edge := range file.Graph.Edges {
+		edgeType := edge.Type
+		if edgeType == "" {
+			edgeType = file.Graph.DefaultEdgeType
+		}
+
+		weight := edge.Weight
+		if weightAttr != nil {
+			weight, _ = gexfValue(weightAttr, edge.AttValues)
+		}
+
+		e := networkEdge{
+			source:   edge.Source,
+			target:   edge.Target,
+			directed: edgeType == "directed",
+		}
+		e.weight, err = parseWeight(weight)
+		if err != nil {
+			return nil, fmt.Errorf("edge %d: invalid weight: %w", i, err)
+		}
+		graph.edges = append(graph.edges, e)
+	}
+
+	return graph, nil
+}
@@ -0,0 +1,297 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+const (
+	graphmlNamespace = "http://graphml.graphdrawing.org/xmlns"
+	gexfNamespace    = "http://gexf.net/1.3"
+	gexfVersion      = "1.3"
+)
+
+// The ID of the node attribute with the behaviour of an agent, and the prefix
+// of the IDs of the node attributes with the activations of the beliefs,
+// followed by the index of the belief.
+const (
+	networkBehaviourAttribute  = "behaviour"
+	networkActivationAttribute = "activation"
+)
+
+// networkNodeAttributes gets the node attributes of the network of agents
+// holding beliefs, whose values are written by networkAttValues.
+//
+// Each belief is titled by its name.
+func networkNodeAttributes(beliefs []*b.Belief) []gexfAttribute {
+	attributes := []gexfAttribute{{
+		Id:    networkBehaviourAttribute,
+		Title: networkBehaviourAttribute,
+		Type:  "string",
+	}}
+	for i, belief := range beliefs {
+		attributes = append(attributes, gexfAttribute{
+			Id:    networkActivationAttribute + strconv.Itoa(i),
+			Title: belief.Name,
+			Type:  "double",
+		})
+	}
+	return attributes
+}
+
+// networkAttValues gets the values of the node attributes of a at tick time,
+// omitting the behaviour if it has no action, and each belief it has no
+// activation of.
+func networkAttValues(a *b.Agent, beliefs []*b.Belief, time b.SimTime) []gexfAttValue {
+	var values []gexfAttValue
+	if behaviour := a.Actions[time]; behaviour != nil {
+		values = append(values, gexfAttValue{For: networkBehaviourAttribute, Value: behaviour.Name})
+	}
+	activations := a.Activations[time]
+	for i, belief := range beliefs {
+		if activation, found := activations[belief]; found {
+			values = append(values, gexfAttValue{
+				For:   networkActivationAttribute + strconv.Itoa(i),
+				Value: strconv.FormatFloat(activation, 'g', -1, 64),
+			})
+		}
+	}
+	return values
+}
+
+// sortedFriends gets the friends of a which are in nodes, in order of UUID.
+func sortedFriends(a *b.Agent, nodes map[*b.Agent]bool) []*b.Agent {
+	friends := make([]*b.Agent, 0, len(a.Friends))
+	for friend := range a.Friends {
+		if nodes[friend] {
+			friends = append(friends, friend)
+		}
+	}
+	sort.Slice(friends, func(i, j int) bool {
+		return bytes.Compare(friends[i].Uuid[:], friends[j].Uuid[:]) < 0
+	})
+	return friends
+}
+
+// agentSet gets the set of agents.
+func agentSet(agents []*b.Agent) map[*b.Agent]bool {
+	set := make(map[*b.Agent]bool, len(agents))
+	for _, a := range agents {
+		set[a] = true
+	}
+	return set
+}
+
+// xmlWriter writes an XML document, element by element, recording the first
+// error so it can be checked once at the end.
+type xmlWriter struct {
+	encoder *xml.Encoder
+	err     error
+}
+
+func newXmlWriter(w io.Writer) *xmlWriter {
+	x := &xmlWriter{encoder: xml.NewEncoder(w)}
+	x.encoder.Indent("", "  ")
+	_, x.err = io.WriteString(w, xml.Header)
+	return x
+}
+
+// start starts an element with the attributes, given as name and value pairs.
+func (x *xmlWriter) start(name string, attrs ...string) {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+	}
+	if x.err == nil {
+		x.err = x.encoder.EncodeToken(start)
+	}
+}
+
+// end ends the element with the name.
+func (x *xmlWriter) end(name string) {
+	if x.err == nil {
+		x.err = x.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+}
+
+// element writes v as an element with the name.
+func (x *xmlWriter) element(name string, v any) {
+	if x.err == nil {
+		x.err = x.encoder.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+	}
+}
+
+// close flushes the document, and gets the first error.
+func (x *xmlWriter) close() error {
+	if x.err == nil {
+		x.err = x.encoder.Close()
+	}
+	return x.err
+}
+
+// WriteNetwork writes the network of the friends of agents to w as
+// NetworkFormatGraphml or NetworkFormatGexf, with the state of each agent at
+// tick time, such as the end of a simulation, as the attributes of its node.
+//
+// Each node is identified by the UUID of its agent, with a behaviour attribute
+// naming the behaviour it performed, and an attribute for each belief, titled
+// by its name, with its activation. Attributes the agent has no value for at
+// the tick are omitted. Each edge is directed from an agent to its friend,
+// weighted by the weight of the friend, so the network can be read back by
+// ReadNetwork. Friends which are not in agents are omitted.
+func WriteNetwork(
+	w io.Writer,
+	format NetworkFormat,
+	agents []*b.Agent,
+	beliefs []*b.Belief,
+	time b.SimTime,
+) error {
+	switch format {
+	case NetworkFormatGraphml:
+		return writeGraphml(w, agents, beliefs, time)
+	case NetworkFormatGexf:
+		return writeGexf(w, agents, beliefs, func(a *b.Agent) []gexfAttValue {
+			return networkAttValues(a, beliefs, time)
+		}, false)
+	default:
+		return fmt.Errorf("the network cannot be written as %s", format)
+	}
+}
+
+// WriteDynamicGexf writes the network of the friends of agents to w as a
+// dynamic NetworkFormatGexf network, so Gephi can animate it.
+//
+// This is WriteNetwork, except that the attributes of each node have a value
+// at every tick of the history of its agent, with the tick as its timestamp.
+func WriteDynamicGexf(w io.Writer, agents []*b.Agent, beliefs []*b.Belief) error {
+	return writeGexf(w, agents, beliefs, func(a *b.Agent) []gexfAttValue {
+		times := make([]b.SimTime, 0, len(a.Activations))
+		for time := range a.Activations {
+			times = append(times, time)
+		}
+		for time := range a.Actions {
+			if _, found := a.Activations[time]; !found {
+				times = append(times, time)
+			}
+		}
+		sortTimes(times)
+
+		var values []gexfAttValue
+		for _, time := range times {
+			timestamp := strconv.FormatUint(uint64(time), 10)
+			for _, value := range networkAttValues(a, beliefs, time) {
+				value.Timestamp = timestamp
+				values = append(values, value)
+			}
+		}
+		return values
+	}, true)
+}
+
+func writeGraphml(w io.Writer, agents []*b.Agent, beliefs []*b.Belief, time b.SimTime) error {
+	nodes := agentSet(agents)
+
+	x := newXmlWriter(w)
+	x.start("graphml", "xmlns", graphmlNamespace)
+
+	for _, attribute := range networkNodeAttributes(beliefs) {
+		x.element("key", graphmlKey{
+			Id:   attribute.Id,
+			For:  "node",
+			Name: attribute.Title,
+			Type: attribute.Type,
+		})
+	}
+	x.element("key", graphmlKey{Id: "weight", For: "edge", Name: "weight", Type: "double"})
+
+	x.start("graph", "edgedefault", "directed")
+	for _, a := range agents {
+		node := graphmlNode{Id: a.Uuid.String()}
+		for _, value := range networkAttValues(a, beliefs, time) {
+			node.Data = append(node.Data, graphmlData{Key: value.For, Value: value.Value})
+		}
+		x.element("node", node)
+	}
+	for _, a := range agents {
+		for _, friend := range sortedFriends(a, nodes) {
+			x.element("edge", graphmlEdge{
+				Source: a.Uuid.String(),
+				Target: friend.Uuid.String(),
+				Data: []graphmlData{{
+					Key:   "weight",
+					Value: strconv.FormatFloat(a.Friends[friend], 'g', -1, 64),
+				}},
+			})
+		}
+	}
+	x.end("graph")
+
+	x.end("graphml")
+	return x.close()
+}
+
+// writeGexf writes a GEXF network, whose nodes have the attribute values of
+// values, which are dynamic if dynamic.
+func writeGexf(
+	w io.Writer,
+	agents []*b.Agent,
+	beliefs []*b.Belief,
+	values func(a *b.Agent) []gexfAttValue,
+	dynamic bool,
+) error {
+	mode := "static"
+	if dynamic {
+		mode = "dynamic"
+	}
+	graphAttrs := []string{"defaultedgetype", "directed", "mode", mode}
+	if dynamic {
+		graphAttrs = append(graphAttrs, "timeformat", "integer", "timerepresentation", "timestamp")
+	}
+
+	nodes := agentSet(agents)
+
+	x := newXmlWriter(w)
+	x.start("gexf", "xmlns", gexfNamespace, "version", gexfVersion)
+	x.start("graph", graphAttrs...)
+
+	x.element("attributes", gexfAttributes{
+		Class:      "node",
+		Mode:       mode,
+		Attributes: networkNodeAttributes(beliefs),
+	})
+
+	x.start("nodes")
+	for _, a := range agents {
+		node := gexfNode{Id: a.Uuid.String(), Label: a.Uuid.String()}
+		if v := values(a); len(v) != 0 {
+			node.AttValues = &gexfAttValues{Values: v}
+		}
+		x.element("node", node)
+	}
+	x.end("nodes")
+
+	x.start("edges")
+	id := 0
+	for _, a := range agents {
+		for _, friend := range sortedFriends(a, nodes) {
+			x.element("edge", gexfEdge{
+				Id:     strconv.Itoa(id),
+				Source: a.Uuid.String(),
+				Target: friend.Uuid.String(),
+				Weight: strconv.FormatFloat(a.Friends[friend], 'g', -1, 64),
+			})
+			id++
+		}
+	}
+	x.end("edges")
+
+	x.end("graph")
+	x.end("gexf")
+	return x.close()
+}
@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+func TestWriteNetworkIsReadByReadNetwork(t *testing.T) {
+	_, _, belief, agents := newTestFullOutput(t)
+
+	expected := Network{
+		agents[0].Uuid: {agents[1].Uuid: 0.5, agents[2].Uuid: 0.25},
+		agents[2].Uuid: {agents[0].Uuid: 1},
+	}
+
+	for _, format := range []NetworkFormat{NetworkFormatGraphml, NetworkFormatGexf} {
+		var buf bytes.Buffer
+		err := WriteNetwork(&buf, format, agents, []*b.Belief{belief}, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		network, err := ReadNetwork(&buf, NetworkOptions{Format: format})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if !reflect.DeepEqual(network, expected) {
+			t.Errorf("%s: expected %v, got %v", format, expected, network)
+		}
+	}
+}
+
+func TestWriteNetworkOmitsFriendsWhichAreNotAgents(t *testing.T) {
+	_, _, belief, agents := newTestFullOutput(t)
+
+	var buf bytes.Buffer
+	err := WriteNetwork(&buf, NetworkFormatGraphml, agents[:2], []*b.Belief{belief}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file graphmlFile
+	err = xml.Unmarshal(buf.Bytes(), &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Graph.Nodes) != 2 || len(file.Graph.Edges) != 1 {
+		t.Fatalf("Expected 2 nodes and 1 edge, got %d and %d", len(file.Graph.Nodes), len(file.Graph.Edges))
+	}
+	expected := []graphmlData{{Key: "behaviour", Value: "behaviour"}, {Key: "activation0", Value: "0.3"}}
+	if !reflect.DeepEqual(file.Graph.Nodes[1].Data, expected) {
+		t.Errorf("Expected %v, got %v", expected, file.Graph.Nodes[1].Data)
+	}
+}
+
+func TestWriteDynamicGexfHasValueAtEveryTick(t *testing.T) {
+	_, _, belief, agents := newTestFullOutput(t)
+	delete(agents[0].Activations, 2)
+
+	var buf bytes.Buffer
+	err := WriteDynamicGexf(&buf, agents, []*b.Belief{belief})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file gexfFile
+	err = xml.Unmarshal(buf.Bytes(), &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Graph.Nodes) != 3 || len(file.Graph.Edges) != 3 {
+		t.Fatalf("Expected 3 nodes and 3 edges, got %d and %d", len(file.Graph.Nodes), len(file.Graph.Edges))
+	}
+
+	values := file.Graph.Nodes[0].AttValues.Values
+	if len(values) != 9 {
+		t.Fatalf("Expected 5 behaviours and 4 activations, got %v", values)
+	}
+	expected := gexfAttValue{For: "activation0", Value: "0.3", Timestamp: "3"}
+	if values[6] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, values[6])
+	}
+}
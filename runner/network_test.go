@@ -0,0 +1,167 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+var (
+	testNode0 = uuid.MustParse("00000000-0000-0000-0000-00000000000a")
+	testNode1 = uuid.MustParse("00000000-0000-0000-0000-00000000000b")
+	testNode2 = uuid.MustParse("00000000-0000-0000-0000-00000000000c")
+)
+
+func TestReadNetworkEdgeList(t *testing.T) {
+	edges := `Source,Target,Type,Weight
+00000000-0000-0000-0000-00000000000a,00000000-0000-0000-0000-00000000000b,Directed,0.5
+00000000-0000-0000-0000-00000000000b,00000000-0000-0000-0000-00000000000c,Undirected,
+00000000-0000-0000-0000-00000000000c,00000000-0000-0000-0000-00000000000c,Directed,1
+`
+
+	network, err := ReadNetwork(strings.NewReader(edges), NetworkOptions{Format: NetworkFormatCsv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Network{
+		testNode0: {testNode1: 0.5},
+		testNode1: {testNode2: 1},
+		testNode2: {testNode1: 1, testNode2: 1},
+	}
+	if !reflect.DeepEqual(network, expected) {
+		t.Errorf("Expected %v, got %v", expected, network)
+	}
+
+	network, err = ReadNetwork(strings.NewReader(edges), NetworkOptions{
+		Format:     NetworkFormatCsv,
+		Symmetrise: true,
+		Weights:    NetworkWeightsMax,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if network[testNode1][testNode0] != 0.5 || network[testNode2][testNode1] != 1 {
+		t.Errorf("Expected the network to be symmetric, got %v", network)
+	}
+}
+
+func TestReadNetworkGraphmlByUuidAttribute(t *testing.T) {
+	graphml := `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="d0" for="node" attr.name="agent" attr.type="string"/>
+  <key id="d1" for="edge" attr.name="strength" attr.type="double">
+    <default>2</default>
+  </key>
+  <graph edgedefault="undirected">
+    <node id="n0"><data key="d0">00000000-0000-0000-0000-00000000000a</data></node>
+    <node id="n1"><data key="d0">00000000-0000-0000-0000-00000000000b</data></node>
+    <node id="n2"><data key="d0">00000000-0000-0000-0000-00000000000c</data></node>
+    <edge source="n0" target="n1"><data key="d1">4</data></edge>
+    <edge source="n1" target="n2" directed="true"/>
+  </graph>
+</graphml>`
+
+	network, err := ReadNetwork(strings.NewReader(graphml), NetworkOptions{
+		Format:          NetworkFormatGraphml,
+		UuidAttribute:   "agent",
+		WeightAttribute: "strength",
+		Weights:         NetworkWeightsMinMax,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Network{
+		testNode0: {testNode1: 1},
+		testNode1: {testNode0: 1, testNode2: 0},
+	}
+	if !reflect.DeepEqual(network, expected) {
+		t.Errorf("Expected %v, got %v", expected, network)
+	}
+}
+
+func TestReadNetworkGexfByNodeIds(t *testing.T) {
+	gexf := `<?xml version="1.0" encoding="UTF-8"?>
+<gexf xmlns="http://gexf.net/1.3" version="1.3">
+  <graph defaultedgetype="directed">
+    <nodes>
+      <node id="0" label="a"/>
+      <node id="1" label="b"/>
+      <node id="2" label="c"/>
+    </nodes>
+    <edges>
+      <edge id="0" source="0" target="1" weight="3"/>
+      <edge id="1" source="0" target="2"/>
+      <edge id="2" source="1" target="2" type="mutual" weight="0.5"/>
+    </edges>
+  </graph>
+</gexf>`
+
+	ids, err := ReadNodeIds(strings.NewReader(`respondent,name,uuid
+0,a,00000000-0000-0000-0000-00000000000a
+1,b,00000000-0000-0000-0000-00000000000b
+2,c,00000000-0000-0000-0000-00000000000c
+`), "respondent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network, err := ReadNetwork(strings.NewReader(gexf), NetworkOptions{
+		Format:  NetworkFormatGexf,
+		NodeIds: ids,
+		Weights: NetworkWeightsSum,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Network{
+		testNode0: {testNode1: 0.75, testNode2: 0.25},
+		testNode1: {testNode2: 1},
+		testNode2: {testNode1: 1},
+	}
+	if !reflect.DeepEqual(network, expected) {
+		t.Errorf("Expected %v, got %v", expected, network)
+	}
+
+	_, err = ReadNetwork(strings.NewReader(gexf), NetworkOptions{Format: NetworkFormatGexf})
+	if err == nil || !strings.Contains(err.Error(), `node "0"`) {
+		t.Errorf("Expected an error for a node which is not a UUID, got %v", err)
+	}
+}
+
+func TestAttachNetwork(t *testing.T) {
+	agents := []*b.Agent{b.NewAgent(), b.NewAgent()}
+	agents[0].Uuid = testNode0
+	agents[1].Uuid = testNode1
+	agents[0].Friends[agents[1]] = 0.1
+	agents[1].Friends[agents[0]] = 0.2
+
+	network := Network{
+		testNode0: {testNode1: 0.5, testNode2: 1},
+	}
+
+	err := AttachNetwork(agents, network, false, true)
+	var refs *UnresolvedReferencesError
+	if !errors.As(err, &refs) || len(refs.References) != 1 || refs.References[0].Uuid != testNode2 {
+		t.Fatalf("Expected agent %v to be unresolved, got %v", testNode2, err)
+	}
+
+	err = AttachNetwork(agents, network, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agents[0].Friends[agents[1]] != 0.5 || agents[1].Friends[agents[0]] != 0.2 {
+		t.Errorf("Expected the network to be added to the friends, got %v %v", agents[0].Friends, agents[1].Friends)
+	}
+
+	err = AttachNetwork(agents, network, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents[1].Friends) != 0 || len(agents[0].Friends) != 1 {
+		t.Errorf("Expected the network to replace the friends, got %v %v", agents[0].Friends, agents[1].Friends)
+	}
+}
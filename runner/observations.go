@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// Observations are the observed shares of agents performing behaviours at
+// some ticks, such as from a survey.
+type Observations struct {
+	// The ticks of the observations.
+	Ticks []b.SimTime
+	// The observed behaviours.
+	Behaviours []*b.Behaviour
+	// Shares[i][j] is the share of agents performing Behaviours[j] at
+	// Ticks[i], in [0, 1], or NaN if it was not observed.
+	Shares [][]float64
+}
+
+// ReadObservations reads Observations from a CSV table.
+//
+// The table has a "tick" column, giving the tick of each row, and a column for
+// each observed behaviour, named by its name or UUID, giving the share of
+// agents performing the behaviour at that tick. Empty cells are not observed.
+func ReadObservations(r io.Reader, behaviours []*b.Behaviour) (*Observations, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	o := &Observations{}
+	tickColumn := -1
+	columns := make([]int, 0, len(header))
+	for c, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "tick" {
+			tickColumn = c
+			continue
+		}
+		behaviour := findBehaviour(behaviours, name)
+		if behaviour == nil {
+			return nil, fmt.Errorf("unknown behaviour %q in header", name)
+		}
+		o.Behaviours = append(o.Behaviours, behaviour)
+		columns = append(columns, c)
+	}
+	if tickColumn == -1 {
+		return nil, errors.New("there is no tick column")
+	}
+	if len(o.Behaviours) == 0 {
+		return nil, errors.New("there are no behaviour columns")
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tick, err := strconv.ParseUint(strings.TrimSpace(record[tickColumn]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid tick: %w", line, err)
+		}
+
+		shares := make([]float64, len(columns))
+		for j, c := range columns {
+			cell := strings.TrimSpace(record[c])
+			if cell == "" {
+				shares[j] = math.NaN()
+				continue
+			}
+			shares[j], err = strconv.ParseFloat(cell, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid share of %s: %w", line, o.Behaviours[j].Name, err)
+			}
+			if shares[j] < 0 || shares[j] > 1 {
+				return nil, fmt.Errorf("line %d: share of %s is not in [0, 1]", line, o.Behaviours[j].Name)
+			}
+		}
+
+		o.Ticks = append(o.Ticks, b.SimTime(tick))
+		o.Shares = append(o.Shares, shares)
+	}
+
+	return o, nil
+}
+
+// Distance is the root mean square difference between the observed shares and
+// the shares of nAgents agents performing each behaviour in a summary.
+//
+// If the simulation converged before an observed tick, the shares at its last
+// tick are used, as they would not have changed. An observed tick which was
+// not simulated, because it is before the start of the simulation or the
+// simulation stopped for any other reason, is an error.
+func (o *Observations) Distance(summary *OutputSpecs, nAgents int) (float64, error) {
+	ss := 0.0
+	n := 0
+	for i, tick := range o.Ticks {
+		if tick > summary.LastTick && summary.StopReason == StopReasonConverged {
+			tick = summary.LastTick
+		}
+		spec, found := summary.Data[tick]
+		if !found {
+			return 0, fmt.Errorf("tick %d was not simulated", o.Ticks[i])
+		}
+
+		for j, behaviour := range o.Behaviours {
+			if math.IsNaN(o.Shares[i][j]) {
+				continue
+			}
+			share := float64(spec.NPerformers[behaviour.Uuid]) / float64(nAgents)
+			ss += math.Pow(share-o.Shares[i][j], 2.0)
+			n++
+		}
+	}
+
+	if n == 0 {
+		return 0, errors.New("there are no observations")
+	}
+	return math.Sqrt(ss / float64(n)), nil
+}
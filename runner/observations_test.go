@@ -0,0 +1,67 @@
+package runner
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+func TestObservations(t *testing.T) {
+	c := newRandomConfiguration(1, 10, 2)
+	beh0 := c.Behaviours[0]
+	beh1 := c.Behaviours[1]
+
+	csv := "tick," + beh0.Name + "," + beh1.Uuid.String() + "\n" +
+		"1,0.5,\n" +
+		"3,0.2,0.4\n"
+	o, err := ReadObservations(strings.NewReader(csv), c.Behaviours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Ticks) != 2 || o.Behaviours[1] != beh1 || !math.IsNaN(o.Shares[0][1]) {
+		t.Fatalf("Unexpected observations %+v", o)
+	}
+
+	at1 := NewOutputSpec()
+	at1.NPerformers[beh0.Uuid] = 5
+	at2 := NewOutputSpec()
+	at2.NPerformers[beh0.Uuid] = 4
+	at2.NPerformers[beh1.Uuid] = 2
+	summary := &OutputSpecs{
+		LastTick:   2,
+		StopReason: StopReasonConverged,
+		Data:       map[b.SimTime]OutputSpec{1: *at1, 2: *at2},
+	}
+
+	// Tick 3 is after the last tick of a converged simulation, so tick 2 is
+	// used.
+	distance, err := o.Distance(summary, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := math.Sqrt((0.0 + 0.04 + 0.04) / 3)
+	if math.Abs(distance-expected) > 1e-12 {
+		t.Errorf("Distance should be %f; it was %f", expected, distance)
+	}
+
+	summary.StopReason = StopReasonCancelled
+	summary.Truncated = true
+	_, err = o.Distance(summary, 10)
+	if err == nil {
+		t.Error("Expected an error for a tick after the last tick of a cancelled simulation")
+	}
+
+	for _, invalid := range []string{
+		beh0.Name + "\n0.5\n",
+		"tick,unknown\n1,0.5\n",
+		"tick," + beh0.Name + "\n1,1.5\n",
+		"tick," + beh0.Name + "\nx,0.5\n",
+	} {
+		_, err := ReadObservations(strings.NewReader(invalid), c.Behaviours)
+		if err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
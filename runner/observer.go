@@ -0,0 +1,41 @@
+package runner
+
+import (
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// Observer observes the simulation while it is being run by a Runner.
+//
+// Every callback is given the time of the tick, and the agents in the
+// simulation. The agents must not be modified by an Observer.
+type Observer interface {
+	// OnTickStart is called at the start of a tick, before the agents perceive
+	// beliefs.
+	OnTickStart(time b.SimTime, agents []*b.Agent)
+	// OnBeliefsPerceived is called once every agent has updated the activation
+	// of its beliefs.
+	OnBeliefsPerceived(time b.SimTime, agents []*b.Agent)
+	// OnActionsPerformed is called once every agent has performed an action.
+	OnActionsPerformed(time b.SimTime, agents []*b.Agent)
+	// OnTickEnd is called at the end of a tick, before any history of the
+	// agents is forgotten.
+	OnTickEnd(time b.SimTime, agents []*b.Agent)
+}
+
+// BaseObserver is an Observer which does nothing.
+//
+// It may be embedded in another type, so that type only needs to implement the
+// callbacks it is interested in.
+type BaseObserver struct{}
+
+// OnTickStart does nothing.
+func (BaseObserver) OnTickStart(b.SimTime, []*b.Agent) {}
+
+// OnBeliefsPerceived does nothing.
+func (BaseObserver) OnBeliefsPerceived(b.SimTime, []*b.Agent) {}
+
+// OnActionsPerformed does nothing.
+func (BaseObserver) OnActionsPerformed(b.SimTime, []*b.Agent) {}
+
+// OnTickEnd does nothing.
+func (BaseObserver) OnTickEnd(b.SimTime, []*b.Agent) {}
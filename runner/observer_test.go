@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"go.uber.org/zap"
+)
+
+type recordingObserver struct {
+	calls []string
+}
+
+func (o *recordingObserver) OnTickStart(b.SimTime, []*b.Agent) {
+	o.calls = append(o.calls, "start")
+}
+
+func (o *recordingObserver) OnBeliefsPerceived(b.SimTime, []*b.Agent) {
+	o.calls = append(o.calls, "perceived")
+}
+
+func (o *recordingObserver) OnActionsPerformed(b.SimTime, []*b.Agent) {
+	o.calls = append(o.calls, "performed")
+}
+
+func (o *recordingObserver) OnTickEnd(b.SimTime, []*b.Agent) {
+	o.calls = append(o.calls, "end")
+}
+
+func TestObserversAreNotifiedInOrder(t *testing.T) {
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.EndTime = 1
+	o1 := new(recordingObserver)
+	o2 := new(recordingObserver)
+	r.AddObserver(o1)
+	r.AddObserver(o2)
+
+	_, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"start", "perceived", "performed", "end"}
+	for _, o := range []*recordingObserver{o1, o2} {
+		if len(o.calls) != len(expected) {
+			t.Fatalf("calls should be %v; it was %v", expected, o.calls)
+		}
+		for i := range expected {
+			if o.calls[i] != expected[i] {
+				t.Errorf("calls should be %v; it was %v", expected, o.calls)
+			}
+		}
+	}
+}
+
+type stoppingObserver struct {
+	BaseObserver
+	runner *Runner
+	stopAt b.SimTime
+	ticks  int
+}
+
+func (o *stoppingObserver) OnTickEnd(time b.SimTime, _ []*b.Agent) {
+	o.ticks++
+	if time == o.stopAt {
+		o.runner.Stop()
+	}
+}
+
+func TestStopEndsSimulationAtEndOfTick(t *testing.T) {
+	r := &Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	o := &stoppingObserver{runner: r, stopAt: 2}
+	r.AddObserver(o)
+
+	_, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.ticks != 2 {
+		t.Errorf("ticks should be 2; it was %d", o.ticks)
+	}
+
+	if _, found := r.Configuration.Agents[0].Actions[2]; !found {
+		t.Error("Agent should have performed an action at time 2")
+	}
+
+	if _, found := r.Configuration.Agents[0].Actions[3]; found {
+		t.Error("Agent should not have performed an action at time 3")
+	}
+}
@@ -0,0 +1,265 @@
+package runner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+// OutputFormat is a format in which the output of a simulation is written.
+type OutputFormat string
+
+const (
+	// OutputFormatJson is the OutputSpecs as zstd-compressed JSON.
+	OutputFormatJson OutputFormat = "json"
+	// OutputFormatCsv is a tidy CSV table, with a row for each statistic of
+	// each belief and behaviour at each tick.
+	OutputFormatCsv OutputFormat = "csv"
+	// OutputFormatTsv is OutputFormatCsv, separated by tabs.
+	OutputFormatTsv OutputFormat = "tsv"
+	// OutputFormatParquet is the table of OutputFormatCsv as Apache Parquet.
+	//
+	// This is also a format of the full output, written by WriteParquetState.
+	OutputFormatParquet OutputFormat = "parquet"
+	// OutputFormatArrow is the table of OutputFormatCsv as an Apache Arrow
+	// IPC file.
+	//
+	// This is also a format of the full output, written by WriteArrowAgents.
+	OutputFormatArrow OutputFormat = "arrow"
+	// OutputFormatArrowStream is OutputFormatArrow as an Arrow IPC stream.
+	OutputFormatArrowStream OutputFormat = "arrow-stream"
+	// OutputFormatSqlite is a SQLite database, written by WriteSqliteRun
+	// rather than to an io.Writer.
+	OutputFormatSqlite OutputFormat = "sqlite"
+)
+
+// OutputFormats are the supported OutputFormats.
+var OutputFormats = []OutputFormat{
+	OutputFormatJson,
+	OutputFormatCsv,
+	OutputFormatTsv,
+	OutputFormatParquet,
+	OutputFormatArrow,
+	OutputFormatArrowStream,
+	OutputFormatSqlite,
+}
+
+// ParseOutputFormat gets the OutputFormat with the name s.
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	for _, format := range OutputFormats {
+		if string(format) == s {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q (expected one of %v)", s, OutputFormats)
+}
+
+// WriteSummary writes the summary statistics of a simulation to w in the
+// format, which is OutputFormatJson if it is empty.
+//
+// The behaviours and beliefs name the entities of the tidy formats.
+func WriteSummary(
+	w io.Writer,
+	summary *OutputSpecs,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	format OutputFormat,
+) error {
+	switch format {
+	case "", OutputFormatJson:
+		return writeCompressedJson(w, summary)
+	case OutputFormatCsv:
+		return WriteTidySummary(w, summary, behaviours, beliefs, ',')
+	case OutputFormatTsv:
+		return WriteTidySummary(w, summary, behaviours, beliefs, '\t')
+	case OutputFormatParquet:
+		return writeParquetSummary(w, summary, behaviours, beliefs)
+	case OutputFormatArrow:
+		return writeArrowSummary(w, summary, behaviours, beliefs, false)
+	case OutputFormatArrowStream:
+		return writeArrowSummary(w, summary, behaviours, beliefs, true)
+	case OutputFormatSqlite:
+		return errors.New("the sqlite output format is written to a database by WriteSqliteRun")
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// ReadOutputSpecs reads the summary statistics written by WriteSummary in
+// OutputFormatJson.
+func ReadOutputSpecs(r io.Reader) (*OutputSpecs, error) {
+	zstdDecoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zstdDecoder.Close()
+
+	summary := new(OutputSpecs)
+	err = json.NewDecoder(zstdDecoder).Decode(summary)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// tidyRow is a statistic of a belief or behaviour at a tick.
+type tidyRow struct {
+	Tick       b.SimTime
+	EntityType string
+	EntityUuid uuid.UUID
+	EntityName string
+	Statistic  string
+	// The value of the statistic, which is NaN if it is missing from the
+	// summary.
+	Value float64
+}
+
+// tidyHeader is the names of the columns of a tidy table written by
+// WriteTidySummary.
+var tidyHeader = []string{
+	"tick",
+	"entityType",
+	"entityUuid",
+	"entityName",
+	"statistic",
+	"value",
+	"seed",
+	"truncated",
+	"lastTick",
+	"stopReason",
+}
+
+// forEachTidyRow calls f with every statistic of summary, in order of tick,
+// then the order of beliefs and behaviours.
+//
+// Each belief has the statistics meanActivation, sdActivation,
+// medianActivation and nonzeroActivationCount, and each behaviour has
+// nPerformers. Counts which are missing from the summary are 0.
+func forEachTidyRow(
+	summary *OutputSpecs,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	f func(tidyRow) error,
+) error {
+	ticks := make([]b.SimTime, 0, len(summary.Data))
+	for time := range summary.Data {
+		ticks = append(ticks, time)
+	}
+	sort.Slice(ticks, func(i, j int) bool { return ticks[i] < ticks[j] })
+
+	value := func(m map[uuid.UUID]float64, u uuid.UUID) float64 {
+		v, found := m[u]
+		if !found {
+			return math.NaN()
+		}
+		return v
+	}
+
+	for _, time := range ticks {
+		spec := summary.Data[time]
+		for _, belief := range beliefs {
+			for _, statistic := range []struct {
+				name  string
+				value float64
+			}{
+				{"meanActivation", value(spec.MeanActivation, belief.Uuid)},
+				{"sdActivation", value(spec.SDActivation, belief.Uuid)},
+				{"medianActivation", value(spec.MedianActivation, belief.Uuid)},
+				{"nonzeroActivationCount", float64(spec.NonzeroActivationCount[belief.Uuid])},
+			} {
+				err := f(tidyRow{
+					Tick:       time,
+					EntityType: "belief",
+					EntityUuid: belief.Uuid,
+					EntityName: belief.Name,
+					Statistic:  statistic.name,
+					Value:      statistic.value,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, behaviour := range behaviours {
+			err := f(tidyRow{
+				Tick:       time,
+				EntityType: "behaviour",
+				EntityUuid: behaviour.Uuid,
+				EntityName: behaviour.Name,
+				Statistic:  "nPerformers",
+				Value:      float64(spec.NPerformers[behaviour.Uuid]),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteTidySummary writes the summary statistics of a simulation to w as a
+// tidy, or long-format, table separated by comma, which can be loaded
+// directly into R or pandas.
+//
+// The columns are tick, entityType ("belief" or "behaviour"), entityUuid,
+// entityName, statistic and value, with a row for each statistic of each
+// belief and behaviour at each tick. Values which are missing from the summary
+// are left empty.
+//
+// The seed, truncated, lastTick and stopReason columns are the same in every
+// row, and record how the simulation stopped, so a truncated simulation is not
+// mistaken for a complete one with an earlier end time.
+func WriteTidySummary(
+	w io.Writer,
+	summary *OutputSpecs,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	comma rune,
+) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+
+	err := writer.Write(tidyHeader)
+	if err != nil {
+		return err
+	}
+
+	seed := strconv.FormatInt(summary.Seed, 10)
+	truncated := strconv.FormatBool(summary.Truncated)
+	lastTick := strconv.FormatUint(uint64(summary.LastTick), 10)
+
+	err = forEachTidyRow(summary, behaviours, beliefs, func(row tidyRow) error {
+		value := ""
+		if !math.IsNaN(row.Value) {
+			value = strconv.FormatFloat(row.Value, 'g', -1, 64)
+		}
+		return writer.Write([]string{
+			strconv.FormatUint(uint64(row.Tick), 10),
+			row.EntityType,
+			row.EntityUuid.String(),
+			row.EntityName,
+			row.Statistic,
+			value,
+			seed,
+			truncated,
+			lastTick,
+			string(summary.StopReason),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,135 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+func newTestSummary() (*OutputSpecs, []*b.Behaviour, []*b.Belief) {
+	behaviour := b.NewBehaviour("behaviour")
+	behaviour.Uuid = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	belief := b.NewBelief("belief")
+	belief.Uuid = uuid.MustParse("00000000-0000-0000-0000-000000000002")
+
+	summary := &OutputSpecs{
+		Seed:       3,
+		LastTick:   2,
+		StopReason: StopReasonCompleted,
+		Data: map[b.SimTime]OutputSpec{
+			2: {
+				MeanActivation:         map[uuid.UUID]float64{belief.Uuid: 0.25},
+				SDActivation:           map[uuid.UUID]float64{},
+				MedianActivation:       map[uuid.UUID]float64{belief.Uuid: 0.5},
+				NonzeroActivationCount: map[uuid.UUID]uint64{belief.Uuid: 2},
+				NPerformers:            map[uuid.UUID]uint64{},
+			},
+			1: {
+				MeanActivation:         map[uuid.UUID]float64{belief.Uuid: 0.125},
+				SDActivation:           map[uuid.UUID]float64{belief.Uuid: 0},
+				MedianActivation:       map[uuid.UUID]float64{belief.Uuid: 0.125},
+				NonzeroActivationCount: map[uuid.UUID]uint64{belief.Uuid: 1},
+				NPerformers:            map[uuid.UUID]uint64{behaviour.Uuid: 2},
+			},
+		},
+	}
+
+	return summary, []*b.Behaviour{behaviour}, []*b.Belief{belief}
+}
+
+func TestWriteTidySummary(t *testing.T) {
+	summary, behaviours, beliefs := newTestSummary()
+
+	var buf bytes.Buffer
+	err := WriteSummary(&buf, summary, behaviours, beliefs, OutputFormatTsv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	belief := "\tbelief\t00000000-0000-0000-0000-000000000002\tbelief\t"
+	behaviour := "\tbehaviour\t00000000-0000-0000-0000-000000000001\tbehaviour\t"
+	stop := "\t3\tfalse\t2\tcompleted\n"
+	expected := "tick\tentityType\tentityUuid\tentityName\tstatistic\tvalue\tseed\ttruncated\tlastTick\tstopReason\n" +
+		"1" + belief + "meanActivation\t0.125" + stop +
+		"1" + belief + "sdActivation\t0" + stop +
+		"1" + belief + "medianActivation\t0.125" + stop +
+		"1" + belief + "nonzeroActivationCount\t1" + stop +
+		"1" + behaviour + "nPerformers\t2" + stop +
+		"2" + belief + "meanActivation\t0.25" + stop +
+		"2" + belief + "sdActivation\t" + stop +
+		"2" + belief + "medianActivation\t0.5" + stop +
+		"2" + belief + "nonzeroActivationCount\t2" + stop +
+		"2" + behaviour + "nPerformers\t0" + stop
+	if buf.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteTidySummaryRecordsTruncation(t *testing.T) {
+	summary, behaviours, beliefs := newTestSummary()
+	delete(summary.Data, 2)
+	summary.Truncated = true
+	summary.LastTick = 1
+	summary.StopReason = StopReasonCancelled
+
+	var buf bytes.Buffer
+	err := WriteSummary(&buf, summary, behaviours, beliefs, OutputFormatCsv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 6 {
+		t.Fatalf("Expected a header and 5 rows, got %d rows", len(rows))
+	}
+
+	columns := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	for _, row := range rows[1:] {
+		if row[columns["seed"]] != "3" ||
+			row[columns["truncated"]] != "true" ||
+			row[columns["lastTick"]] != "1" ||
+			row[columns["stopReason"]] != "cancelled" {
+			t.Errorf("Expected every row to record the truncation, got %v", row)
+		}
+	}
+}
+
+func TestReadOutputSpecsReadsJsonSummary(t *testing.T) {
+	summary, behaviours, beliefs := newTestSummary()
+
+	var buf bytes.Buffer
+	err := WriteSummary(&buf, summary, behaviours, beliefs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadOutputSpecs(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, summary) {
+		t.Errorf("Expected %+v, got %+v", summary, read)
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	format, err := ParseOutputFormat("csv")
+	if err != nil || format != OutputFormatCsv {
+		t.Errorf("Expected csv, got %q, %v", format, err)
+	}
+
+	_, err = ParseOutputFormat("xml")
+	if err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
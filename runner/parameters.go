@@ -0,0 +1,212 @@
+package runner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// Parameters are overrides of the parameters of a scenario, keyed by the name of
+// the parameter.
+//
+// The parameters are:
+//   - "deltaScale", which multiplies the delta of every belief of every agent,
+//     or "deltaScale:<belief>", which multiplies the deltas of one belief;
+//   - "friendWeightScale", which multiplies the weight of every friend of every
+//     agent;
+//   - "prs:<belief>:<behaviour>", which sets a performance relationship;
+//   - "perception:<belief>:<behaviour>", which sets the perception of a belief
+//     to a behaviour; and
+//   - "startTime" and "endTime", which set the start and end times, and must be
+//     non-negative integers.
+//
+// Beliefs and behaviours are referred to by name or by UUID.
+type Parameters map[string]float64
+
+// Apply the Parameters to a Configuration.
+//
+// Parameters are applied in order of name, so the result does not depend on the
+// order of the map. The agents and beliefs of c are modified, so c must not
+// share them with another Configuration.
+func (p Parameters) Apply(c *Configuration) error {
+	for _, name := range sortedKeys(p) {
+		err := applyParameter(c, name, p[name])
+		if err != nil {
+			return fmt.Errorf("invalid parameter %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// CheckParameters checks that every parameter of points is valid for c, and
+// that no two names set the same parameter, such as a belief referred to by its
+// name in one point and by its UUID in another, so that each parameter has one
+// column in a table of the points.
+func CheckParameters(points []Parameters, c *Configuration) error {
+	names := make(map[parameter]string)
+	for _, point := range points {
+		for _, name := range sortedKeys(point) {
+			target, err := resolveParameter(c, name)
+			if err != nil {
+				return fmt.Errorf("invalid parameter %q: %w", name, err)
+			}
+			if other, found := names[target]; found && other != name {
+				return fmt.Errorf("parameters %q and %q set the same parameter", other, name)
+			}
+			names[target] = name
+		}
+	}
+	return nil
+}
+
+// parameter is a parameter of a scenario, which its name is resolved to.
+type parameter struct {
+	// The first part of the name, such as "prs".
+	kind string
+	// The belief of the parameter, or nil if it has none, or is deltaScale of
+	// every belief.
+	belief *b.Belief
+	// The behaviour of the parameter, or nil if it has none.
+	behaviour *b.Behaviour
+}
+
+// resolveParameter gets the parameter of a Configuration with the name.
+func resolveParameter(c *Configuration, name string) (parameter, error) {
+	parts := strings.Split(name, ":")
+	p := parameter{kind: parts[0]}
+
+	switch parts[0] {
+	case "deltaScale":
+		if len(parts) == 2 {
+			p.belief = findBelief(c.Beliefs, parts[1])
+			if p.belief == nil {
+				return p, fmt.Errorf("unknown belief %q", parts[1])
+			}
+		} else if len(parts) != 1 {
+			return p, fmt.Errorf("expected deltaScale or deltaScale:<belief>")
+		}
+	case "friendWeightScale", "startTime", "endTime":
+		if len(parts) != 1 {
+			return p, fmt.Errorf("expected %s", parts[0])
+		}
+	case "prs", "perception":
+		if len(parts) != 3 {
+			return p, fmt.Errorf("expected %s:<belief>:<behaviour>", parts[0])
+		}
+		p.belief = findBelief(c.Beliefs, parts[1])
+		if p.belief == nil {
+			return p, fmt.Errorf("unknown belief %q", parts[1])
+		}
+		p.behaviour = findBehaviour(c.Behaviours, parts[2])
+		if p.behaviour == nil {
+			return p, fmt.Errorf("unknown behaviour %q", parts[2])
+		}
+	default:
+		return p, fmt.Errorf("unknown parameter")
+	}
+
+	return p, nil
+}
+
+// applyParameter applies a single parameter to a Configuration.
+func applyParameter(c *Configuration, name string, value float64) error {
+	p, err := resolveParameter(c, name)
+	if err != nil {
+		return err
+	}
+
+	switch p.kind {
+	case "deltaScale":
+		for _, agent := range c.Agents {
+			for belief := range agent.Deltas {
+				if p.belief == nil || belief == p.belief {
+					agent.Deltas[belief] *= value
+				}
+			}
+		}
+	case "friendWeightScale":
+		for _, agent := range c.Agents {
+			for friend := range agent.Friends {
+				agent.Friends[friend] *= value
+			}
+		}
+	case "perception":
+		p.belief.Perception[p.behaviour] = value
+	case "prs":
+		if c.Prs == nil {
+			c.Prs = make(PerformanceRelationships)
+		}
+		if c.Prs[p.belief] == nil {
+			c.Prs[p.belief] = make(map[*b.Behaviour]float64)
+		}
+		c.Prs[p.belief][p.behaviour] = value
+	case "startTime", "endTime":
+		if value < 0 || value > math.MaxUint32 || value != math.Trunc(value) {
+			return fmt.Errorf("%g is not a valid time", value)
+		}
+		if p.kind == "startTime" {
+			c.StartTime = b.SimTime(value)
+		} else {
+			c.EndTime = b.SimTime(value)
+		}
+	}
+
+	return nil
+}
+
+// findBelief finds the belief with the specified name or UUID, or nil.
+func findBelief(beliefs []*b.Belief, nameOrUuid string) *b.Belief {
+	for _, belief := range beliefs {
+		if belief.Name == nameOrUuid || belief.Uuid.String() == nameOrUuid {
+			return belief
+		}
+	}
+	return nil
+}
+
+// findBehaviour finds the behaviour with the specified name or UUID, or nil.
+func findBehaviour(behaviours []*b.Behaviour, nameOrUuid string) *b.Behaviour {
+	for _, behaviour := range behaviours {
+		if behaviour.Name == nameOrUuid || behaviour.Uuid.String() == nameOrUuid {
+			return behaviour
+		}
+	}
+	return nil
+}
+
+// Grid gets every combination of the values of each parameter.
+//
+// values[i] are the values of names[i]. The combinations are ordered with the
+// last parameter varying fastest.
+func Grid(names []string, values [][]float64) []Parameters {
+	points := []Parameters{{}}
+	for i, name := range names {
+		var next []Parameters
+		for _, point := range points {
+			for _, v := range values[i] {
+				p := make(Parameters, len(point)+1)
+				for k, v2 := range point {
+					p[k] = v2
+				}
+				p[name] = v
+				next = append(next, p)
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// sortedKeys gets the keys of a map, such as the names of Parameters, in
+// order.
+func sortedKeys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
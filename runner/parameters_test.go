@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParametersApply(t *testing.T) {
+	c := newRandomConfiguration(1, 10, 2)
+	belief := c.Beliefs[0]
+	behaviour := c.Behaviours[1]
+	agent := c.Agents[0]
+	delta := agent.Deltas[belief]
+	otherDelta := agent.Deltas[c.Beliefs[1]]
+	var friendWeight float64
+	for _, w := range agent.Friends {
+		friendWeight += w
+	}
+
+	p := Parameters{
+		"deltaScale:" + belief.Name:                  0.5,
+		"friendWeightScale":                          2,
+		"prs:" + belief.Name + ":" + behaviour.Name:  0.25,
+		"perception:" + belief.Uuid.String() + ":b1": -0.75,
+		"startTime": 2,
+		"endTime":   7,
+	}
+
+	err := p.Apply(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if agent.Deltas[belief] != delta*0.5 {
+		t.Errorf("Delta should be %f; it was %f", delta*0.5, agent.Deltas[belief])
+	}
+
+	if agent.Deltas[c.Beliefs[1]] != otherDelta {
+		t.Errorf("Delta of other belief should be unchanged")
+	}
+
+	var newFriendWeight float64
+	for _, w := range agent.Friends {
+		newFriendWeight += w
+	}
+	if newFriendWeight != friendWeight*2 {
+		t.Errorf("Friend weights should be doubled")
+	}
+
+	if c.Prs[belief][behaviour] != 0.25 {
+		t.Errorf("PRS should be 0.25; it was %f", c.Prs[belief][behaviour])
+	}
+
+	if belief.Perception[c.Behaviours[0]] != -0.75 {
+		t.Errorf("Perception should be -0.75; it was %f", belief.Perception[c.Behaviours[0]])
+	}
+
+	if c.StartTime != 2 || c.EndTime != 7 {
+		t.Errorf("Times should be 2 and 7; they were %d and %d", c.StartTime, c.EndTime)
+	}
+}
+
+func TestParametersApplyInvalid(t *testing.T) {
+	for _, p := range []Parameters{
+		{"unknown": 1},
+		{"deltaScale:unknown": 1},
+		{"prs:bel1": 1},
+		{"perception:bel1:unknown": 1},
+		{"endTime": 1.5},
+		{"startTime": -1},
+	} {
+		err := p.Apply(newRandomConfiguration(1, 10, 2))
+		if err == nil {
+			t.Errorf("Expected error for %v", p)
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	points := Grid([]string{"a", "b"}, [][]float64{{1, 2}, {3, 4, 5}})
+
+	expected := []Parameters{
+		{"a": 1, "b": 3},
+		{"a": 1, "b": 4},
+		{"a": 1, "b": 5},
+		{"a": 2, "b": 3},
+		{"a": 2, "b": 4},
+		{"a": 2, "b": 5},
+	}
+
+	if !reflect.DeepEqual(points, expected) {
+		t.Errorf("points should be %v; they were %v", expected, points)
+	}
+}
+
+func TestCheckParameters(t *testing.T) {
+	c := newRandomConfiguration(1, 10, 2)
+	belief := c.Beliefs[0]
+
+	err := CheckParameters([]Parameters{
+		{"deltaScale": 2, "deltaScale:" + belief.Name: 0.5},
+		{"deltaScale:" + belief.Name: 1},
+	}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckParameters([]Parameters{
+		{"deltaScale:" + belief.Name: 0.5},
+		{"deltaScale:" + belief.Uuid.String(): 1},
+	}, c)
+	if err == nil {
+		t.Error("Expected an error for a belief referred to by name and UUID")
+	}
+
+	err = CheckParameters([]Parameters{{"prs:unknown:b0": 1}}, c)
+	if err == nil {
+		t.Error("Expected an error for an unknown belief")
+	}
+}
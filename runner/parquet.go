@@ -0,0 +1,253 @@
+package runner
+
+import (
+	"io"
+	"math"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/parquet-go/parquet-go"
+)
+
+// The number of rows buffered before they are written to a Parquet writer.
+const parquetBatchSize = 4096
+
+// ParquetActivation is a row of the activations table of the Parquet full
+// output: the activation of a belief of an agent at a tick.
+type ParquetActivation struct {
+	Tick       uint32  `parquet:"tick,delta"`
+	Agent      string  `parquet:"agent"`
+	Belief     string  `parquet:"belief,dict"`
+	BeliefName string  `parquet:"beliefName,dict"`
+	Activation float64 `parquet:"activation"`
+}
+
+// ParquetAction is a row of the actions table of the Parquet full output: the
+// behaviour performed by an agent at a tick.
+type ParquetAction struct {
+	Tick          uint32 `parquet:"tick,delta"`
+	Agent         string `parquet:"agent"`
+	Behaviour     string `parquet:"behaviour,dict"`
+	BehaviourName string `parquet:"behaviourName,dict"`
+}
+
+// parquetSummaryRow is a row of the Parquet summary output, which is the tidy
+// table written by WriteTidySummary.
+type parquetSummaryRow struct {
+	Tick       uint32   `parquet:"tick,delta"`
+	EntityType string   `parquet:"entityType,dict"`
+	EntityUuid string   `parquet:"entityUuid,dict"`
+	EntityName string   `parquet:"entityName,dict"`
+	Statistic  string   `parquet:"statistic,dict"`
+	Value      *float64 `parquet:"value,optional"`
+}
+
+// parquetTableWriter writes the rows of a Parquet table in batches, with a
+// row group for each tick.
+type parquetTableWriter[T any] struct {
+	writer *parquet.GenericWriter[T]
+	rows   []T
+	// Whether any rows have been written since the last row group.
+	pending bool
+}
+
+func newParquetTableWriter[T any](w io.Writer, metadata map[string]string) *parquetTableWriter[T] {
+	options := []parquet.WriterOption{parquet.Compression(&parquet.Zstd)}
+	for _, key := range sortedKeys(metadata) {
+		options = append(options, parquet.KeyValueMetadata(key, metadata[key]))
+	}
+	return &parquetTableWriter[T]{
+		writer: parquet.NewGenericWriter[T](w, options...),
+		rows:   make([]T, 0, parquetBatchSize),
+	}
+}
+
+// write adds a row to the current row group.
+func (t *parquetTableWriter[T]) write(row T) error {
+	t.rows = append(t.rows, row)
+	t.pending = true
+	if len(t.rows) < parquetBatchSize {
+		return nil
+	}
+	return t.writeRows()
+}
+
+func (t *parquetTableWriter[T]) writeRows() error {
+	_, err := t.writer.Write(t.rows)
+	t.rows = t.rows[:0]
+	return err
+}
+
+// endRowGroup writes the rows since the last row group as a row group, if
+// there are any.
+func (t *parquetTableWriter[T]) endRowGroup() error {
+	if !t.pending {
+		return nil
+	}
+	err := t.writeRows()
+	if err != nil {
+		return err
+	}
+	t.pending = false
+	return t.writer.Flush()
+}
+
+// close ends the last row group, and writes the footer of the table.
+func (t *parquetTableWriter[T]) close() error {
+	err := t.endRowGroup()
+	if err != nil {
+		t.writer.Close()
+		return err
+	}
+	return t.writer.Close()
+}
+
+// WriteParquetState writes the activations and actions of the agents at every
+// tick of their history as two Parquet tables, with rows of
+// ParquetActivation and ParquetAction.
+//
+// Each table has a row group for each tick, ordered by agent then belief
+// within the tick, so readers can scan only the ticks and beliefs they need.
+// UUIDs are written as strings. The actions table is not written if actions is
+// nil.
+//
+// metadata is written as the key-value metadata of both tables, such as the
+// StopMetadata of the simulation, and may be nil.
+func WriteParquetState(
+	activations io.Writer,
+	actions io.Writer,
+	agents []*b.Agent,
+	beliefs []*b.Belief,
+	metadata map[string]string,
+) error {
+	activationTicks := make(map[b.SimTime]bool)
+	actionTicks := make(map[b.SimTime]bool)
+	for _, a := range agents {
+		for time := range a.Activations {
+			activationTicks[time] = true
+		}
+		for time := range a.Actions {
+			actionTicks[time] = true
+		}
+	}
+
+	table := newParquetTableWriter[ParquetActivation](activations, metadata)
+	for _, time := range sortedTickSet(activationTicks) {
+		for _, a := range agents {
+			acts := a.Activations[time]
+			if acts == nil {
+				continue
+			}
+			agentUuid := a.Uuid.String()
+			for _, belief := range beliefs {
+				activation, found := acts[belief]
+				if !found {
+					continue
+				}
+				err := table.write(ParquetActivation{
+					Tick:       uint32(time),
+					Agent:      agentUuid,
+					Belief:     belief.Uuid.String(),
+					BeliefName: belief.Name,
+					Activation: activation,
+				})
+				if err != nil {
+					table.close()
+					return err
+				}
+			}
+		}
+		err := table.endRowGroup()
+		if err != nil {
+			table.close()
+			return err
+		}
+	}
+	err := table.close()
+	if err != nil {
+		return err
+	}
+
+	if actions == nil {
+		return nil
+	}
+
+	actionTable := newParquetTableWriter[ParquetAction](actions, metadata)
+	for _, time := range sortedTickSet(actionTicks) {
+		for _, a := range agents {
+			behaviour := a.Actions[time]
+			if behaviour == nil {
+				continue
+			}
+			err := actionTable.write(ParquetAction{
+				Tick:          uint32(time),
+				Agent:         a.Uuid.String(),
+				Behaviour:     behaviour.Uuid.String(),
+				BehaviourName: behaviour.Name,
+			})
+			if err != nil {
+				actionTable.close()
+				return err
+			}
+		}
+		err := actionTable.endRowGroup()
+		if err != nil {
+			actionTable.close()
+			return err
+		}
+	}
+	return actionTable.close()
+}
+
+// writeParquetSummary writes the tidy table of WriteTidySummary to w as
+// Parquet, with a row group for each tick. Missing values are null.
+//
+// The StopMetadata of summary is written as the key-value metadata of the
+// table, rather than as columns.
+func writeParquetSummary(
+	w io.Writer,
+	summary *OutputSpecs,
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+) error {
+	table := newParquetTableWriter[parquetSummaryRow](w, StopMetadata(summary))
+	first := true
+	var tick b.SimTime
+	err := forEachTidyRow(summary, behaviours, beliefs, func(row tidyRow) error {
+		if !first && row.Tick != tick {
+			err := table.endRowGroup()
+			if err != nil {
+				return err
+			}
+		}
+		first = false
+		tick = row.Tick
+
+		var value *float64
+		if !math.IsNaN(row.Value) {
+			value = &row.Value
+		}
+		return table.write(parquetSummaryRow{
+			Tick:       uint32(row.Tick),
+			EntityType: row.EntityType,
+			EntityUuid: row.EntityUuid.String(),
+			EntityName: row.EntityName,
+			Statistic:  row.Statistic,
+			Value:      value,
+		})
+	})
+	if err != nil {
+		table.close()
+		return err
+	}
+	return table.close()
+}
+
+// sortedTickSet gets the ticks in a set in increasing order.
+func sortedTickSet(ticks map[b.SimTime]bool) []b.SimTime {
+	sorted := make([]b.SimTime, 0, len(ticks))
+	for time := range ticks {
+		sorted = append(sorted, time)
+	}
+	sortTimes(sorted)
+	return sorted
+}
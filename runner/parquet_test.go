@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/parquet-go/parquet-go"
+)
+
+// readParquet reads every row of a Parquet table, and its number of row
+// groups.
+func readParquet[T any](t *testing.T, data []byte) ([]T, int) {
+	t.Helper()
+
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := parquet.NewGenericReader[T](bytes.NewReader(data))
+	defer reader.Close()
+
+	rows := make([]T, reader.NumRows())
+	n, err := reader.Read(rows)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+
+	return rows[:n], len(file.RowGroups())
+}
+
+func TestWriteParquetStateHasRowGroupPerTick(t *testing.T) {
+	_, behaviour, belief, agents := newTestFullOutput(t)
+
+	var activations, actions bytes.Buffer
+	err := WriteParquetState(&activations, &actions, agents, []*b.Belief{belief}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activationRows, rowGroups := readParquet[ParquetActivation](t, activations.Bytes())
+	if len(activationRows) != 15 || rowGroups != 5 {
+		t.Fatalf("Expected 15 activations in 5 row groups, got %d in %d", len(activationRows), rowGroups)
+	}
+	expected := ParquetActivation{
+		Tick:       3,
+		Agent:      agents[1].Uuid.String(),
+		Belief:     belief.Uuid.String(),
+		BeliefName: "belief",
+		Activation: 0.3,
+	}
+	if activationRows[10] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, activationRows[10])
+	}
+
+	actionRows, rowGroups := readParquet[ParquetAction](t, actions.Bytes())
+	if len(actionRows) != 15 || rowGroups != 5 {
+		t.Fatalf("Expected 15 actions in 5 row groups, got %d in %d", len(actionRows), rowGroups)
+	}
+	if actionRows[0].Tick != 0 || actionRows[0].Agent != agents[0].Uuid.String() || actionRows[0].BehaviourName != behaviour.Name {
+		t.Errorf("Unexpected action %+v", actionRows[0])
+	}
+}
+
+func TestWriteSummaryAsParquet(t *testing.T) {
+	summary, behaviours, beliefs := newTestSummary()
+
+	var buf bytes.Buffer
+	err := WriteSummary(&buf, summary, behaviours, beliefs, OutputFormatParquet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, rowGroups := readParquet[parquetSummaryRow](t, buf.Bytes())
+	if len(rows) != 10 || rowGroups != 2 {
+		t.Fatalf("Expected 10 rows in 2 row groups, got %d in %d", len(rows), rowGroups)
+	}
+	if rows[0].Statistic != "meanActivation" || rows[0].Value == nil || *rows[0].Value != 0.125 {
+		t.Errorf("Unexpected row %+v", rows[0])
+	}
+	if rows[6].Statistic != "sdActivation" || rows[6].Value != nil {
+		t.Errorf("Expected a missing value to be null, got %+v", rows[6])
+	}
+
+	file, err := parquet.OpenFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range StopMetadata(summary) {
+		value, found := file.Lookup(key)
+		if !found || value != expected {
+			t.Errorf("Expected %s to be %q in the metadata, got %q", key, expected, value)
+		}
+	}
+	if value, _ := file.Lookup("seed"); value != "3" {
+		t.Errorf("Expected the seed 3 in the metadata, got %q", value)
+	}
+}
@@ -0,0 +1,51 @@
+package runner
+
+// partition assigns each node of a graph in compressed sparse row form to one
+// of nShards shards, returning the shard of each node.
+//
+// The shards differ in size by at most one node. Each shard is grown breadth
+// first from the lowest numbered unassigned node, following the friends of each
+// node, so friends tend to be in the same shard and few actions need to be
+// exchanged between shards.
+func partition(offsets []int, columns []int32, nShards int) []int {
+	n := len(offsets) - 1
+	shards := make([]int, n)
+	for i := range shards {
+		shards[i] = -1
+	}
+
+	next := 0
+	var queue []int32
+	for s := 0; s < nShards; s++ {
+		size := n / nShards
+		if s < n%nShards {
+			size++
+		}
+
+		queue = queue[:0]
+		for count := 0; count < size; {
+			if len(queue) == 0 {
+				for shards[next] != -1 {
+					next++
+				}
+				queue = append(queue, int32(next))
+			}
+
+			node := queue[0]
+			queue = queue[1:]
+			if shards[node] != -1 {
+				continue
+			}
+			shards[node] = s
+			count++
+
+			for _, friend := range columns[offsets[node]:offsets[node+1]] {
+				if shards[friend] == -1 {
+					queue = append(queue, friend)
+				}
+			}
+		}
+	}
+
+	return shards
+}
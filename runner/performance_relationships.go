@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"fmt"
+
 	b "github.com/0xr0bert/gobelief/beliefspread"
 	"github.com/google/uuid"
 )
@@ -22,17 +24,49 @@ func PRSSpecToPerformanceRelationships(
 	prss []PerformanceRelationshipSpec,
 	beliefs map[uuid.UUID]*b.Belief,
 	behaviours map[uuid.UUID]*b.Behaviour,
+) PerformanceRelationships {
+	return prsSpecToPerformanceRelationships(prss, beliefs, behaviours, nil)
+}
+
+// PRSSpecToPerformanceRelationshipsStrict is PRSSpecToPerformanceRelationships,
+// but returns an *UnresolvedReferencesError if any spec is of an unknown belief
+// or behaviour.
+func PRSSpecToPerformanceRelationshipsStrict(
+	prss []PerformanceRelationshipSpec,
+	beliefs map[uuid.UUID]*b.Belief,
+	behaviours map[uuid.UUID]*b.Behaviour,
+) (PerformanceRelationships, error) {
+	refs := new(UnresolvedReferencesError)
+	prs := prsSpecToPerformanceRelationships(prss, beliefs, behaviours, refs)
+	return prs, refs.orNil()
+}
+
+// prsSpecToPerformanceRelationships converts the specs, adding any unresolved
+// references to refs, which may be nil.
+func prsSpecToPerformanceRelationships(
+	prss []PerformanceRelationshipSpec,
+	beliefs map[uuid.UUID]*b.Belief,
+	behaviours map[uuid.UUID]*b.Behaviour,
+	refs *UnresolvedReferencesError,
 ) PerformanceRelationships {
 	prs := make(PerformanceRelationships)
-	for _, spec := range prss {
+	for i, spec := range prss {
+		holder := fmt.Sprintf("performance relationship %d", i)
 		belief := beliefs[spec.BeliefUuid]
+		if belief == nil {
+			refs.add(holder, "beliefUuid", "belief", spec.BeliefUuid)
+		}
+		behaviour := behaviours[spec.BehaviourUuid]
+		if behaviour == nil {
+			refs.add(holder, "behaviourUuid", "behaviour", spec.BehaviourUuid)
+		}
+
 		if belief != nil {
 			_, found := prs[belief]
 			if !found {
 				prs[belief] = make(map[*b.Behaviour]float64)
 			}
 
-			behaviour := behaviours[spec.BehaviourUuid]
 			if behaviour != nil {
 				prs[belief][behaviour] = spec.Value
 			}
@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// The number of references listed by UnresolvedReferencesError.Error.
+const maxListedReferences = 20
+
+// UnresolvedReference is a reference to a UUID which is not the UUID of any
+// behaviour, belief or agent.
+type UnresolvedReference struct {
+	// What holds the reference, such as "agent <uuid>".
+	Holder string
+	// The field of the holder with the reference, such as "friends".
+	Field string
+	// The kind of thing referred to: "behaviour", "belief" or "agent".
+	Kind string
+	// The UUID which does not resolve.
+	Uuid uuid.UUID
+}
+
+func (r UnresolvedReference) String() string {
+	return fmt.Sprintf("%s %s: unknown %s %v", r.Holder, r.Field, r.Kind, r.Uuid)
+}
+
+// UnresolvedReferencesError is returned by the strict loading functions,
+// listing every reference which does not resolve.
+//
+// The lenient loading functions silently ignore these references.
+type UnresolvedReferencesError struct {
+	References []UnresolvedReference
+}
+
+func (e *UnresolvedReferencesError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d unresolved references: ", len(e.References))
+	for i, r := range e.References {
+		if i == maxListedReferences {
+			fmt.Fprintf(&sb, "; and %d more", len(e.References)-i)
+			break
+		}
+		if i != 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(r.String())
+	}
+	return sb.String()
+}
+
+// add adds a reference, unless e is nil, in which case references are being
+// ignored.
+func (e *UnresolvedReferencesError) add(holder, field, kind string, u uuid.UUID) {
+	if e != nil {
+		e.References = append(e.References, UnresolvedReference{
+			Holder: holder,
+			Field:  field,
+			Kind:   kind,
+			Uuid:   u,
+		})
+	}
+}
+
+// Merge adds the references of err to e if it is an
+// *UnresolvedReferencesError, and otherwise returns err.
+//
+// This is used to list the unresolved references of every spec in a file.
+func (e *UnresolvedReferencesError) Merge(err error) error {
+	other, ok := err.(*UnresolvedReferencesError)
+	if !ok {
+		return err
+	}
+	e.References = append(e.References, other.References...)
+	return nil
+}
+
+// orNil gets e as an error, or nil if there are no references.
+func (e *UnresolvedReferencesError) orNil() error {
+	if len(e.References) == 0 {
+		return nil
+	}
+	return e
+}
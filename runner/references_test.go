@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func TestStrictLoadingListsUnresolvedReferences(t *testing.T) {
+	behaviour := b.NewBehaviour("behaviour")
+	belief := b.NewBelief("belief")
+	unknown := uuid.MustParse("00000000-0000-0000-0000-000000000009")
+
+	beliefSpec := BeliefSpec{
+		Name:          "belief",
+		Uuid:          belief.Uuid,
+		Perceptions:   map[uuid.UUID]float64{behaviour.Uuid: 0.5, unknown: 0.5},
+		Relationships: map[uuid.UUID]float64{belief.Uuid: 1, unknown: 1},
+	}
+	_, err := beliefSpec.ToBeliefStrict([]*b.Behaviour{behaviour})
+	var refs *UnresolvedReferencesError
+	if !errors.As(err, &refs) || len(refs.References) != 1 {
+		t.Fatalf("Expected 1 unresolved perception, got %v", err)
+	}
+	if beliefSpec.ToBelief([]*b.Behaviour{behaviour}) == nil {
+		t.Error("ToBelief should ignore unresolved references")
+	}
+
+	err = beliefSpec.LinkBeliefRelationshipsStrict([]*b.Belief{belief})
+	expected := UnresolvedReference{
+		Holder: `belief "belief" (` + belief.Uuid.String() + ")",
+		Field:  "relationships",
+		Kind:   "belief",
+		Uuid:   unknown,
+	}
+	if !errors.As(err, &refs) || !reflect.DeepEqual(refs.References, []UnresolvedReference{expected}) {
+		t.Errorf("Unexpected unresolved relationships %v", err)
+	}
+
+	agentSpec := AgentSpec{
+		Uuid:        uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Actions:     map[b.SimTime]uuid.UUID{0: behaviour.Uuid, 1: unknown},
+		Activations: map[b.SimTime]map[uuid.UUID]float64{0: {belief.Uuid: 0.5, unknown: 0.5}},
+		Deltas:      map[uuid.UUID]float64{unknown: 1},
+		Friends:     map[uuid.UUID]float64{unknown: 1},
+	}
+	agent, err := agentSpec.ToAgentStrict([]*b.Behaviour{behaviour}, []*b.Belief{belief})
+	if !errors.As(err, &refs) || len(refs.References) != 3 {
+		t.Fatalf("Expected 3 unresolved references, got %v", err)
+	}
+	fields := []string{refs.References[0].Field, refs.References[1].Field, refs.References[2].Field}
+	if !reflect.DeepEqual(fields, []string{"actions at 1", "activations at 0", "deltas"}) {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+
+	err = agentSpec.LinkFriendsStrict(map[uuid.UUID]*b.Agent{agentSpec.Uuid: agent})
+	if !errors.As(err, &refs) || refs.References[0].Kind != "agent" || refs.References[0].Uuid != unknown {
+		t.Errorf("Unexpected unresolved friends %v", err)
+	}
+
+	prs := []PerformanceRelationshipSpec{
+		{BeliefUuid: belief.Uuid, BehaviourUuid: behaviour.Uuid, Value: 1},
+		{BeliefUuid: unknown, BehaviourUuid: unknown, Value: 1},
+	}
+	_, err = PRSSpecToPerformanceRelationshipsStrict(
+		prs,
+		map[uuid.UUID]*b.Belief{belief.Uuid: belief},
+		map[uuid.UUID]*b.Behaviour{behaviour.Uuid: behaviour},
+	)
+	if !errors.As(err, &refs) || len(refs.References) != 2 {
+		t.Errorf("Expected 2 unresolved references, got %v", err)
+	}
+
+	all := new(UnresolvedReferencesError)
+	for i := 0; i < 25; i++ {
+		if all.Merge(refs) != nil {
+			t.Fatal("Merge should accept an *UnresolvedReferencesError")
+		}
+	}
+	if !strings.HasPrefix(all.Error(), "50 unresolved references: ") || !strings.HasSuffix(all.Error(), "; and 30 more") {
+		t.Errorf("Unexpected message %q", all.Error())
+	}
+	if all.Merge(errors.New("other")) == nil {
+		t.Error("Merge should return other errors")
+	}
+}
+
+func TestShardedRunnerStrict(t *testing.T) {
+	c := newShardedTestConfiguration(2)
+	c.Strict = true
+	agents := c.Agents
+	unknown := uuid.MustParse("00000000-0000-0000-0000-000000000009")
+	c.Agents = func(f func(*AgentSpec) error) error {
+		first := true
+		return agents(func(spec *AgentSpec) error {
+			if first {
+				spec.Friends[unknown] = 1
+				first = false
+			}
+			return f(spec)
+		})
+	}
+
+	r := ShardedRunner{Configuration: c, Logger: zap.NewNop()}
+	_, err := r.Run()
+	var refs *UnresolvedReferencesError
+	if !errors.As(err, &refs) || len(refs.References) != 1 || refs.References[0].Uuid != unknown {
+		t.Errorf("Expected the unknown friend to be unresolved, got %v", err)
+	}
+}
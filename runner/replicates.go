@@ -0,0 +1,275 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// DefaultPercentiles are the percentiles calculated by AggregateReplicates if
+// none are specified.
+var DefaultPercentiles = []float64{2.5, 25, 50, 75, 97.5}
+
+// Replicates runs independent replicates of a simulation concurrently, such as
+// with different seeds.
+type Replicates struct {
+	// NewConfiguration creates the Configuration of a replicate, numbered from
+	// 0. Replicates are run concurrently, so each Configuration must have its
+	// own agents.
+	NewConfiguration func(replicate int) (*Configuration, error)
+	// The number of replicates.
+	N int
+	// The maximum number of replicates which are run at once, or 0 to run
+	// every replicate at once.
+	Concurrency int
+	// The logger of each Runner.
+	Logger *zap.Logger
+}
+
+// Run the replicates.
+//
+// This returns the Result of every replicate, and the first error creating the
+// configuration of, or running, any replicate.
+func (r *Replicates) Run() ([]*Result, error) {
+	return r.RunContext(context.Background())
+}
+
+// RunContext runs the replicates with Runner.RunContext, so every replicate
+// stops when ctx is done.
+//
+// This returns the Result of every replicate, and the first error creating the
+// configuration of, or running, any replicate.
+func (r *Replicates) RunContext(ctx context.Context) ([]*Result, error) {
+	results, errs := r.runAll(ctx)
+	for _, err := range errs {
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// runAll runs the replicates, returning the Result of, and the error creating
+// the configuration of or running, each replicate.
+func (r *Replicates) runAll(ctx context.Context) ([]*Result, []error) {
+	concurrency := r.Concurrency
+	if concurrency <= 0 || concurrency > r.N {
+		concurrency = r.N
+	}
+
+	results := make([]*Result, r.N)
+	errs := make([]error, r.N)
+	replicates := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range replicates {
+				results[i], errs[i] = r.runReplicate(ctx, i)
+			}
+		}()
+	}
+
+	for i := 0; i < r.N; i++ {
+		replicates <- i
+	}
+	close(replicates)
+	wg.Wait()
+
+	return results, errs
+}
+
+// runReplicate runs a single replicate.
+func (r *Replicates) runReplicate(ctx context.Context, i int) (*Result, error) {
+	config, err := r.NewConfiguration(i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replicate %d: %w", i, err)
+	}
+
+	runner := Runner{
+		Configuration: config,
+		Logger:        r.Logger.With(zap.Int("Replicate", i)),
+	}
+	result, err := runner.RunContext(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to run replicate %d: %w", i, err)
+	}
+	return result, nil
+}
+
+// Distribution summarises the distribution of a statistic across replicates.
+type Distribution struct {
+	// The number of replicates with the statistic.
+	N int `json:"n"`
+	// The mean of the statistic.
+	Mean float64 `json:"mean"`
+	// The sample standard deviation of the statistic, or 0 if N is 1.
+	SD float64 `json:"sd"`
+	// The value of the statistic at each of AggregateOutputSpecs.Percentiles.
+	Percentiles []float64 `json:"percentiles"`
+}
+
+// AggregateOutputSpec is the distribution of every statistic of OutputSpec
+// across replicates, at a single tick.
+type AggregateOutputSpec struct {
+	MeanActivation         map[uuid.UUID]Distribution `json:"meanActivation"`
+	SDActivation           map[uuid.UUID]Distribution `json:"sdActivation"`
+	MedianActivation       map[uuid.UUID]Distribution `json:"medianActivation"`
+	NonzeroActivationCount map[uuid.UUID]Distribution `json:"nonzeroActivationCount"`
+	NPerformers            map[uuid.UUID]Distribution `json:"nPerformers"`
+}
+
+// AggregateOutputSpecs is the distribution of the summary statistics of
+// replicates of a simulation.
+type AggregateOutputSpecs struct {
+	// The seed of each replicate.
+	Seeds []int64 `json:"seeds"`
+	// Whether any replicate was cancelled before its end time.
+	Truncated bool `json:"truncated"`
+	// The last tick completed by each replicate.
+	LastTicks []b.SimTime `json:"lastTicks"`
+	// Why each replicate stopped.
+	StopReasons []StopReason `json:"stopReasons"`
+	// The percentiles of each Distribution, in [0, 100].
+	Percentiles []float64 `json:"percentiles"`
+	// The distribution of the statistics at each tick completed by any
+	// replicate.
+	Data map[b.SimTime]AggregateOutputSpec `json:"data"`
+	// The summary statistics of each replicate, if they are kept.
+	Replicates []*OutputSpecs `json:"replicates,omitempty"`
+}
+
+// WriteAggregateOutputSpecs writes the distribution of the summary statistics of
+// replicates to w as zstd-compressed JSON.
+func WriteAggregateOutputSpecs(w io.Writer, a *AggregateOutputSpecs) error {
+	return writeCompressedJson(w, a)
+}
+
+// AggregateReplicates calculates the distribution of the summary statistics of
+// replicates at every tick, with the specified percentiles, or
+// DefaultPercentiles if there are none.
+//
+// Replicates which stopped early contribute only to the ticks they completed,
+// and how each stopped is recorded, so the aggregate of a truncated replicate
+// is Truncated. At the ticks a replicate completed, a behaviour or belief missing from the NPerformers or
+// NonzeroActivationCount of a replicate counts as 0.
+func AggregateReplicates(replicates []*OutputSpecs, percentiles []float64) *AggregateOutputSpecs {
+	if len(percentiles) == 0 {
+		percentiles = DefaultPercentiles
+	}
+
+	a := &AggregateOutputSpecs{
+		Seeds:       make([]int64, len(replicates)),
+		LastTicks:   make([]b.SimTime, len(replicates)),
+		StopReasons: make([]StopReason, len(replicates)),
+		Percentiles: percentiles,
+		Data:        make(map[b.SimTime]AggregateOutputSpec),
+	}
+
+	ticks := make(map[b.SimTime][]OutputSpec)
+	for i, replicate := range replicates {
+		a.Seeds[i] = replicate.Seed
+		a.Truncated = a.Truncated || replicate.Truncated
+		a.LastTicks[i] = replicate.LastTick
+		a.StopReasons[i] = replicate.StopReason
+		for time, spec := range replicate.Data {
+			ticks[time] = append(ticks[time], spec)
+		}
+	}
+
+	for time, specs := range ticks {
+		a.Data[time] = AggregateOutputSpec{
+			MeanActivation: aggregate(specs, percentiles, false, func(o OutputSpec) map[uuid.UUID]float64 {
+				return o.MeanActivation
+			}),
+			SDActivation: aggregate(specs, percentiles, false, func(o OutputSpec) map[uuid.UUID]float64 {
+				return o.SDActivation
+			}),
+			MedianActivation: aggregate(specs, percentiles, false, func(o OutputSpec) map[uuid.UUID]float64 {
+				return o.MedianActivation
+			}),
+			NonzeroActivationCount: aggregate(specs, percentiles, true, func(o OutputSpec) map[uuid.UUID]uint64 {
+				return o.NonzeroActivationCount
+			}),
+			NPerformers: aggregate(specs, percentiles, true, func(o OutputSpec) map[uuid.UUID]uint64 {
+				return o.NPerformers
+			}),
+		}
+	}
+
+	return a
+}
+
+// aggregate calculates the distribution of a statistic of specs for each UUID.
+//
+// If missingIsZero, a UUID missing from the statistic of a spec counts as 0,
+// and otherwise it is omitted.
+func aggregate[T float64 | uint64](
+	specs []OutputSpec,
+	percentiles []float64,
+	missingIsZero bool,
+	statistic func(OutputSpec) map[uuid.UUID]T,
+) map[uuid.UUID]Distribution {
+	uuids := make(map[uuid.UUID]bool)
+	for _, spec := range specs {
+		for u := range statistic(spec) {
+			uuids[u] = true
+		}
+	}
+
+	distributions := make(map[uuid.UUID]Distribution, len(uuids))
+	for u := range uuids {
+		var values []float64
+		for _, spec := range specs {
+			value, found := statistic(spec)[u]
+			if found || missingIsZero {
+				values = append(values, float64(value))
+			}
+		}
+		distributions[u] = newDistribution(values, percentiles)
+	}
+	return distributions
+}
+
+// newDistribution summarises the distribution of values, which is reordered.
+//
+// Percentiles are interpolated linearly between the closest ranks.
+func newDistribution(values []float64, percentiles []float64) Distribution {
+	d := Distribution{
+		N:           len(values),
+		Percentiles: make([]float64, len(percentiles)),
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	d.Mean = sum / float64(d.N)
+
+	if d.N > 1 {
+		ss := 0.0
+		for _, v := range values {
+			ss += math.Pow(v-d.Mean, 2.0)
+		}
+		d.SD = math.Sqrt(ss / float64(d.N-1))
+	}
+
+	sort.Float64s(values)
+	for k, p := range percentiles {
+		rank := p / 100 * float64(d.N-1)
+		lo := int(math.Floor(rank))
+		hi := int(math.Ceil(rank))
+		d.Percentiles[k] = values[lo] + (rank-float64(lo))*(values[hi]-values[lo])
+	}
+
+	return d
+}
@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func TestNewDistribution(t *testing.T) {
+	d := newDistribution([]float64{5, 1, 4, 2, 3}, []float64{0, 25, 50, 90, 100})
+
+	if d.N != 5 {
+		t.Errorf("d.N should be 5; it was %d", d.N)
+	}
+
+	if d.Mean != 3 {
+		t.Errorf("d.Mean should be 3; it was %f", d.Mean)
+	}
+
+	if math.Abs(d.SD-math.Sqrt(2.5)) > 1e-12 {
+		t.Errorf("d.SD should be %f; it was %f", math.Sqrt(2.5), d.SD)
+	}
+
+	expected := []float64{1, 2, 3, 4.6, 5}
+	for k, p := range expected {
+		if math.Abs(d.Percentiles[k]-p) > 1e-12 {
+			t.Errorf("d.Percentiles[%d] should be %f; it was %f", k, p, d.Percentiles[k])
+		}
+	}
+}
+
+func TestAggregateReplicatesCountsMissingPerformersAsZero(t *testing.T) {
+	behaviour := uuid.New()
+	belief := uuid.New()
+	replicates := make([]*OutputSpecs, 2)
+	for i := range replicates {
+		o := NewOutputSpec()
+		o.MeanActivation[belief] = float64(i)
+		if i == 1 {
+			o.NPerformers[behaviour] = 4
+		}
+		replicates[i] = &OutputSpecs{
+			Seed:       int64(i),
+			LastTick:   1,
+			StopReason: StopReasonCompleted,
+			Data:       map[b.SimTime]OutputSpec{1: *o},
+		}
+	}
+	// The second replicate stopped early.
+	replicates[0].Data[2] = *NewOutputSpec()
+	replicates[0].LastTick = 2
+	replicates[1].Truncated = true
+	replicates[1].StopReason = StopReasonCancelled
+
+	a := AggregateReplicates(replicates, nil)
+
+	if !reflect.DeepEqual(a.Seeds, []int64{0, 1}) {
+		t.Errorf("a.Seeds should be [0 1]; it was %v", a.Seeds)
+	}
+
+	if !a.Truncated {
+		t.Error("a should be truncated, as a replicate was cancelled")
+	}
+
+	if !reflect.DeepEqual(a.LastTicks, []b.SimTime{2, 1}) {
+		t.Errorf("a.LastTicks should be [2 1]; it was %v", a.LastTicks)
+	}
+
+	if !reflect.DeepEqual(a.StopReasons, []StopReason{StopReasonCompleted, StopReasonCancelled}) {
+		t.Errorf("a.StopReasons should be [completed cancelled]; it was %v", a.StopReasons)
+	}
+
+	if !reflect.DeepEqual(a.Percentiles, DefaultPercentiles) {
+		t.Errorf("a.Percentiles should be %v; it was %v", DefaultPercentiles, a.Percentiles)
+	}
+
+	performers := a.Data[1].NPerformers[behaviour]
+	if performers.N != 2 || performers.Mean != 2 {
+		t.Errorf("NPerformers should have N 2 and mean 2; it was %+v", performers)
+	}
+
+	mean := a.Data[1].MeanActivation[belief]
+	if mean.N != 2 || mean.Mean != 0.5 {
+		t.Errorf("MeanActivation should have N 2 and mean 0.5; it was %+v", mean)
+	}
+
+	if len(a.Data[2].NPerformers) != 0 {
+		t.Errorf("There should be no NPerformers at tick 2")
+	}
+}
+
+func TestReplicatesRun(t *testing.T) {
+	r := Replicates{
+		NewConfiguration: func(replicate int) (*Configuration, error) {
+			c := newRandomConfiguration(1, 50, 3)
+			seed := int64(replicate % 2)
+			c.Seed = &seed
+			return c, nil
+		},
+		N:           4,
+		Concurrency: 2,
+		Logger:      zap.NewNop(),
+	}
+
+	results, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 4 {
+		t.Fatalf("There should be 4 results; there were %d", len(results))
+	}
+
+	for i, result := range results {
+		if result.Summary.Seed != int64(i%2) {
+			t.Errorf("Seed of replicate %d should be %d; it was %d", i, i%2, result.Summary.Seed)
+		}
+	}
+
+	if !reflect.DeepEqual(results[0].Summary, results[2].Summary) {
+		t.Error("Replicates with the same seed should have the same summary")
+	}
+}
@@ -0,0 +1,35 @@
+package runner
+
+import (
+	"time"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+)
+
+// Result is the result of running the simulation.
+type Result struct {
+	// The summary statistics at every tick which was completed.
+	Summary *OutputSpecs
+	// The number of agents which failed to update the activation of their
+	// beliefs at each tick.
+	FailedUpdates map[b.SimTime]uint64
+	// How long each tick took to run.
+	TickDurations map[b.SimTime]time.Duration
+	// How long the simulation took to run, including writing the output.
+	Duration time.Duration
+}
+
+func newResult() *Result {
+	return &Result{
+		FailedUpdates: make(map[b.SimTime]uint64),
+		TickDurations: make(map[b.SimTime]time.Duration),
+	}
+}
+
+// TotalFailedUpdates gets the total number of failed updates across every tick.
+func (res *Result) TotalFailedUpdates() (total uint64) {
+	for _, n := range res.FailedUpdates {
+		total += n
+	}
+	return
+}
@@ -1,12 +1,21 @@
 package runner
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"math/rand"
-	"os"
 	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/dense"
+	"github.com/google/uuid"
 	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 )
@@ -25,22 +34,152 @@ type Configuration struct {
 	StartTime b.SimTime
 	// The end time of the simulation (inclusive).
 	EndTime b.SimTime
-	// The output file.
-	OutputFile *os.File
+	// The number of ticks from the start time which are simulated before the
+	// output begins, so the simulation can warm up.
+	//
+	// The summary statistics, convergence and full output only include the
+	// ticks from StartTime+BurnIn, and the state of the agents at the end of
+	// the burn-in.
+	BurnIn b.SimTime
+	// Where the state of the agents at the end of the burn-in is written, or
+	// nil if it should not be written.
+	//
+	// This is written as an agents file, with the activations and actions of
+	// each agent at tick StartTime+BurnIn-1 only, so it can be used as the
+	// initial state of a simulation which starts at StartTime+BurnIn.
+	BurnInStateFile io.Writer
+	// Where the output is written, or nil if no output should be written.
+	//
+	// This is usually an *os.File, but may be any io.Writer.
+	OutputFile io.Writer
 	// Whether to serialize the full state of agents, or just summary stats.
+	//
+	// The Parquet and Arrow full output record whether the simulation was
+	// truncated as their StopMetadata. The JSON full output is an agents
+	// file, which does not, so the SummaryOutputFile should be set with it.
 	FullOutput bool
+	// Where the summary output is also written, as zstd-compressed JSON, when
+	// FullOutput is set, or nil if it should not be written.
+	SummaryOutputFile io.Writer
+	// The format in which the output is written, which is OutputFormatJson
+	// if it is empty.
+	//
+	// The full output may only be OutputFormatJson, OutputFormatParquet,
+	// OutputFormatArrow or OutputFormatArrowStream, and OutputFormatSqlite
+	// cannot be written to the OutputFile.
+	OutputFormat OutputFormat
+	// Where the actions table of the full output is written when the
+	// OutputFormat is OutputFormatParquet, or nil if it should not be written.
+	//
+	// The OutputFile has the activations table.
+	ActionsOutputFile io.Writer
+	// The number of most recent ticks of each agent's history to retain, or 0
+	// to retain the full history.
+	//
+	// The model only uses the previous tick, so 1 is the smallest useful
+	// value.
+	HistoryLength uint32
+	// When HistoryLength is non-zero, also retain every tick which is a
+	// multiple of SnapshotInterval, so that it is included in the full output.
+	//
+	// If this is 0, no snapshots are retained.
+	SnapshotInterval uint32
+	// When to stop the simulation before the end time because it has
+	// converged, or nil to always run until the end time.
+	Convergence *ConvergenceCriterion
+	// The storage engine used to run the simulation.
+	Engine Engine
+	// The precision with which the DenseEngine stores the state of the
+	// simulation.
+	Precision dense.Precision
+	// The seed from which the random numbers used to choose behaviours are
+	// derived.
+	//
+	// The random number used by an agent at a tick depends only on the seed,
+	// the UUID of the agent and the tick, so it does not depend on the order
+	// in which agents are simulated, or on which process simulates them.
+	//
+	// If this is nil, a random seed is chosen, so the simulation is a
+	// different realisation each time it is run. The seed which was used is
+	// recorded in the summary output either way.
+	Seed *int64
 }
 
+// StopReason is the reason the simulation stopped.
+type StopReason string
+
+const (
+	// StopReasonCompleted means the simulation reached its end time.
+	StopReasonCompleted StopReason = "completed"
+	// StopReasonConverged means the simulation met its ConvergenceCriterion.
+	StopReasonConverged StopReason = "converged"
+	// StopReasonStopped means Runner.Stop was called.
+	StopReasonStopped StopReason = "stopped"
+	// StopReasonCancelled means the context of the simulation was done.
+	StopReasonCancelled StopReason = "cancelled"
+)
+
 // Runner defines the runner of the simulation.
 type Runner struct {
 	// The configuration.
 	Configuration *Configuration
 	// The logger.
 	Logger *zap.Logger
+	// The observers, which are notified in order as the simulation runs.
+	Observers []Observer
+	// The result of the simulation, calculated as it runs.
+	result *Result
+	// The summary statistics, calculated as the simulation runs.
+	summary *OutputSpecs
+	// The convergence detector, or nil if there is no ConvergenceCriterion.
+	convergence *convergenceDetector
+	// The dense model, or nil if the MapEngine is used.
+	model *dense.Model
+	// Whether the maps of the agents are written to at every tick by the
+	// dense model.
+	syncAgents bool
+	// Whether Stop has been called.
+	stopped atomic.Bool
+	// The seed of the simulation, which is chosen at random if the
+	// Configuration has none.
+	seed int64
+}
+
+// AddObserver registers an Observer with the Runner.
+func (r *Runner) AddObserver(o Observer) {
+	r.Observers = append(r.Observers, o)
+}
+
+// Stop the simulation at the end of the current tick.
+//
+// The output is still written for every tick which has been completed. This
+// may be called by an Observer, or from another goroutine.
+func (r *Runner) Stop() {
+	r.stopped.Store(true)
 }
 
 // Run the simulation.
-func (r *Runner) Run() {
+//
+// This returns the Result of the simulation, and any error writing the output.
+func (r *Runner) Run() (*Result, error) {
+	return r.RunContext(context.Background())
+}
+
+// RunContext runs the simulation until the end time, or until ctx is done.
+//
+// ctx is checked at the start of every tick. If it is done, the simulation
+// stops and the output is written for every tick which has been completed. The
+// summary output records that it was truncated, and the last tick completed.
+// So does the metadata of the Parquet and Arrow full output, as its
+// StopMetadata, and the SummaryOutputFile written with the full output.
+//
+// The summary output also records why the simulation stopped, as a StopReason.
+//
+// This returns the Result of the simulation, and any errors writing the output
+// and the BurnInStateFile, joined. Cancelling ctx is not an error, but a ConvergenceCriterion with a Window of 0
+// is, and nothing is simulated.
+func (r *Runner) RunContext(ctx context.Context) (*Result, error) {
+	start := time.Now()
 	r.Logger.Info(
 		"Running simulation",
 		zap.Uint32("Start", uint32(r.Configuration.StartTime)),
@@ -49,11 +188,75 @@ func (r *Runner) Run() {
 		zap.Uint32("n behaviours", uint32(len(r.Configuration.Behaviours))),
 		zap.Uint32("n agents", uint32(len(r.Configuration.Agents))),
 	)
-	r.tickBetween(r.Configuration.StartTime, r.Configuration.EndTime)
-	r.Logger.Info("Ending simulation")
+	r.result = newResult()
+	r.seed = chooseSeed(r.Configuration.Seed)
+	r.summary = &OutputSpecs{
+		Seed:     r.seed,
+		LastTick: r.Configuration.StartTime - 1,
+		Data:     make(map[b.SimTime]OutputSpec),
+	}
+	r.stopped.Store(false)
+	r.convergence = nil
+	if r.Configuration.Convergence != nil {
+		var err error
+		r.convergence, err = newConvergenceDetector(
+			*r.Configuration.Convergence,
+			r.Configuration.Beliefs,
+			r.Configuration.Behaviours,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.model = nil
+	if r.Configuration.Engine == DenseEngine {
+		r.model = dense.NewWithPrecision(
+			r.Configuration.Agents,
+			r.Configuration.Beliefs,
+			r.Configuration.Behaviours,
+			r.Configuration.Prs,
+			r.Configuration.StartTime-1,
+			r.Configuration.Precision,
+		)
+		r.syncAgents = r.Configuration.FullOutput || len(r.Observers) != 0
+	}
+	outputStart := r.Configuration.StartTime + r.Configuration.BurnIn
+	r.summary.StopReason = StopReasonCompleted
+	var burnInErr error
+	if r.Configuration.BurnIn != 0 {
+		r.Logger.Info("Burning in", zap.Uint32("Output start", uint32(outputStart)))
+		burnInEnd := outputStart - 1
+		if burnInEnd > r.Configuration.EndTime {
+			burnInEnd = r.Configuration.EndTime
+		}
+		r.summary.StopReason = r.tickBetween(ctx, r.Configuration.StartTime, burnInEnd)
+		if r.summary.StopReason == StopReasonCompleted {
+			burnInErr = r.endBurnIn(burnInEnd)
+		}
+	}
+	if r.summary.StopReason == StopReasonCompleted {
+		r.summary.StopReason = r.tickBetween(ctx, outputStart, r.Configuration.EndTime)
+	}
+	if r.model != nil && !r.syncAgents && r.model.Time() != r.Configuration.StartTime-1 {
+		r.model.WriteActivations()
+		r.model.WriteActions()
+	}
+	r.summary.Truncated = r.summary.StopReason == StopReasonCancelled
+	r.Logger.Info(
+		"Ending simulation",
+		zap.Uint32("Last tick", uint32(r.summary.LastTick)),
+		zap.String("Stop reason", string(r.summary.StopReason)),
+	)
+	r.result.Summary = r.summary
+
 	var err error
-	if r.Configuration.FullOutput {
+	if r.Configuration.OutputFile == nil {
+		r.Logger.Info("No output file")
+	} else if r.Configuration.FullOutput {
 		err = r.serializeFullOutput()
+		if err == nil && r.Configuration.SummaryOutputFile != nil {
+			err = writeCompressedJson(r.Configuration.SummaryOutputFile, r.summary)
+		}
 	} else {
 		err = r.serializeOutput()
 	}
@@ -64,18 +267,102 @@ func (r *Runner) Run() {
 			zap.Error(err),
 		)
 	}
+	err = errors.Join(err, burnInErr)
+
+	r.result.Duration = time.Since(start)
+	return r.result, err
+}
+
+// Log that the output is being written to the output file.
+func (r *Runner) logWritingOutput() {
+	f, ok := r.Configuration.OutputFile.(interface{ Name() string })
+	if ok {
+		r.Logger.Info("Writing output to file", zap.String("File", f.Name()))
+	} else {
+		r.Logger.Info("Writing output")
+	}
+}
+
+// StopMetadata gets how the simulation of summary stopped, as the metadata
+// recorded in the Parquet and Arrow output: its seed, whether it was
+// truncated, the last tick completed, and the StopReason, keyed by their names
+// in the summary output.
+func StopMetadata(summary *OutputSpecs) map[string]string {
+	return map[string]string{
+		"seed":       strconv.FormatInt(summary.Seed, 10),
+		"truncated":  strconv.FormatBool(summary.Truncated),
+		"lastTick":   strconv.FormatUint(uint64(summary.LastTick), 10),
+		"stopReason": string(summary.StopReason),
+	}
 }
 
 // Serialize the full state of agents as the output.
 //
-// This is stored as a zstd-compressed JSON file.
+// This is stored as a zstd-compressed JSON file, as Parquet tables of the
+// activations and actions of the agents if the OutputFormat is
+// OutputFormatParquet, or as an Arrow table of agents if it is
+// OutputFormatArrow or OutputFormatArrowStream. The Parquet and Arrow tables
+// have the StopMetadata of the simulation as their metadata.
 func (r *Runner) serializeFullOutput() error {
-	r.Logger.Info(
-		"Writing output to file",
-		zap.String("File", r.Configuration.OutputFile.Name()),
-	)
+	r.logWritingOutput()
+	metadata := StopMetadata(r.summary)
+
+	switch r.Configuration.OutputFormat {
+	case "", OutputFormatJson:
+		return writeAgentSpecs(r.Configuration.OutputFile, r.Configuration.Agents, NewAgentSpecFromAgent)
+	case OutputFormatParquet:
+		return WriteParquetState(
+			r.Configuration.OutputFile,
+			r.Configuration.ActionsOutputFile,
+			r.Configuration.Agents,
+			r.Configuration.Beliefs,
+			metadata,
+		)
+	case OutputFormatArrow, OutputFormatArrowStream:
+		return WriteArrowAgents(
+			r.Configuration.OutputFile,
+			r.Configuration.Agents,
+			r.Configuration.OutputFormat == OutputFormatArrowStream,
+			metadata,
+		)
+	default:
+		return fmt.Errorf("the full output cannot be written as %s", r.Configuration.OutputFormat)
+	}
+}
+
+// endBurnIn forgets the history of the agents before the last tick of the
+// burn-in, and writes their state at that tick to the BurnInStateFile.
+func (r *Runner) endBurnIn(time b.SimTime) error {
+	stateFile := r.Configuration.BurnInStateFile
+	if r.model != nil && !r.syncAgents && stateFile != nil {
+		r.model.WriteActivations()
+		r.model.WriteActions()
+	}
 
-	zstdEncoder, err := zstd.NewWriter(r.Configuration.OutputFile)
+	if time > 0 {
+		for _, a := range r.Configuration.Agents {
+			a.ForgetHistory(time-1, nil)
+		}
+	}
+
+	if stateFile == nil {
+		return nil
+	}
+
+	r.Logger.Info("Writing burn-in state", zap.Uint32("Day", uint32(time)))
+	err := writeAgentSpecs(stateFile, r.Configuration.Agents, func(a *b.Agent) *AgentSpec {
+		return newAgentSpecAtTime(a, time)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write burn-in state: %w", err)
+	}
+	return nil
+}
+
+// writeAgentSpecs writes the spec of every agent to w as a zstd-compressed
+// JSON array.
+func writeAgentSpecs(w io.Writer, agents []*b.Agent, newSpec func(*b.Agent) *AgentSpec) error {
+	zstdEncoder, err := zstd.NewWriter(w)
 
 	if err != nil {
 		return err
@@ -89,11 +376,11 @@ func (r *Runner) serializeFullOutput() error {
 
 	encoder := json.NewEncoder(zstdEncoder)
 
-	nAgents := len(r.Configuration.Agents)
+	nAgents := len(agents)
 	lastAgent := nAgents - 1
 
-	for i, a := range r.Configuration.Agents {
-		err = encoder.Encode(NewAgentSpecFromAgent(a))
+	for i, a := range agents {
+		err = encoder.Encode(newSpec(a))
 		if err != nil {
 			err2 := zstdEncoder.Close()
 			if err2 != nil {
@@ -128,6 +415,9 @@ func (r *Runner) serializeFullOutput() error {
 
 // Serialize summary statistics about the agents.
 //
+// The statistics are calculated as the simulation runs, so this does not need
+// the history of the agents. They are also included in the Result.
+//
 // This calculates:
 // - the number of agents performing each behaviour;
 // - the mean activation for each belief;
@@ -135,21 +425,21 @@ func (r *Runner) serializeFullOutput() error {
 // - the median activation for each belief; and
 // - the number of agents who have non-zero activation for each belief.
 //
-// This is stored as a zstd-compressed JSON file.
+// This is stored in the OutputFormat of the Configuration.
 func (r *Runner) serializeOutput() error {
-	specs := NewOutputSpecs(
-		r.Configuration.Agents,
+	r.logWritingOutput()
+	return WriteSummary(
+		r.Configuration.OutputFile,
+		r.summary,
+		r.Configuration.Behaviours,
 		r.Configuration.Beliefs,
-		r.Configuration.StartTime,
-		r.Configuration.EndTime,
-	)
-
-	r.Logger.Info(
-		"Writing output to file",
-		zap.String("File", r.Configuration.OutputFile.Name()),
+		r.Configuration.OutputFormat,
 	)
+}
 
-	zstdEncoder, err := zstd.NewWriter(r.Configuration.OutputFile)
+// writeCompressedJson writes v to w as zstd-compressed JSON.
+func writeCompressedJson(w io.Writer, v any) error {
+	zstdEncoder, err := zstd.NewWriter(w)
 
 	if err != nil {
 		return err
@@ -157,7 +447,7 @@ func (r *Runner) serializeOutput() error {
 
 	encoder := json.NewEncoder(zstdEncoder)
 
-	err = encoder.Encode(&specs)
+	err = encoder.Encode(v)
 	if err != nil {
 		err2 := zstdEncoder.Close()
 		if err2 != nil {
@@ -172,51 +462,143 @@ func (r *Runner) serializeOutput() error {
 	return nil
 }
 
-// Tick between two times (inclusive).
-func (r *Runner) tickBetween(start, end b.SimTime) {
+// Tick between two times (inclusive), or until the Runner is stopped, ctx is
+// done, or the simulation converges.
+func (r *Runner) tickBetween(ctx context.Context, start, end b.SimTime) StopReason {
 	for i := start; i <= end; i++ {
+		if err := ctx.Err(); err != nil {
+			r.Logger.Warn(
+				"Simulation cancelled",
+				zap.Uint32("Day", uint32(i)),
+				zap.Error(err),
+			)
+			return StopReasonCancelled
+		}
+		tickStart := time.Now()
 		r.tick(i)
+		r.result.TickDurations[i] = time.Since(tickStart)
+		r.summary.LastTick = i
+		if r.convergence != nil && r.convergence.converged() {
+			r.Logger.Info("Simulation converged", zap.Uint32("Day", uint32(i)))
+			return StopReasonConverged
+		}
+		if r.stopped.Load() {
+			r.Logger.Info("Simulation stopped", zap.Uint32("Day", uint32(i)))
+			return StopReasonStopped
+		}
 	}
+	return StopReasonCompleted
 }
 
 // "Tick" the simulation (run it for one time step - time).
 func (r *Runner) tick(time b.SimTime) {
+	agents := r.Configuration.Agents
+	for _, o := range r.Observers {
+		o.OnTickStart(time, agents)
+	}
 	r.Logger.Info("Perceiving beliefs", zap.Uint32("Day", uint32(time)))
-	r.perceiveBeliefs(time)
+	var failed uint64
+	var err error
+	if r.model != nil {
+		failed, err = r.model.UpdateActivations(time)
+		if r.syncAgents {
+			r.model.WriteActivations()
+		}
+	} else {
+		failed, err = r.perceiveBeliefs(time)
+	}
+	r.result.FailedUpdates[time] = failed
+	if failed != 0 {
+		r.Logger.Error(
+			"Error updating beliefs",
+			zap.Uint32("Day", uint32(time)),
+			zap.Uint64("n agents", failed),
+			zap.Error(err),
+		)
+	}
+	for _, o := range r.Observers {
+		o.OnBeliefsPerceived(time, agents)
+	}
 	r.Logger.Info("Performing actions", zap.Uint32("Day", uint32(time)))
-	r.performActions(time)
+	// No statistics are calculated during the burn-in.
+	output := time >= r.Configuration.StartTime+r.Configuration.BurnIn
+	var spec *OutputSpec
+	if r.model != nil {
+		performActionsDense(r.model, r.seed)
+		if r.syncAgents {
+			r.model.WriteActions()
+		}
+		if output {
+			spec = newOutputSpecFromModel(r.model)
+		}
+	} else {
+		r.performActions(time)
+		if output {
+			spec = NewOutputSpecAtTime(agents, r.Configuration.Beliefs, time)
+		}
+	}
+	for _, o := range r.Observers {
+		o.OnActionsPerformed(time, agents)
+	}
+	if output {
+		r.summary.Data[time] = *spec
+		if r.convergence != nil {
+			r.convergence.observe(spec, len(agents))
+		}
+	}
+	for _, o := range r.Observers {
+		o.OnTickEnd(time, agents)
+	}
+	r.forgetHistory(time)
+}
+
+// Forget the history of every agent which is no longer needed at the specified
+// time, according to the HistoryLength and SnapshotInterval.
+func (r *Runner) forgetHistory(time b.SimTime) {
+	historyLength := b.SimTime(r.Configuration.HistoryLength)
+	if historyLength == 0 || time < historyLength {
+		return
+	}
+
+	var keep func(b.SimTime) bool
+	snapshotInterval := b.SimTime(r.Configuration.SnapshotInterval)
+	if snapshotInterval != 0 {
+		keep = func(t b.SimTime) bool {
+			return t%snapshotInterval == 0
+		}
+	}
+
+	for _, a := range r.Configuration.Agents {
+		a.ForgetHistory(time-historyLength, keep)
+	}
 }
 
 // Perceive the beliefs the agent holds for every agent.
 //
 // This updates all the agent's beliefs for every agent at the specified time
-// step.
-func (r *Runner) perceiveBeliefs(time b.SimTime) {
+// step, and returns the number of agents which failed to update, and the first
+// error.
+func (r *Runner) perceiveBeliefs(time b.SimTime) (failed uint64, firstErr error) {
 	for _, a := range r.Configuration.Agents {
 		err := a.UpdateActivationForAllBeliefs(time, r.Configuration.Beliefs)
 		if err != nil {
-			r.Logger.Error(
-				"Error updating beliefs",
-				zap.Error(err),
-			)
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
 		}
 	}
+	return
+}
+
+// A behaviour and the preference of an agent for it.
+type probPair struct {
+	behaviour *b.Behaviour
+	value     float64
 }
 
 // Perform an action for a specified agent at a specified time.
-//
-// If the preference for behaviours is fully negative, the "least-bad" option is
-// chosen.
-//
-// If only one is positive, this option is chosen.
-//
-// If more than one is positive, it is chosen probabilistically based upon the
-// preference.s
 func (r *Runner) agentPerformAction(agent *b.Agent, time b.SimTime) {
-	type probPair struct {
-		behaviour *b.Behaviour
-		value     float64
-	}
 	unnormalizedProbs := make([]probPair, len(r.Configuration.Behaviours))
 
 	for i, behaviour := range r.Configuration.Behaviours {
@@ -228,6 +610,22 @@ func (r *Runner) agentPerformAction(agent *b.Agent, time b.SimTime) {
 		}
 	}
 
+	rv := behaviourRandom(r.seed, agent.Uuid, time)
+	agent.Actions[time] = chooseBehaviour(rv, unnormalizedProbs)
+}
+
+// Choose a behaviour given the unnormalized preference for each behaviour.
+//
+// If the preference for behaviours is fully negative, the "least-bad" option is
+// chosen.
+//
+// If only one is positive, this option is chosen.
+//
+// If more than one is positive, it is chosen probabilistically based upon the
+// preference, using rv, which is uniformly distributed in [0, 1).
+//
+// This sorts unnormalizedProbs in place.
+func chooseBehaviour(rv float64, unnormalizedProbs []probPair) *b.Behaviour {
 	sort.Slice(unnormalizedProbs, func(i, j int) bool {
 		return unnormalizedProbs[i].value < unnormalizedProbs[j].value
 	})
@@ -235,43 +633,70 @@ func (r *Runner) agentPerformAction(agent *b.Agent, time b.SimTime) {
 	lastElem := unnormalizedProbs[len(unnormalizedProbs)-1]
 
 	if lastElem.value < 0.0 {
-		agent.Actions[time] = lastElem.behaviour
-	} else {
-		var filteredProbs []probPair
-		for _, p := range unnormalizedProbs {
-			if p.value >= 0.0 {
-				filteredProbs = append(filteredProbs, p)
-			}
-		}
+		return lastElem.behaviour
+	}
 
-		if len(filteredProbs) == 1 {
-			agent.Actions[time] = filteredProbs[0].behaviour
-		} else {
-			normalizingFactor := 0.0
-			for _, p := range filteredProbs {
-				normalizingFactor += p.value
-			}
-			normalizedProbs := make([]probPair, len(filteredProbs))
-			for i, p := range filteredProbs {
-				normalizedProbs[i].behaviour = p.behaviour
-				normalizedProbs[i].value = p.value / normalizingFactor
-			}
+	var filteredProbs []probPair
+	for _, p := range unnormalizedProbs {
+		if p.value >= 0.0 {
+			filteredProbs = append(filteredProbs, p)
+		}
+	}
 
-			chosenBehaviour := normalizedProbs[len(normalizedProbs)-1].behaviour
+	if len(filteredProbs) == 1 {
+		return filteredProbs[0].behaviour
+	}
 
-			rv := rand.Float64()
+	normalizingFactor := 0.0
+	for _, p := range filteredProbs {
+		normalizingFactor += p.value
+	}
+	normalizedProbs := make([]probPair, len(filteredProbs))
+	for i, p := range filteredProbs {
+		normalizedProbs[i].behaviour = p.behaviour
+		normalizedProbs[i].value = p.value / normalizingFactor
+	}
 
-			for _, p := range normalizedProbs {
-				rv -= p.value
-				if rv <= 0.0 {
-					chosenBehaviour = p.behaviour
-					break
-				}
-			}
+	chosenBehaviour := normalizedProbs[len(normalizedProbs)-1].behaviour
 
-			agent.Actions[time] = chosenBehaviour
+	for _, p := range normalizedProbs {
+		rv -= p.value
+		if rv <= 0.0 {
+			chosenBehaviour = p.behaviour
+			break
 		}
 	}
+
+	return chosenBehaviour
+}
+
+// chooseSeed gets seed, or a random seed if it is nil.
+func chooseSeed(seed *int64) int64 {
+	if seed == nil {
+		return rand.Int63()
+	}
+	return *seed
+}
+
+// behaviourRandom gets the random number, uniformly distributed in [0, 1), used
+// to choose the behaviour of an agent at a time.
+//
+// This hashes the seed, the UUID of the agent and the time with the SplitMix64
+// finalizer.
+func behaviourRandom(seed int64, agent uuid.UUID, time b.SimTime) float64 {
+	h := mix64(uint64(seed))
+	h = mix64(h ^ binary.BigEndian.Uint64(agent[:8]))
+	h = mix64(h ^ binary.BigEndian.Uint64(agent[8:]))
+	h = mix64(h ^ uint64(time))
+	return float64(h>>11) / (1 << 53)
+}
+
+// mix64 is the finalizer of the SplitMix64 random number generator.
+func mix64(h uint64) uint64 {
+	h += 0x9e3779b97f4a7c15
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
 }
 
 // Perform actions for all agents at the specified time.
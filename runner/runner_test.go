@@ -0,0 +1,397 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"go.uber.org/zap"
+)
+
+// newTestConfiguration creates a small simulation of two friends who hold a
+// single belief, writing the output to a bytes.Buffer.
+func newTestConfiguration(t *testing.T) *Configuration {
+	t.Helper()
+
+	behaviour := b.NewBehaviour("behaviour")
+	belief := b.NewBelief("belief")
+	belief.Perception[behaviour] = 0.5
+
+	a1 := b.NewAgent()
+	a2 := b.NewAgent()
+	for _, a := range []*b.Agent{a1, a2} {
+		a.Activations[0] = map[*b.Belief]float64{belief: 0.5}
+		a.Deltas[belief] = 1.0
+	}
+	a1.Friends[a2] = 1.0
+	a2.Friends[a1] = 1.0
+
+	return &Configuration{
+		Behaviours: []*b.Behaviour{behaviour},
+		Beliefs:    []*b.Belief{belief},
+		Agents:     []*b.Agent{a1, a2},
+		Prs: PerformanceRelationships{
+			belief: {behaviour: 1.0},
+		},
+		StartTime:  1,
+		EndTime:    3,
+		OutputFile: new(bytes.Buffer),
+		Seed:       new(int64),
+	}
+}
+
+// readTestOutput reads the summary output written by a Runner.
+func readTestOutput(t *testing.T, c *Configuration) *OutputSpecs {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoder.Close()
+
+	uncompressedData, err := decoder.DecodeAll(c.OutputFile.(*bytes.Buffer).Bytes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := new(OutputSpecs)
+	err = json.Unmarshal(uncompressedData, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return specs
+}
+
+type cancellingObserver struct {
+	BaseObserver
+	cancel   context.CancelFunc
+	cancelAt b.SimTime
+}
+
+func (o *cancellingObserver) OnTickEnd(time b.SimTime, _ []*b.Agent) {
+	if time == o.cancelAt {
+		o.cancel()
+	}
+}
+
+func TestRunContextWritesTruncatedOutputWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.AddObserver(&cancellingObserver{cancel: cancel, cancelAt: 2})
+
+	_, err := r.RunContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := readTestOutput(t, r.Configuration)
+
+	if !specs.Truncated {
+		t.Error("Output should be truncated")
+	}
+
+	if specs.LastTick != 2 {
+		t.Errorf("LastTick should be 2; it was %d", specs.LastTick)
+	}
+
+	if len(specs.Data) != 2 {
+		t.Errorf("len(Data) should be 2; it was %d", len(specs.Data))
+	}
+}
+
+func TestRunContextChoosesRandomSeedWhenUnset(t *testing.T) {
+	seeds := make([]int64, 2)
+	for i := range seeds {
+		r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+		r.Configuration.Seed = nil
+		res, err := r.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds[i] = res.Summary.Seed
+	}
+	if seeds[0] == seeds[1] {
+		t.Errorf("Runs without a seed should choose different seeds; both were %d", seeds[0])
+	}
+
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Summary.Seed != 0 {
+		t.Errorf("The summary should record the seed 0; it was %d", res.Summary.Seed)
+	}
+}
+
+func TestRunContextWritesSummaryWithJsonFullOutput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.FullOutput = true
+	r.Configuration.SummaryOutputFile = new(bytes.Buffer)
+	r.AddObserver(&cancellingObserver{cancel: cancel, cancelAt: 2})
+
+	_, err := r.RunContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := readTestOutput(t, &Configuration{OutputFile: r.Configuration.SummaryOutputFile})
+	if !specs.Truncated || specs.LastTick != 2 || specs.StopReason != StopReasonCancelled {
+		t.Errorf("Expected the summary to be truncated after tick 2, got %v at %d", specs.StopReason, specs.LastTick)
+	}
+
+	n := 0
+	err = ReadAgentSpecs(r.Configuration.OutputFile.(*bytes.Buffer), func(*AgentSpec) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Errorf("Expected the full output to be an agents file of 2 agents, got %d, %v", n, err)
+	}
+}
+
+func TestRunContextRecordsTruncationInFullOutputMetadata(t *testing.T) {
+	expected := map[string]string{"seed": "0", "truncated": "true", "lastTick": "2", "stopReason": "cancelled"}
+
+	for _, format := range []OutputFormat{OutputFormatParquet, OutputFormatArrow} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+		r.Configuration.FullOutput = true
+		r.Configuration.OutputFormat = format
+		r.AddObserver(&cancellingObserver{cancel: cancel, cancelAt: 2})
+
+		_, err := r.RunContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data := r.Configuration.OutputFile.(*bytes.Buffer).Bytes()
+		metadata := make(map[string]string)
+		if format == OutputFormatParquet {
+			file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key := range expected {
+				metadata[key], _ = file.Lookup(key)
+			}
+		} else {
+			reader, err := ipc.NewFileReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := reader.Schema().Metadata()
+			for key := range expected {
+				if i := md.FindKey(key); i >= 0 {
+					metadata[key] = md.Values()[i]
+				}
+			}
+			reader.Close()
+		}
+
+		if !reflect.DeepEqual(metadata, expected) {
+			t.Errorf("%s: expected metadata %v, got %v", format, expected, metadata)
+		}
+	}
+}
+
+func TestRunWritesCompleteOutput(t *testing.T) {
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+
+	_, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := readTestOutput(t, r.Configuration)
+
+	if specs.Truncated {
+		t.Error("Output should not be truncated")
+	}
+
+	if specs.LastTick != 3 {
+		t.Errorf("LastTick should be 3; it was %d", specs.LastTick)
+	}
+
+	if len(specs.Data) != 3 {
+		t.Errorf("len(Data) should be 3; it was %d", len(specs.Data))
+	}
+}
+
+func TestRunReturnsResultWithoutOutputFile(t *testing.T) {
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.OutputFile = nil
+
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Summary.Data) != 3 {
+		t.Errorf("len(Summary.Data) should be 3; it was %d", len(res.Summary.Data))
+	}
+
+	if len(res.TickDurations) != 3 {
+		t.Errorf("len(TickDurations) should be 3; it was %d", len(res.TickDurations))
+	}
+
+	if res.TotalFailedUpdates() != 0 {
+		t.Errorf("TotalFailedUpdates() should be 0; it was %d", res.TotalFailedUpdates())
+	}
+}
+
+func TestRunCountsFailedUpdates(t *testing.T) {
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.OutputFile = nil
+	agent := r.Configuration.Agents[0]
+	for belief := range agent.Deltas {
+		delete(agent.Deltas, belief)
+	}
+
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for time := b.SimTime(1); time <= 3; time++ {
+		if res.FailedUpdates[time] != 1 {
+			t.Errorf("FailedUpdates[%d] should be 1; it was %d", time, res.FailedUpdates[time])
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRunReturnsErrorWhenOutputFails(t *testing.T) {
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.OutputFile = failingWriter{}
+
+	res, err := r.Run()
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	if res == nil {
+		t.Error("Result should not be nil")
+	}
+}
+
+// errorWriter is an io.Writer which always fails with err.
+type errorWriter struct {
+	err error
+}
+
+func (w errorWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestRunReturnsBurnInErrorWhenOutputFails(t *testing.T) {
+	burnInErr := errors.New("burn-in state write failed")
+	outputErr := errors.New("output write failed")
+
+	r := Runner{Configuration: newTestConfiguration(t), Logger: zap.NewNop()}
+	r.Configuration.BurnIn = 1
+	r.Configuration.BurnInStateFile = errorWriter{err: burnInErr}
+	r.Configuration.OutputFile = errorWriter{err: outputErr}
+
+	_, err := r.Run()
+	if !errors.Is(err, burnInErr) || !errors.Is(err, outputErr) {
+		t.Errorf("Expected both the burn-in and output errors, got %v", err)
+	}
+}
+
+func TestBurnInIsExcludedFromOutputAndStateCanBeReused(t *testing.T) {
+	for _, engine := range []Engine{MapEngine, DenseEngine} {
+		c := newRandomConfiguration(1, 100, 5)
+		c.EndTime = 8
+		c.Engine = engine
+		r := Runner{Configuration: c, Logger: zap.NewNop()}
+		expected, err := r.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for time := b.SimTime(1); time <= 3; time++ {
+			delete(expected.Summary.Data, time)
+		}
+
+		state := new(bytes.Buffer)
+		c = newRandomConfiguration(1, 100, 5)
+		c.EndTime = 8
+		c.Engine = engine
+		c.BurnIn = 3
+		c.BurnInStateFile = state
+		r = Runner{Configuration: c, Logger: zap.NewNop()}
+		res, err := r.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res.Summary.Data, expected.Summary.Data) {
+			t.Errorf("%s: the output should only include the ticks after the burn-in", engine)
+		}
+
+		// Resume from the state at the end of the burn-in.
+		decoder, err := zstd.NewReader(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var specs []*AgentSpec
+		err = DecodeAgentSpecs(decoder, func(spec *AgentSpec) error {
+			specs = append(specs, spec)
+			return nil
+		})
+		decoder.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		agents := make([]*b.Agent, len(specs))
+		uuidAgents := make(map[uuid.UUID]*b.Agent, len(specs))
+		for i, spec := range specs {
+			if len(spec.Activations) != 1 || spec.Activations[3] == nil {
+				t.Fatalf("%s: the state should only have tick 3", engine)
+			}
+			agents[i] = spec.ToAgent(c.Behaviours, c.Beliefs)
+			uuidAgents[spec.Uuid] = agents[i]
+		}
+		for _, spec := range specs {
+			spec.LinkFriends(uuidAgents)
+		}
+
+		resumed := &Configuration{
+			Behaviours: c.Behaviours,
+			Beliefs:    c.Beliefs,
+			Agents:     agents,
+			Prs:        c.Prs,
+			StartTime:  4,
+			EndTime:    8,
+			Engine:     engine,
+			Seed:       c.Seed,
+		}
+		r = Runner{Configuration: resumed, Logger: zap.NewNop()}
+		res, err = r.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res.Summary.Data, expected.Summary.Data) {
+			t.Errorf("%s: resuming from the burn-in state should match", engine)
+		}
+	}
+}
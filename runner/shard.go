@@ -0,0 +1,776 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/dense"
+	"github.com/0xr0bert/gobelief/runner/internal/shardrpc"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// The number of agents sent to a worker in each call.
+const shardBatchSize = 1024
+
+// ShardedConfiguration defines the configuration of a simulation which is
+// partitioned across several worker processes.
+type ShardedConfiguration struct {
+	// The behaviours in the simulation.
+	Behaviours []*b.Behaviour
+	// The beliefs in the simulation.
+	Beliefs []*b.Belief
+	// The PerformanceRelationships in the simulation.
+	Prs PerformanceRelationships
+	// Agents calls f with the spec of every agent in the simulation, in the
+	// same order every time, stopping at the first error.
+	//
+	// This is called more than once, so the agents never need to be held in
+	// memory by the coordinator. Friends which are not agents are ignored, as
+	// they are by AgentSpec.LinkFriends, unless Strict is set.
+	Agents func(f func(*AgentSpec) error) error
+	// Whether references by the agents to unknown behaviours, beliefs and
+	// agents are an *UnresolvedReferencesError, as they are for
+	// AgentSpec.ToAgentStrict and AgentSpec.LinkFriendsStrict, rather than
+	// ignored.
+	Strict bool
+	// The start time of the simulation.
+	StartTime b.SimTime
+	// The end time of the simulation (inclusive).
+	EndTime b.SimTime
+	// The number of ticks from the start time which are simulated before the
+	// output begins, as in Configuration.
+	BurnIn b.SimTime
+	// Where the summary output is written, or nil if no output should be
+	// written.
+	OutputFile io.Writer
+	// The format in which the summary output is written, as in
+	// Configuration.
+	OutputFormat OutputFormat
+	// When to stop the simulation before the end time because it has
+	// converged, or nil to always run until the end time.
+	Convergence *ConvergenceCriterion
+	// The precision with which each shard stores the state of its agents.
+	Precision dense.Precision
+	// The seed from which the random numbers used to choose behaviours are
+	// derived, or nil to choose a random seed, as in Configuration.
+	Seed *int64
+	// The number of shards.
+	NShards int
+	// WorkerCommand creates the command which starts a worker process, which
+	// must call ServeShard with address.
+	//
+	// If this is nil, the workers are run in goroutines of this process.
+	WorkerCommand func(address string) *exec.Cmd
+}
+
+// ShardedRunner runs a simulation which is partitioned across several worker
+// processes on one machine.
+//
+// The agents are partitioned by their friendships, and each shard is simulated
+// by a worker using the DenseEngine. Ghosts, the agents of other shards which
+// are friends of the agents of a shard, are copied to the shard. At every tick,
+// the actions of the agents which are ghosts elsewhere are exchanged through
+// the coordinator over Unix sockets, and the coordinator merges the summary
+// statistics of each shard.
+//
+// Given the same seed and precision, the summary output is identical to that
+// of a Runner using the DenseEngine. Only the summary output is supported.
+type ShardedRunner struct {
+	// The configuration.
+	Configuration *ShardedConfiguration
+	// The logger.
+	Logger *zap.Logger
+
+	result  *Result
+	summary *OutputSpecs
+	// The convergence detector, or nil if there is no ConvergenceCriterion.
+	convergence *convergenceDetector
+	// The number of agents in the simulation.
+	nAgents int
+	// The connection to each shard.
+	shards []*rpc.Client
+	// Where the actions of the ghosts of each shard are exported from.
+	ghostSources [][]exportPosition
+	// The actions exported by each shard at the previous tick.
+	exports [][]int32
+	// Whether Stop has been called.
+	stopped atomic.Bool
+}
+
+// exportPosition is the position of the action of an agent in the actions
+// exported by a shard.
+type exportPosition struct {
+	shard int
+	index int
+}
+
+// Stop the simulation at the end of the current tick.
+func (r *ShardedRunner) Stop() {
+	r.stopped.Store(true)
+}
+
+// Run the simulation.
+//
+// This returns the Result of the simulation, and any error running the workers
+// or writing the output.
+func (r *ShardedRunner) Run() (*Result, error) {
+	return r.RunContext(context.Background())
+}
+
+// RunContext runs the simulation until the end time, or until ctx is done, as
+// Runner.RunContext does.
+//
+// If a worker fails once ctx is done, such as when it is interrupted along with
+// this process, the tick it was simulating is abandoned, and the output of
+// the ticks which were completed is still written.
+func (r *ShardedRunner) RunContext(ctx context.Context) (*Result, error) {
+	start := time.Now()
+	config := r.Configuration
+	if config.NShards < 1 {
+		return nil, errors.New("the number of shards must be at least 1")
+	}
+
+	r.result = newResult()
+	r.summary = &OutputSpecs{
+		Seed:     chooseSeed(config.Seed),
+		LastTick: config.StartTime - 1,
+		Data:     make(map[b.SimTime]OutputSpec),
+	}
+	r.stopped.Store(false)
+	r.convergence = nil
+	if config.Convergence != nil {
+		var err error
+		r.convergence, err = newConvergenceDetector(
+			*config.Convergence,
+			config.Beliefs,
+			config.Behaviours,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "gobelief-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	wait, err := r.startWorkers(filepath.Join(dir, "coordinator.sock"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.setup()
+	if err == nil {
+		r.Logger.Info(
+			"Running sharded simulation",
+			zap.Uint32("Start", uint32(config.StartTime)),
+			zap.Uint32("End", uint32(config.EndTime)),
+			zap.Uint32("n beliefs", uint32(len(config.Beliefs))),
+			zap.Uint32("n behaviours", uint32(len(config.Behaviours))),
+			zap.Uint32("n agents", uint32(r.nAgents)),
+			zap.Int("n shards", config.NShards),
+		)
+		r.summary.StopReason, err = r.tickBetween(ctx, config.StartTime, config.EndTime)
+	}
+
+	for _, shard := range r.shards {
+		shard.Close()
+	}
+	err2 := wait()
+	if err2 != nil && err == nil && r.summary.StopReason == StopReasonCancelled {
+		// The workers may have been interrupted along with this process, but
+		// every tick in the summary was completed, so it is still written.
+		r.Logger.Warn("Worker failed after the simulation was cancelled", zap.Error(err2))
+	} else if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.summary.Truncated = r.summary.StopReason == StopReasonCancelled
+	r.Logger.Info(
+		"Ending simulation",
+		zap.Uint32("Last tick", uint32(r.summary.LastTick)),
+		zap.String("Stop reason", string(r.summary.StopReason)),
+	)
+	r.result.Summary = r.summary
+
+	if config.OutputFile == nil {
+		r.Logger.Info("No output file")
+	} else {
+		err = WriteSummary(
+			config.OutputFile,
+			r.summary,
+			config.Behaviours,
+			config.Beliefs,
+			config.OutputFormat,
+		)
+		if err != nil {
+			r.Logger.Error("Error serializing output", zap.Error(err))
+		}
+	}
+
+	r.result.Duration = time.Since(start)
+	return r.result, err
+}
+
+// startWorkers starts the workers, and connects to them at the Unix socket
+// address.
+//
+// This returns a function which waits for the workers to exit once the
+// connections to them have been closed.
+func (r *ShardedRunner) startWorkers(address string) (func() error, error) {
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	nShards := r.Configuration.NShards
+	errs := make(chan error, nShards)
+	for s := 0; s < nShards; s++ {
+		if r.Configuration.WorkerCommand == nil {
+			go func() {
+				errs <- ServeShard(address)
+			}()
+			continue
+		}
+
+		cmd := r.Configuration.WorkerCommand(address)
+		err = cmd.Start()
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			err := cmd.Wait()
+			if err != nil {
+				// A worker which exits early would otherwise never connect.
+				listener.Close()
+			}
+			errs <- err
+		}()
+	}
+
+	wait := func() error {
+		var firstErr error
+		for s := 0; s < nShards; s++ {
+			err := <-errs
+			if firstErr == nil && err != nil {
+				firstErr = fmt.Errorf("worker failed: %w", err)
+			}
+		}
+		return firstErr
+	}
+
+	r.shards = make([]*rpc.Client, 0, nShards)
+	for s := 0; s < nShards; s++ {
+		conn, err := listener.Accept()
+		if err != nil {
+			for _, shard := range r.shards {
+				shard.Close()
+			}
+			err2 := wait()
+			if err2 != nil {
+				return nil, err2
+			}
+			return nil, err
+		}
+		r.shards = append(r.shards, rpc.NewClient(conn))
+	}
+
+	return wait, nil
+}
+
+// setup partitions the agents between the shards, and sends each shard its
+// agents.
+func (r *ShardedRunner) setup() error {
+	config := r.Configuration
+
+	// Read the social graph, which is all the coordinator needs to partition
+	// the agents.
+	var uuids []uuid.UUID
+	var friends []uuid.UUID
+	offsets := []int{0}
+	var refs *UnresolvedReferencesError
+	var lookup *agentLookup
+	if config.Strict {
+		refs = new(UnresolvedReferencesError)
+		lookup = newAgentLookup(config.Behaviours, config.Beliefs)
+	}
+	err := config.Agents(func(spec *AgentSpec) error {
+		uuids = append(uuids, spec.Uuid)
+		friends = append(friends, sortedUuids(spec.Friends)...)
+		offsets = append(offsets, len(friends))
+		if refs != nil {
+			spec.toAgent(lookup, refs)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read agents: %w", err)
+	}
+
+	r.nAgents = len(uuids)
+	indices := make(map[uuid.UUID]int32, r.nAgents)
+	for i, u := range uuids {
+		indices[u] = int32(i)
+	}
+
+	columns := make([]int32, 0, len(friends))
+	for i := 0; i < r.nAgents; i++ {
+		start := len(columns)
+		for _, friend := range friends[offsets[i]:offsets[i+1]] {
+			j, found := indices[friend]
+			if found {
+				columns = append(columns, j)
+			} else {
+				refs.add(fmt.Sprintf("agent %v", uuids[i]), "friends", "agent", friend)
+			}
+		}
+		offsets[i] = start
+	}
+	offsets[r.nAgents] = len(columns)
+	friends = nil
+	if refs != nil && len(refs.References) != 0 {
+		return refs
+	}
+
+	nShards := len(r.shards)
+	shardOf := partition(offsets, columns, nShards)
+
+	owned := make([][]uuid.UUID, nShards)
+	for i, s := range shardOf {
+		owned[s] = append(owned[s], uuids[i])
+	}
+
+	// Find the ghosts of each shard, in order of their index, and export them
+	// from the shard which owns them.
+	ghosts := make([][]uuid.UUID, nShards)
+	exports := make([][]uuid.UUID, nShards)
+	exportIndex := make([]int, r.nAgents)
+	for i := range exportIndex {
+		exportIndex[i] = -1
+	}
+	r.ghostSources = make([][]exportPosition, nShards)
+	isGhost := make([]bool, r.nAgents)
+	for s := 0; s < nShards; s++ {
+		var ghostIndices []int32
+		for i := 0; i < r.nAgents; i++ {
+			if shardOf[i] != s {
+				continue
+			}
+			for _, j := range columns[offsets[i]:offsets[i+1]] {
+				if shardOf[j] != s && !isGhost[j] {
+					isGhost[j] = true
+					ghostIndices = append(ghostIndices, j)
+				}
+			}
+		}
+		sortInt32s(ghostIndices)
+
+		for _, j := range ghostIndices {
+			isGhost[j] = false
+			owner := shardOf[j]
+			if exportIndex[j] == -1 {
+				exportIndex[j] = len(exports[owner])
+				exports[owner] = append(exports[owner], uuids[j])
+			}
+			ghosts[s] = append(ghosts[s], uuids[j])
+			r.ghostSources[s] = append(
+				r.ghostSources[s],
+				exportPosition{shard: owner, index: exportIndex[j]},
+			)
+		}
+	}
+
+	behaviours, beliefs, prs, err := marshalScenario(config.Behaviours, config.Beliefs, config.Prs)
+	if err != nil {
+		return err
+	}
+
+	for s, shard := range r.shards {
+		err = shard.Call(shardrpc.ServiceName+".Setup", &shardrpc.SetupArgs{
+			Behaviours: behaviours,
+			Beliefs:    beliefs,
+			Prs:        prs,
+			Time:       config.StartTime - 1,
+			Seed:       r.summary.Seed,
+			Precision:  int(config.Precision),
+			Agents:     owned[s],
+			Ghosts:     ghosts[s],
+			Exports:    exports[s],
+		}, new(shardrpc.Empty))
+		if err != nil {
+			return fmt.Errorf("failed to set up shard %d: %w", s, err)
+		}
+	}
+
+	batches := make([][][]byte, nShards)
+	send := func(s int) error {
+		err := r.shards[s].Call(
+			shardrpc.ServiceName+".AddAgents",
+			&shardrpc.AddAgentsArgs{Agents: batches[s]},
+			new(shardrpc.Empty),
+		)
+		batches[s] = batches[s][:0]
+		return err
+	}
+
+	i := 0
+	err = config.Agents(func(spec *AgentSpec) error {
+		if i == r.nAgents || spec.Uuid != uuids[i] {
+			return errors.New("agents changed between reads")
+		}
+		s := shardOf[i]
+		i++
+
+		data, err := json.Marshal(spec)
+		if err != nil {
+			return err
+		}
+		batches[s] = append(batches[s], data)
+		if len(batches[s]) == shardBatchSize {
+			return send(s)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send agents: %w", err)
+	}
+
+	r.exports = make([][]int32, nShards)
+	for s := range r.shards {
+		err = send(s)
+		if err != nil {
+			return fmt.Errorf("failed to send agents: %w", err)
+		}
+		reply := new(shardrpc.StepReply)
+		err = r.shards[s].Call(shardrpc.ServiceName+".Start", new(shardrpc.Empty), reply)
+		if err != nil {
+			return fmt.Errorf("failed to start shard %d: %w", s, err)
+		}
+		r.exports[s] = reply.Exports
+	}
+
+	return nil
+}
+
+// Tick between two times (inclusive), or until the ShardedRunner is stopped,
+// ctx is done, or the simulation converges.
+func (r *ShardedRunner) tickBetween(
+	ctx context.Context,
+	start, end b.SimTime,
+) (StopReason, error) {
+	for i := start; i <= end; i++ {
+		if err := ctx.Err(); err != nil {
+			r.Logger.Warn(
+				"Simulation cancelled",
+				zap.Uint32("Day", uint32(i)),
+				zap.Error(err),
+			)
+			return StopReasonCancelled, nil
+		}
+		tickStart := time.Now()
+		err := r.tick(i)
+		if err != nil && ctx.Err() != nil {
+			// The workers may have been interrupted along with this process,
+			// so the tick is abandoned as if ctx was done before it started.
+			r.Logger.Warn(
+				"Simulation cancelled during tick",
+				zap.Uint32("Day", uint32(i)),
+				zap.Error(err),
+			)
+			return StopReasonCancelled, nil
+		}
+		if err != nil {
+			return StopReasonCancelled, err
+		}
+		r.result.TickDurations[i] = time.Since(tickStart)
+		r.summary.LastTick = i
+		if r.convergence != nil && r.convergence.converged() {
+			r.Logger.Info("Simulation converged", zap.Uint32("Day", uint32(i)))
+			return StopReasonConverged, nil
+		}
+		if r.stopped.Load() {
+			r.Logger.Info("Simulation stopped", zap.Uint32("Day", uint32(i)))
+			return StopReasonStopped, nil
+		}
+	}
+	return StopReasonCompleted, nil
+}
+
+// "Tick" the simulation (run it for one time step - time) on every shard, and
+// merge the summary statistics.
+func (r *ShardedRunner) tick(time b.SimTime) error {
+	r.Logger.Info("Ticking shards", zap.Uint32("Day", uint32(time)))
+	replies := make([]*shardrpc.StepReply, len(r.shards))
+	err := r.callShards("Step", func(s int) any {
+		ghostActions := make([]int32, len(r.ghostSources[s]))
+		for k, source := range r.ghostSources[s] {
+			ghostActions[k] = r.exports[source.shard][source.index]
+		}
+		return &shardrpc.StepArgs{Time: time, GhostActions: ghostActions}
+	}, func(s int) any {
+		replies[s] = new(shardrpc.StepReply)
+		return replies[s]
+	})
+	if err != nil {
+		return err
+	}
+
+	var failed uint64
+	var firstErr string
+	for s, reply := range replies {
+		r.exports[s] = reply.Exports
+		failed += reply.Failed
+		if firstErr == "" {
+			firstErr = reply.Error
+		}
+	}
+	r.result.FailedUpdates[time] = failed
+	if failed != 0 {
+		r.Logger.Error(
+			"Error updating beliefs",
+			zap.Uint32("Day", uint32(time)),
+			zap.Uint64("n agents", failed),
+			zap.String("errorMessage", firstErr),
+		)
+	}
+
+	// No statistics are calculated during the burn-in.
+	if time < r.Configuration.StartTime+r.Configuration.BurnIn {
+		return nil
+	}
+
+	spec, err := r.mergeSummary(replies)
+	if err != nil {
+		return err
+	}
+	r.summary.Data[time] = *spec
+	if r.convergence != nil {
+		r.convergence.observe(spec, r.nAgents)
+	}
+	return nil
+}
+
+// mergeSummary merges the summary statistics of each shard, which is
+// equivalent to newOutputSpecFromModel.
+func (r *ShardedRunner) mergeSummary(replies []*shardrpc.StepReply) (*OutputSpec, error) {
+	o := NewOutputSpec()
+	beliefs := r.Configuration.Beliefs
+	nBeliefs := len(beliefs)
+
+	means := make([]float64, nBeliefs)
+	found := make([]bool, nBeliefs)
+	for j, belief := range beliefs {
+		sum := newExactSum()
+		var nonzero uint64
+		for _, reply := range replies {
+			sum.Merge(&exactSum{Limbs: reply.Sums[j]})
+			found[j] = found[j] || reply.Found[j]
+			nonzero += reply.Nonzero[j]
+		}
+		if found[j] {
+			means[j] = sum.Float64() / float64(r.nAgents)
+			o.MeanActivation[belief.Uuid] = means[j]
+		}
+		if nonzero != 0 {
+			o.NonzeroActivationCount[belief.Uuid] = nonzero
+		}
+	}
+
+	deviations := make([]*shardrpc.DeviationsReply, len(r.shards))
+	err := r.callShards("Deviations", func(int) any {
+		return &shardrpc.DeviationsArgs{Means: means}
+	}, func(s int) any {
+		deviations[s] = new(shardrpc.DeviationsReply)
+		return deviations[s]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for j, belief := range beliefs {
+		if !found[j] {
+			continue
+		}
+		sd := newExactSum()
+		for _, reply := range deviations {
+			sd.Merge(&exactSum{Limbs: reply.Sums[j]})
+		}
+		o.SDActivation[belief.Uuid] = math.Sqrt(sd.Float64() / float64(r.nAgents-1))
+	}
+
+	if r.nAgents != 0 {
+		medians, err := r.findMedians()
+		if err != nil {
+			return nil, err
+		}
+		for j, belief := range beliefs {
+			o.MedianActivation[belief.Uuid] = medians[j]
+		}
+	}
+
+	for k, behaviour := range r.Configuration.Behaviours {
+		var count uint64
+		for _, reply := range replies {
+			count += reply.Performers[k]
+		}
+		if count != 0 {
+			o.NPerformers[behaviour.Uuid] = count
+		}
+	}
+
+	return o, nil
+}
+
+// findMedians finds the median activation of each belief, as selectNth does,
+// by a binary search over the ordered keys of the activations.
+func (r *ShardedRunner) findMedians() ([]float64, error) {
+	nBeliefs := len(r.Configuration.Beliefs)
+	rank := uint64(r.nAgents/2) + 1
+	lo := make([]uint64, nBeliefs)
+	hi := make([]uint64, nBeliefs)
+	for j := range hi {
+		hi[j] = math.MaxUint64
+	}
+
+	for {
+		searching := false
+		thresholds := make([]uint64, nBeliefs)
+		for j := range thresholds {
+			thresholds[j] = lo[j] + (hi[j]-lo[j])/2
+			searching = searching || lo[j] < hi[j]
+		}
+		if !searching {
+			break
+		}
+
+		counts := make([]*shardrpc.CountReply, len(r.shards))
+		err := r.callShards("Count", func(int) any {
+			return &shardrpc.CountArgs{Thresholds: thresholds}
+		}, func(s int) any {
+			counts[s] = new(shardrpc.CountReply)
+			return counts[s]
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for j := range thresholds {
+			if lo[j] == hi[j] {
+				continue
+			}
+			var count uint64
+			for _, reply := range counts {
+				count += reply.Counts[j]
+			}
+			if count >= rank {
+				hi[j] = thresholds[j]
+			} else {
+				lo[j] = thresholds[j] + 1
+			}
+		}
+	}
+
+	medians := make([]float64, nBeliefs)
+	for j := range medians {
+		medians[j] = fromOrderedKey(lo[j])
+	}
+	return medians, nil
+}
+
+// callShards calls a method of every shard concurrently, with the arguments and
+// reply of each shard.
+func (r *ShardedRunner) callShards(
+	method string,
+	args func(s int) any,
+	reply func(s int) any,
+) error {
+	calls := make([]*rpc.Call, len(r.shards))
+	for s, shard := range r.shards {
+		calls[s] = shard.Go(shardrpc.ServiceName+"."+method, args(s), reply(s), nil)
+	}
+
+	var err error
+	for s, call := range calls {
+		<-call.Done
+		if call.Error != nil && err == nil {
+			err = fmt.Errorf("shard %d failed: %w", s, call.Error)
+		}
+	}
+	return err
+}
+
+// marshalScenario encodes the behaviours, beliefs and performance relationships
+// as JSON, in the same form as the input files.
+func marshalScenario(
+	behaviours []*b.Behaviour,
+	beliefs []*b.Belief,
+	prs PerformanceRelationships,
+) (behavioursJson, beliefsJson, prsJson []byte, err error) {
+	behaviourSpecs := make([]BehaviourSpec, len(behaviours))
+	for i, behaviour := range behaviours {
+		behaviourSpecs[i] = BehaviourSpec{Name: behaviour.Name, Uuid: behaviour.Uuid}
+	}
+
+	beliefSpecs := make([]BeliefSpec, len(beliefs))
+	for i, belief := range beliefs {
+		beliefSpecs[i] = BeliefSpec{
+			Name:          belief.Name,
+			Uuid:          belief.Uuid,
+			Perceptions:   make(map[uuid.UUID]float64, len(belief.Perception)),
+			Relationships: make(map[uuid.UUID]float64, len(belief.Relationship)),
+		}
+		for behaviour, v := range belief.Perception {
+			beliefSpecs[i].Perceptions[behaviour.Uuid] = v
+		}
+		for belief2, v := range belief.Relationship {
+			beliefSpecs[i].Relationships[belief2.Uuid] = v
+		}
+	}
+
+	var prsSpecs []PerformanceRelationshipSpec
+	for belief, values := range prs {
+		for behaviour, v := range values {
+			prsSpecs = append(prsSpecs, PerformanceRelationshipSpec{
+				BehaviourUuid: behaviour.Uuid,
+				BeliefUuid:    belief.Uuid,
+				Value:         v,
+			})
+		}
+	}
+
+	behavioursJson, err = json.Marshal(behaviourSpecs)
+	if err != nil {
+		return
+	}
+	beliefsJson, err = json.Marshal(beliefSpecs)
+	if err != nil {
+		return
+	}
+	prsJson, err = json.Marshal(prsSpecs)
+	return
+}
+
+// sortInt32s sorts values in increasing order.
+func sortInt32s(values []int32) {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+}
@@ -0,0 +1,242 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"go.uber.org/zap"
+)
+
+// newShardTestConfiguration creates a random simulation whose deltas and
+// friend weights are not multiples of 1/8, so sums are only identical if they
+// are calculated in the same order, or exactly.
+func newShardTestConfiguration() *Configuration {
+	c := newRandomConfiguration(1, 300, 5)
+	rng := rand.New(rand.NewSource(2))
+	for i, agent := range c.Agents {
+		for _, belief := range c.Beliefs {
+			agent.Deltas[belief] = rng.Float64()
+		}
+		// The friends are a map, so derive their weights from their UUIDs
+		// rather than the order in which they are iterated.
+		for friend := range agent.Friends {
+			agent.Friends[friend] = behaviourRandom(2, friend.Uuid, b.SimTime(i))
+		}
+	}
+	c.EndTime = 10
+	c.Engine = DenseEngine
+	seed := int64(3)
+	c.Seed = &seed
+	return c
+}
+
+// newShardedTestConfiguration creates a ShardedConfiguration of the same
+// simulation as newShardTestConfiguration.
+func newShardedTestConfiguration(nShards int) *ShardedConfiguration {
+	c := newShardTestConfiguration()
+	return &ShardedConfiguration{
+		Behaviours: c.Behaviours,
+		Beliefs:    c.Beliefs,
+		Prs:        c.Prs,
+		Agents: func(f func(*AgentSpec) error) error {
+			for _, agent := range c.Agents {
+				err := f(NewAgentSpecFromAgent(agent))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		StartTime: c.StartTime,
+		EndTime:   c.EndTime,
+		Seed:      c.Seed,
+		NShards:   nShards,
+	}
+}
+
+func runUnsharded(t *testing.T) *Result {
+	r := Runner{Configuration: newShardTestConfiguration(), Logger: zap.NewNop()}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestShardedRunnerMatchesRunner(t *testing.T) {
+	expected := runUnsharded(t)
+
+	for _, nShards := range []int{1, 2, 5} {
+		r := ShardedRunner{
+			Configuration: newShardedTestConfiguration(nShards),
+			Logger:        zap.NewNop(),
+		}
+		res, err := r.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(res.Summary, expected.Summary) {
+			t.Errorf("Summary with %d shards should match the unsharded summary", nShards)
+		}
+		if !reflect.DeepEqual(res.FailedUpdates, expected.FailedUpdates) {
+			t.Errorf("FailedUpdates with %d shards should match", nShards)
+		}
+	}
+}
+
+func TestShardedRunnerBurnIn(t *testing.T) {
+	expected := runUnsharded(t)
+	for time := b.SimTime(1); time <= 4; time++ {
+		delete(expected.Summary.Data, time)
+	}
+
+	c := newShardedTestConfiguration(2)
+	c.BurnIn = 4
+	r := ShardedRunner{Configuration: c, Logger: zap.NewNop()}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(res.Summary, expected.Summary) {
+		t.Error("Summary should only include the ticks after the burn-in")
+	}
+}
+
+func TestShardedRunnerWithWorkerProcesses(t *testing.T) {
+	expected := runUnsharded(t)
+
+	c := newShardedTestConfiguration(3)
+	c.WorkerCommand = func(address string) *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=TestShardWorkerProcess")
+		cmd.Env = append(os.Environ(), "GOBELIEF_SHARD_ADDRESS="+address)
+		return cmd
+	}
+	r := ShardedRunner{Configuration: c, Logger: zap.NewNop()}
+	res, err := r.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(res.Summary, expected.Summary) {
+		t.Error("Summary should match the unsharded summary")
+	}
+}
+
+// cancellingContext is a context which is done from the nth time Err is
+// called, when it first calls cancel, so a run can be cancelled at a tick.
+type cancellingContext struct {
+	context.Context
+	n      int
+	cancel func()
+}
+
+func (c *cancellingContext) Err() error {
+	c.n--
+	if c.n > 0 {
+		return nil
+	}
+	if c.n == 0 && c.cancel != nil {
+		// The tick which is starting runs as it is cancelled.
+		c.cancel()
+		return nil
+	}
+	return context.Canceled
+}
+
+func TestShardedRunnerWritesTruncatedOutputWhenCancelled(t *testing.T) {
+	expected := runUnsharded(t)
+
+	c := newShardedTestConfiguration(2)
+	c.OutputFile = new(bytes.Buffer)
+	r := ShardedRunner{Configuration: c, Logger: zap.NewNop()}
+	res, err := r.RunContext(&cancellingContext{Context: context.Background(), n: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := readTestOutput(t, &Configuration{OutputFile: c.OutputFile})
+	if !specs.Truncated || specs.StopReason != StopReasonCancelled || specs.LastTick != 3 {
+		t.Fatalf("Expected the output to be truncated after tick 3, got %v at %d", specs.StopReason, specs.LastTick)
+	}
+	for time := b.SimTime(4); time <= c.EndTime; time++ {
+		delete(expected.Summary.Data, time)
+	}
+	if !reflect.DeepEqual(res.Summary.Data, expected.Summary.Data) {
+		t.Error("Summary should match the unsharded summary until it was cancelled")
+	}
+}
+
+func TestShardedRunnerWritesTruncatedOutputWhenWorkersAreInterrupted(t *testing.T) {
+	var workers []*exec.Cmd
+	c := newShardedTestConfiguration(3)
+	c.OutputFile = new(bytes.Buffer)
+	c.WorkerCommand = func(address string) *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=TestShardWorkerProcess")
+		cmd.Env = append(os.Environ(), "GOBELIEF_SHARD_ADDRESS="+address)
+		workers = append(workers, cmd)
+		return cmd
+	}
+
+	// The workers are killed as the fourth tick starts, as they would be if
+	// they were interrupted by Ctrl-C along with the coordinator.
+	ctx := &cancellingContext{Context: context.Background(), n: 4, cancel: func() {
+		for _, worker := range workers {
+			worker.Process.Kill()
+			worker.Process.Wait()
+		}
+	}}
+	r := ShardedRunner{Configuration: c, Logger: zap.NewNop()}
+	_, err := r.RunContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := readTestOutput(t, &Configuration{OutputFile: c.OutputFile})
+	if !specs.Truncated || specs.LastTick != 3 || len(specs.Data) != 3 {
+		t.Fatalf("Expected the output to be truncated after tick 3, got %v at %d", specs.StopReason, specs.LastTick)
+	}
+}
+
+// TestShardWorkerProcess is run as a worker process by
+// TestShardedRunnerWithWorkerProcesses.
+func TestShardWorkerProcess(t *testing.T) {
+	address := os.Getenv("GOBELIEF_SHARD_ADDRESS")
+	if address == "" {
+		t.Skip("Not a worker process")
+	}
+
+	err := ServeShard(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	// Two triangles joined by a single edge.
+	offsets := []int{0, 2, 4, 7, 9, 11, 13}
+	columns := []int32{1, 2, 0, 2, 0, 1, 3, 4, 5, 3, 5, 3, 4}
+
+	shards := partition(offsets, columns, 2)
+
+	expected := []int{0, 0, 0, 1, 1, 1}
+	if !reflect.DeepEqual(shards, expected) {
+		t.Errorf("shards should be %v; they were %v", expected, shards)
+	}
+
+	shards = partition(offsets, columns, 4)
+	sizes := make([]int, 4)
+	for _, s := range shards {
+		sizes[s]++
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1, 1}) {
+		t.Errorf("sizes should be [2 2 1 1]; they were %v", sizes)
+	}
+}
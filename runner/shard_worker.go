@@ -0,0 +1,331 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/rpc"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/0xr0bert/gobelief/dense"
+	"github.com/0xr0bert/gobelief/runner/internal/shardrpc"
+	"github.com/google/uuid"
+)
+
+// ServeShard runs a worker of a ShardedRunner, which connects to the
+// coordinator at the Unix socket address.
+//
+// This returns once the coordinator closes the connection.
+func ServeShard(address string) error {
+	conn, err := net.Dial("unix", address)
+	if err != nil {
+		return err
+	}
+
+	server := rpc.NewServer()
+	err = server.RegisterName(shardrpc.ServiceName, new(shardWorker))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	server.ServeConn(conn)
+	return nil
+}
+
+// shardWorker simulates one shard of a ShardedRunner.
+//
+// The coordinator calls Setup, then AddAgents until every agent of the shard
+// has been added, then Start. At every tick it calls Step, then Deviations,
+// then Count until it has found the median activation of every belief.
+type shardWorker struct {
+	behaviours []*b.Behaviour
+	beliefs    []*b.Belief
+	prs        PerformanceRelationships
+	time       b.SimTime
+	seed       int64
+	precision  dense.Precision
+
+	agents  []*b.Agent
+	ghosts  []*b.Agent
+	exports []int
+	// The agents and ghosts, which are created by Setup so friends can be
+	// linked as agents are added.
+	uuidAgents map[uuid.UUID]*b.Agent
+	// Whether each agent has been added.
+	added map[uuid.UUID]bool
+
+	model   *dense.Model
+	medians []medianSearch
+}
+
+// medianSearch is the state of the search of a shard for the median activation
+// of a belief.
+//
+// At each step of the search, the activations which are no greater than the
+// previous threshold are partitioned to the front of candidates. Depending on
+// whether the next threshold is greater or smaller, either those activations
+// will always be counted, or the others never will, so only the remaining
+// candidates are searched.
+type medianSearch struct {
+	// The keys of the activations of every agent.
+	keys []uint64
+	// The keys which have been neither counted nor discarded by the search.
+	candidates []uint64
+	// The number of activations which are no greater than every remaining
+	// threshold.
+	base uint64
+	// The previous threshold, and the number of candidates no greater than
+	// it.
+	threshold uint64
+	split     int
+	searched  bool
+}
+
+func (w *shardWorker) Setup(args *shardrpc.SetupArgs, _ *shardrpc.Empty) error {
+	var behaviourSpecs []BehaviourSpec
+	err := json.Unmarshal(args.Behaviours, &behaviourSpecs)
+	if err != nil {
+		return err
+	}
+	w.behaviours = make([]*b.Behaviour, len(behaviourSpecs))
+	uuidBehaviours := make(map[uuid.UUID]*b.Behaviour, len(behaviourSpecs))
+	for i, spec := range behaviourSpecs {
+		w.behaviours[i] = spec.ToBehaviour()
+		uuidBehaviours[spec.Uuid] = w.behaviours[i]
+	}
+
+	var beliefSpecs []BeliefSpec
+	err = json.Unmarshal(args.Beliefs, &beliefSpecs)
+	if err != nil {
+		return err
+	}
+	w.beliefs = make([]*b.Belief, len(beliefSpecs))
+	uuidBeliefs := make(map[uuid.UUID]*b.Belief, len(beliefSpecs))
+	for i, spec := range beliefSpecs {
+		w.beliefs[i] = spec.ToBelief(w.behaviours)
+		uuidBeliefs[spec.Uuid] = w.beliefs[i]
+	}
+	for _, spec := range beliefSpecs {
+		spec.LinkBeliefRelationships(w.beliefs)
+	}
+
+	var prsSpecs []PerformanceRelationshipSpec
+	err = json.Unmarshal(args.Prs, &prsSpecs)
+	if err != nil {
+		return err
+	}
+	w.prs = PRSSpecToPerformanceRelationships(prsSpecs, uuidBeliefs, uuidBehaviours)
+
+	w.time = args.Time
+	w.seed = args.Seed
+	w.precision = dense.Precision(args.Precision)
+
+	w.uuidAgents = make(map[uuid.UUID]*b.Agent, len(args.Agents)+len(args.Ghosts))
+	w.added = make(map[uuid.UUID]bool, len(args.Agents))
+	w.agents = make([]*b.Agent, len(args.Agents))
+	for i, u := range args.Agents {
+		w.agents[i] = b.NewAgent()
+		w.agents[i].Uuid = u
+		w.uuidAgents[u] = w.agents[i]
+	}
+	w.ghosts = make([]*b.Agent, len(args.Ghosts))
+	for k, u := range args.Ghosts {
+		w.ghosts[k] = b.NewAgent()
+		w.ghosts[k].Uuid = u
+		w.uuidAgents[u] = w.ghosts[k]
+	}
+
+	indices := make(map[uuid.UUID]int, len(args.Agents))
+	for i, u := range args.Agents {
+		indices[u] = i
+	}
+	w.exports = make([]int, len(args.Exports))
+	for e, u := range args.Exports {
+		i, found := indices[u]
+		if !found {
+			return fmt.Errorf("exported agent %v is not in the shard", u)
+		}
+		w.exports[e] = i
+	}
+
+	return nil
+}
+
+func (w *shardWorker) AddAgents(args *shardrpc.AddAgentsArgs, _ *shardrpc.Empty) error {
+	for _, data := range args.Agents {
+		var spec AgentSpec
+		err := json.Unmarshal(data, &spec)
+		if err != nil {
+			return err
+		}
+
+		agent := w.uuidAgents[spec.Uuid]
+		if agent == nil || agent.Uuid != spec.Uuid || w.added[spec.Uuid] {
+			return fmt.Errorf("agent %v is not in the shard", spec.Uuid)
+		}
+		w.added[spec.Uuid] = true
+
+		*agent = *spec.ToAgent(w.behaviours, w.beliefs)
+		spec.LinkFriends(w.uuidAgents)
+	}
+
+	return nil
+}
+
+func (w *shardWorker) Start(_ *shardrpc.Empty, reply *shardrpc.StepReply) error {
+	if len(w.added) != len(w.agents) {
+		return errors.New("not every agent of the shard has been added")
+	}
+
+	w.model = dense.NewWithGhosts(
+		w.agents,
+		w.ghosts,
+		w.beliefs,
+		w.behaviours,
+		w.prs,
+		w.time,
+		w.precision,
+	)
+	w.uuidAgents = nil
+	w.added = nil
+	w.medians = make([]medianSearch, len(w.beliefs))
+
+	reply.Exports = w.exportedActions()
+	return nil
+}
+
+func (w *shardWorker) Step(args *shardrpc.StepArgs, reply *shardrpc.StepReply) error {
+	if len(args.GhostActions) != len(w.ghosts) {
+		return errors.New("wrong number of ghost actions")
+	}
+
+	nAgents := w.model.NAgents()
+	for k, action := range args.GhostActions {
+		w.model.SetAction(nAgents+k, int(action))
+	}
+
+	failed, err := w.model.UpdateActivations(args.Time)
+	reply.Failed = failed
+	if err != nil {
+		reply.Error = err.Error()
+	}
+
+	performActionsDense(w.model, w.seed)
+
+	reply.Exports = w.exportedActions()
+
+	nBeliefs := len(w.beliefs)
+	reply.Sums = make([][]int64, nBeliefs)
+	reply.Found = make([]bool, nBeliefs)
+	reply.Nonzero = make([]uint64, nBeliefs)
+	for j := range w.beliefs {
+		sum := newExactSum()
+		search := &w.medians[j]
+		search.keys = search.keys[:0]
+		search.base = 0
+		search.searched = false
+		for i := 0; i < nAgents; i++ {
+			act, ok := w.model.Activation(i, j)
+			if ok {
+				reply.Found[j] = true
+				sum.Add(act)
+				if act != 0.0 {
+					reply.Nonzero[j]++
+				}
+			}
+			search.keys = append(search.keys, orderedKey(act))
+		}
+		search.candidates = search.keys
+		reply.Sums[j] = sum.Limbs
+	}
+
+	reply.Performers = make([]uint64, len(w.behaviours))
+	for i := 0; i < nAgents; i++ {
+		action := w.model.Action(i)
+		if action >= 0 {
+			reply.Performers[action]++
+		}
+	}
+
+	return nil
+}
+
+func (w *shardWorker) Deviations(args *shardrpc.DeviationsArgs, reply *shardrpc.DeviationsReply) error {
+	reply.Sums = make([][]int64, len(w.beliefs))
+	for j := range w.beliefs {
+		sum := newExactSum()
+		for i := 0; i < w.model.NAgents(); i++ {
+			act, ok := w.model.Activation(i, j)
+			if ok {
+				sum.Add(math.Pow(act-args.Means[j], 2.0))
+			}
+		}
+		reply.Sums[j] = sum.Limbs
+	}
+	return nil
+}
+
+func (w *shardWorker) Count(args *shardrpc.CountArgs, reply *shardrpc.CountReply) error {
+	reply.Counts = make([]uint64, len(w.beliefs))
+	for j, threshold := range args.Thresholds {
+		reply.Counts[j] = w.medians[j].count(threshold)
+	}
+	return nil
+}
+
+// count gets the number of activations which are no greater than threshold.
+func (s *medianSearch) count(threshold uint64) uint64 {
+	if s.searched {
+		switch {
+		case threshold == s.threshold:
+			return s.base + uint64(s.split)
+		case threshold > s.threshold:
+			s.base += uint64(s.split)
+			s.candidates = s.candidates[s.split:]
+		default:
+			s.candidates = s.candidates[:s.split]
+		}
+	}
+
+	split := 0
+	for i, key := range s.candidates {
+		if key <= threshold {
+			s.candidates[i], s.candidates[split] = s.candidates[split], s.candidates[i]
+			split++
+		}
+	}
+
+	s.threshold = threshold
+	s.split = split
+	s.searched = true
+	return s.base + uint64(split)
+}
+
+// exportedActions gets the actions of the exported agents.
+func (w *shardWorker) exportedActions() []int32 {
+	actions := make([]int32, len(w.exports))
+	for e, i := range w.exports {
+		actions[e] = int32(w.model.Action(i))
+	}
+	return actions
+}
+
+// orderedKey maps a float64 to a uint64 with the same order.
+func orderedKey(x float64) uint64 {
+	bits := math.Float64bits(x)
+	if bits>>63 != 0 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
+
+// fromOrderedKey is the inverse of orderedKey.
+func fromOrderedKey(key uint64) float64 {
+	if key>>63 != 0 {
+		return math.Float64frombits(key &^ (1 << 63))
+	}
+	return math.Float64frombits(^key)
+}
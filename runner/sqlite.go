@@ -0,0 +1,263 @@
+package runner
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+
+	// Registers the pure-Go "sqlite" database/sql driver.
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of a SQLite database of runs, unless they
+// already exist, so that many runs can be collected in one database.
+//
+// Every table other than runs is keyed by the runId of the run.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	runId INTEGER PRIMARY KEY,
+	label TEXT NOT NULL,
+	created TEXT NOT NULL,
+	seed INTEGER NOT NULL,
+	startTime INTEGER NOT NULL,
+	endTime INTEGER NOT NULL,
+	lastTick INTEGER NOT NULL,
+	stopReason TEXT NOT NULL,
+	truncated INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ticks (
+	runId INTEGER NOT NULL REFERENCES runs (runId),
+	tick INTEGER NOT NULL,
+	PRIMARY KEY (runId, tick)
+);
+CREATE TABLE IF NOT EXISTS beliefs (
+	runId INTEGER NOT NULL REFERENCES runs (runId),
+	uuid TEXT NOT NULL,
+	name TEXT NOT NULL,
+	PRIMARY KEY (runId, uuid)
+);
+CREATE TABLE IF NOT EXISTS behaviours (
+	runId INTEGER NOT NULL REFERENCES runs (runId),
+	uuid TEXT NOT NULL,
+	name TEXT NOT NULL,
+	PRIMARY KEY (runId, uuid)
+);
+CREATE TABLE IF NOT EXISTS summary (
+	runId INTEGER NOT NULL REFERENCES runs (runId),
+	tick INTEGER NOT NULL,
+	entityType TEXT NOT NULL,
+	entityUuid TEXT NOT NULL,
+	statistic TEXT NOT NULL,
+	value REAL
+);
+CREATE INDEX IF NOT EXISTS summaryTick ON summary (runId, tick);
+CREATE TABLE IF NOT EXISTS activations (
+	runId INTEGER NOT NULL REFERENCES runs (runId),
+	tick INTEGER NOT NULL,
+	agent TEXT NOT NULL,
+	belief TEXT NOT NULL,
+	activation REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS activationsTick ON activations (runId, tick);
+CREATE INDEX IF NOT EXISTS activationsAgent ON activations (runId, agent);
+CREATE TABLE IF NOT EXISTS actions (
+	runId INTEGER NOT NULL REFERENCES runs (runId),
+	tick INTEGER NOT NULL,
+	agent TEXT NOT NULL,
+	behaviour TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS actionsTick ON actions (runId, tick);
+CREATE INDEX IF NOT EXISTS actionsAgent ON actions (runId, agent);
+`
+
+// SqliteRun is a run of a simulation, written to a SQLite database by
+// WriteSqliteRun.
+type SqliteRun struct {
+	// A label identifying the run, which may be empty.
+	Label string
+	// The start and end times of the simulation.
+	StartTime b.SimTime
+	EndTime   b.SimTime
+	// The behaviours and beliefs in the simulation.
+	Behaviours []*b.Behaviour
+	Beliefs    []*b.Belief
+	// The summary statistics of the run.
+	Summary *OutputSpecs
+	// The agents whose activations and actions at every tick of their
+	// history are written, or nil if they should not be written.
+	Agents []*b.Agent
+}
+
+// OpenSqlite opens the SQLite database at path, creating it if it does not
+// exist.
+func OpenSqlite(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", path)
+}
+
+// WriteSqliteRun adds a run to the SQLite database db in a single transaction,
+// creating the tables if they do not exist, and returns its runId.
+//
+// The tables are:
+//   - runs, with the label, seed, start and end time, last tick and stop
+//     reason of each run;
+//   - ticks, with each tick of each run in the summary;
+//   - beliefs and behaviours, with the UUID and name of each;
+//   - summary, the tidy table of WriteTidySummary, where missing values are
+//     NULL; and
+//   - activations and actions, with the state of each agent at each tick, if
+//     the run has Agents.
+//
+// The summary, activations and actions are indexed by tick, and the
+// activations and actions by agent.
+func WriteSqliteRun(db *sql.DB, run *SqliteRun) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	runId, err := writeSqliteRun(tx, run)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return runId, tx.Commit()
+}
+
+func writeSqliteRun(tx *sql.Tx, run *SqliteRun) (int64, error) {
+	_, err := tx.Exec(sqliteSchema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO runs (label, created, seed, startTime, endTime, lastTick, stopReason, truncated) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		run.Label,
+		time.Now().UTC().Format(time.RFC3339),
+		run.Summary.Seed,
+		run.StartTime,
+		run.EndTime,
+		run.Summary.LastTick,
+		string(run.Summary.StopReason),
+		run.Summary.Truncated,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert run: %w", err)
+	}
+	runId, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	insert := func(query string, rows func(exec func(args ...any) error) error) error {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		return rows(func(args ...any) error {
+			_, err := stmt.Exec(append([]any{runId}, args...)...)
+			return err
+		})
+	}
+
+	err = insert("INSERT INTO ticks (runId, tick) VALUES (?, ?)", func(exec func(args ...any) error) error {
+		for time := range run.Summary.Data {
+			err := exec(time)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert ticks: %w", err)
+	}
+
+	err = insert("INSERT INTO beliefs (runId, uuid, name) VALUES (?, ?, ?)", func(exec func(args ...any) error) error {
+		for _, belief := range run.Beliefs {
+			err := exec(belief.Uuid.String(), belief.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert beliefs: %w", err)
+	}
+
+	err = insert("INSERT INTO behaviours (runId, uuid, name) VALUES (?, ?, ?)", func(exec func(args ...any) error) error {
+		for _, behaviour := range run.Behaviours {
+			err := exec(behaviour.Uuid.String(), behaviour.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert behaviours: %w", err)
+	}
+
+	err = insert(
+		"INSERT INTO summary (runId, tick, entityType, entityUuid, statistic, value) VALUES (?, ?, ?, ?, ?, ?)",
+		func(exec func(args ...any) error) error {
+			return forEachTidyRow(run.Summary, run.Behaviours, run.Beliefs, func(row tidyRow) error {
+				var value any
+				if !math.IsNaN(row.Value) {
+					value = row.Value
+				}
+				return exec(row.Tick, row.EntityType, row.EntityUuid.String(), row.Statistic, value)
+			})
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert summary: %w", err)
+	}
+
+	err = insert(
+		"INSERT INTO activations (runId, tick, agent, belief, activation) VALUES (?, ?, ?, ?, ?)",
+		func(exec func(args ...any) error) error {
+			for _, a := range run.Agents {
+				agentUuid := a.Uuid.String()
+				for time, acts := range a.Activations {
+					for belief, activation := range acts {
+						err := exec(time, agentUuid, belief.Uuid.String(), activation)
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert activations: %w", err)
+	}
+
+	err = insert(
+		"INSERT INTO actions (runId, tick, agent, behaviour) VALUES (?, ?, ?, ?)",
+		func(exec func(args ...any) error) error {
+			for _, a := range run.Agents {
+				agentUuid := a.Uuid.String()
+				for time, behaviour := range a.Actions {
+					err := exec(time, agentUuid, behaviour.Uuid.String())
+					if err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert actions: %w", err)
+	}
+
+	return runId, nil
+}
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSqliteRunCollectsRuns(t *testing.T) {
+	summary, behaviours, beliefs := newTestSummary()
+	_, _, _, agents := newTestFullOutput(t)
+
+	db, err := OpenSqlite(filepath.Join(t.TempDir(), "runs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	run := &SqliteRun{
+		Label:      "summary",
+		StartTime:  1,
+		EndTime:    2,
+		Behaviours: behaviours,
+		Beliefs:    beliefs,
+		Summary:    summary,
+	}
+	first, err := WriteSqliteRun(db, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run.Label = "full"
+	run.Agents = agents
+	second, err := WriteSqliteRun(db, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("Expected different run IDs, got %d", first)
+	}
+
+	count := func(query string, args ...any) int {
+		t.Helper()
+		var n int
+		err := db.QueryRow(query, args...).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if n := count("SELECT COUNT(*) FROM runs"); n != 2 {
+		t.Errorf("Expected 2 runs, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM ticks WHERE runId = ?", first); n != 2 {
+		t.Errorf("Expected 2 ticks, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM summary WHERE runId = ?", first); n != 10 {
+		t.Errorf("Expected 10 summary rows, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM summary WHERE value IS NULL"); n != 2 {
+		t.Errorf("Expected a missing value in each run, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM activations WHERE runId = ?", first); n != 0 {
+		t.Errorf("Expected no activations without agents, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM activations WHERE runId = ?", second); n != 15 {
+		t.Errorf("Expected 15 activations, got %d", n)
+	}
+	if n := count("SELECT COUNT(*) FROM actions WHERE runId = ? AND tick = 4", second); n != 3 {
+		t.Errorf("Expected 3 actions at tick 4, got %d", n)
+	}
+
+	var name string
+	var value sql.NullFloat64
+	err = db.QueryRow(
+		`SELECT beliefs.name, summary.value FROM summary
+		JOIN beliefs ON beliefs.runId = summary.runId AND beliefs.uuid = summary.entityUuid
+		WHERE summary.runId = ? AND summary.tick = 2 AND summary.statistic = 'meanActivation'`,
+		second,
+	).Scan(&name, &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "belief" || value.Float64 != 0.25 {
+		t.Errorf("Unexpected mean activation of %q: %v", name, value)
+	}
+}
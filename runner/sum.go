@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"math"
+	"math/big"
+)
+
+const (
+	// The number of bits of each limb of an exactSum which are filled by a
+	// single value.
+	limbBits = 32
+	// The exponent of the least significant bit of the smallest subnormal
+	// float64.
+	minExponent = -1074
+	// The number of limbs needed to hold the sum of any finite float64 values.
+	nLimbs = (2048+53)/limbBits + 2
+	// The number of values which may be added before the limbs must be
+	// normalised to avoid overflow.
+	maxPending = 1 << 30
+)
+
+// exactSum is the exact sum of finite float64 values.
+//
+// The sum does not depend on the order in which the values are added, so sums
+// calculated in parts, such as by the shards of a ShardedRunner, are identical
+// to sums calculated all at once. It is rounded to the nearest float64 only
+// when it is read.
+//
+// The value is the sum of Limbs[i] * 2^(limbBits*i + minExponent).
+type exactSum struct {
+	Limbs []int64
+	// The number of values added since the limbs were last normalised.
+	Pending int
+}
+
+func newExactSum() *exactSum {
+	return &exactSum{Limbs: make([]int64, nLimbs)}
+}
+
+// Add adds a finite value to the sum.
+func (s *exactSum) Add(x float64) {
+	if x == 0 {
+		return
+	}
+
+	bits := math.Float64bits(x)
+	// x = mantissa * 2^(exponent-1075), where the biased exponent of
+	// subnormal values is 1 rather than 0.
+	exponent := int(bits >> 52 & 0x7ff)
+	mantissa := bits & (1<<52 - 1)
+	if exponent == 0 {
+		exponent = 1
+	} else {
+		mantissa |= 1 << 52
+	}
+
+	position := exponent - 1075 - minExponent
+	i := position / limbBits
+	shift := position % limbBits
+	// The mantissa has at most 53 bits, so the shifted value spans three
+	// limbs.
+	low := mantissa << shift
+	parts := [3]int64{
+		int64(low & (1<<limbBits - 1)),
+		int64(low >> limbBits),
+		int64(mantissa >> (2*limbBits - shift)),
+	}
+	if bits>>63 != 0 {
+		for k := range parts {
+			parts[k] = -parts[k]
+		}
+	}
+	for k, part := range parts {
+		s.Limbs[i+k] += part
+	}
+
+	s.Pending++
+	if s.Pending == maxPending {
+		s.normalise()
+	}
+}
+
+// Merge adds another sum to this sum.
+func (s *exactSum) Merge(other *exactSum) {
+	s.normalise()
+	for i, limb := range other.Limbs {
+		s.Limbs[i] += limb
+	}
+	s.normalise()
+}
+
+// Float64 gets the sum, rounded to the nearest float64.
+func (s *exactSum) Float64() float64 {
+	total := new(big.Int)
+	limb := new(big.Int)
+	for i := len(s.Limbs) - 1; i >= 0; i-- {
+		total.Lsh(total, limbBits)
+		total.Add(total, limb.SetInt64(s.Limbs[i]))
+	}
+
+	f := new(big.Float).SetInt(total)
+	f.SetMantExp(f, minExponent)
+	result, _ := f.Float64()
+	return result
+}
+
+// normalise carries the excess of each limb into the next limb, so each limb
+// is in [0, 2^limbBits) except the last, which holds the sign.
+func (s *exactSum) normalise() {
+	for i := 0; i < len(s.Limbs)-1; i++ {
+		carry := s.Limbs[i] >> limbBits
+		s.Limbs[i] -= carry << limbBits
+		s.Limbs[i+1] += carry
+	}
+	s.Pending = 0
+}
@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func TestExactSumIsCorrectlyRounded(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := []float64{
+		0.1,
+		0.2,
+		-0.3,
+		1e300,
+		-1e300,
+		math.SmallestNonzeroFloat64,
+		-math.MaxFloat64 / 2,
+		math.MaxFloat64 / 2,
+	}
+	for i := 0; i < 1000; i++ {
+		values = append(values, math.Ldexp(rng.Float64()-0.5, rng.Intn(200)-100))
+	}
+
+	expected := new(big.Float).SetPrec(4096)
+	for _, v := range values {
+		expected.Add(expected, new(big.Float).SetFloat64(v))
+	}
+	want, _ := expected.Float64()
+
+	s := newExactSum()
+	for _, v := range values {
+		s.Add(v)
+	}
+
+	if s.Float64() != want {
+		t.Errorf("s.Float64() should be %g; it was %g", want, s.Float64())
+	}
+}
+
+func TestExactSumDoesNotDependOnOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = rng.Float64()*2 - 1
+	}
+
+	s1 := newExactSum()
+	for _, v := range values {
+		s1.Add(v)
+	}
+
+	rng.Shuffle(len(values), func(i, j int) {
+		values[i], values[j] = values[j], values[i]
+	})
+
+	s2 := newExactSum()
+	s3 := newExactSum()
+	for i, v := range values {
+		if i%2 == 0 {
+			s2.Add(v)
+		} else {
+			s3.Add(v)
+		}
+	}
+	s2.Merge(s3)
+
+	if s1.Float64() != s2.Float64() {
+		t.Errorf("s2.Float64() should be %g; it was %g", s1.Float64(), s2.Float64())
+	}
+}
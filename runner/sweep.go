@@ -0,0 +1,206 @@
+package runner
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Sweep runs a simulation at each of several points in parameter space, with a
+// bounded number of runs at once.
+type Sweep struct {
+	// NewConfiguration creates a Configuration of the base scenario. Each
+	// Configuration must have its own agents and beliefs, as the Parameters of
+	// a point are applied to them.
+	NewConfiguration func() (*Configuration, error)
+	// The Parameters of each run.
+	Points []Parameters
+	// The maximum number of runs at once, or 0 to run every point at once.
+	Concurrency int
+	// The logger of each Runner.
+	Logger *zap.Logger
+}
+
+// Run the sweep.
+//
+// This returns the Result of the run at every point, and the first error. The
+// Result of a point whose run failed is nil, and the other points are still
+// run.
+func (s *Sweep) Run() ([]*Result, error) {
+	return s.RunContext(context.Background())
+}
+
+// RunContext runs the sweep, stopping every run when ctx is done.
+//
+// This returns the Result of the run at every point, and the first error. The
+// Result of a point whose run failed is nil, and the other points are still
+// run.
+func (s *Sweep) RunContext(ctx context.Context) ([]*Result, error) {
+	replicates := Replicates{
+		NewConfiguration: func(i int) (*Configuration, error) {
+			c, err := s.NewConfiguration()
+			if err != nil {
+				return nil, err
+			}
+			err = s.Points[i].Apply(c)
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+		N:           len(s.Points),
+		Concurrency: s.Concurrency,
+		Logger:      s.Logger,
+	}
+
+	results, errs := replicates.runAll(ctx)
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			results[i] = nil
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return results, firstErr
+}
+
+// WriteSweepTable writes the summary statistics of the runs of a sweep as a
+// CSV table with a row for each run and tick.
+//
+// The table is indexed by the "run" and "tick" columns, and has a column for
+// each parameter, the seed and stop reason of the run, and each statistic of
+// each belief and behaviour, named "<statistic>:<name>", or
+// "<statistic>:<uuid>" if another belief or behaviour has the same name.
+// Statistics which are missing from the summary of a run are left empty, except
+// NPerformers and NonzeroActivationCount, which are 0.
+//
+// A run whose summary is nil, because it failed, has a single row with its
+// parameters and the stop reason "failed", and no tick or statistics.
+func WriteSweepTable(
+	w io.Writer,
+	points []Parameters,
+	summaries []*OutputSpecs,
+	beliefs []*b.Belief,
+	behaviours []*b.Behaviour,
+) error {
+	allParameters := make(Parameters)
+	for _, point := range points {
+		for name := range point {
+			allParameters[name] = 0
+		}
+	}
+	parameterNames := sortedKeys(allParameters)
+
+	header := []string{"run"}
+	header = append(header, parameterNames...)
+	header = append(header, "seed", "stopReason", "tick")
+	beliefNames := make(map[string]int, len(beliefs))
+	for _, belief := range beliefs {
+		beliefNames[belief.Name]++
+	}
+	for _, belief := range beliefs {
+		name := belief.Name
+		if beliefNames[name] > 1 {
+			name = belief.Uuid.String()
+		}
+		for _, statistic := range []string{
+			"meanActivation",
+			"sdActivation",
+			"medianActivation",
+			"nonzeroActivationCount",
+		} {
+			header = append(header, statistic+":"+name)
+		}
+	}
+	behaviourNames := make(map[string]int, len(behaviours))
+	for _, behaviour := range behaviours {
+		behaviourNames[behaviour.Name]++
+	}
+	for _, behaviour := range behaviours {
+		name := behaviour.Name
+		if behaviourNames[name] > 1 {
+			name = behaviour.Uuid.String()
+		}
+		header = append(header, "nPerformers:"+name)
+	}
+
+	writer := csv.NewWriter(w)
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	formatFloat := func(m map[uuid.UUID]float64, u uuid.UUID) string {
+		v, found := m[u]
+		if !found {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+
+	for run, summary := range summaries {
+		prefix := []string{strconv.Itoa(run)}
+		for _, name := range parameterNames {
+			v, found := points[run][name]
+			if found {
+				prefix = append(prefix, strconv.FormatFloat(v, 'g', -1, 64))
+			} else {
+				prefix = append(prefix, "")
+			}
+		}
+		if summary == nil {
+			row := append(prefix, "", "failed")
+			row = append(row, make([]string, len(header)-len(row))...)
+			err = writer.Write(row)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		prefix = append(
+			prefix,
+			strconv.FormatInt(summary.Seed, 10),
+			string(summary.StopReason),
+		)
+
+		ticks := make([]b.SimTime, 0, len(summary.Data))
+		for time := range summary.Data {
+			ticks = append(ticks, time)
+		}
+		sort.Slice(ticks, func(i, j int) bool { return ticks[i] < ticks[j] })
+
+		for _, time := range ticks {
+			spec := summary.Data[time]
+			row := append([]string(nil), prefix...)
+			row = append(row, strconv.FormatUint(uint64(time), 10))
+			for _, belief := range beliefs {
+				row = append(
+					row,
+					formatFloat(spec.MeanActivation, belief.Uuid),
+					formatFloat(spec.SDActivation, belief.Uuid),
+					formatFloat(spec.MedianActivation, belief.Uuid),
+					strconv.FormatUint(spec.NonzeroActivationCount[belief.Uuid], 10),
+				)
+			}
+			for _, behaviour := range behaviours {
+				row = append(row, strconv.FormatUint(spec.NPerformers[behaviour.Uuid], 10))
+			}
+			err = writer.Write(row)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSweep(t *testing.T) {
+	points := Grid([]string{"endTime", "deltaScale"}, [][]float64{{2, 3}, {0, 1}})
+	s := Sweep{
+		NewConfiguration: func() (*Configuration, error) {
+			return newRandomConfiguration(1, 20, 2), nil
+		},
+		Points:      points,
+		Concurrency: 2,
+		Logger:      zap.NewNop(),
+	}
+
+	results, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summaries := make([]*OutputSpecs, len(results))
+	for i, result := range results {
+		summaries[i] = result.Summary
+	}
+
+	c := newRandomConfiguration(1, 20, 2)
+	var buf bytes.Buffer
+	err = WriteSweepTable(&buf, points, summaries, c.Beliefs, c.Behaviours)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 points with 2 ticks, and 2 points with 3 ticks.
+	if len(rows) != 1+2*2+2*3 {
+		t.Fatalf("There should be 11 rows; there were %d", len(rows))
+	}
+
+	expectedHeader := 1 + 2 + 3 + 2*4 + 3
+	if len(rows[0]) != expectedHeader {
+		t.Errorf("There should be %d columns; there were %d", expectedHeader, len(rows[0]))
+	}
+
+	if rows[0][1] != "deltaScale" || rows[0][2] != "endTime" {
+		t.Errorf("The parameter columns should be sorted; they were %v", rows[0][1:3])
+	}
+
+	if rows[1][0] != "0" || rows[1][1] != "0" || rows[1][2] != "2" || rows[1][5] != "1" {
+		t.Errorf("The first row should be run 0 at tick 1; it was %v", rows[1])
+	}
+}
+
+func TestSweepTableRecordsFailedPoints(t *testing.T) {
+	points := []Parameters{{"endTime": 2}, {"endTime": 1.5}}
+	s := Sweep{
+		NewConfiguration: func() (*Configuration, error) {
+			return newRandomConfiguration(1, 20, 2), nil
+		},
+		Points: points,
+		Logger: zap.NewNop(),
+	}
+
+	results, err := s.Run()
+	if err == nil {
+		t.Fatal("Expected an error for an invalid end time")
+	}
+	if results[0] == nil || results[1] != nil {
+		t.Fatalf("Expected only the second point to fail, got %v", results)
+	}
+
+	c := newRandomConfiguration(1, 20, 2)
+	c.Beliefs[1].Name = c.Beliefs[0].Name
+	var buf bytes.Buffer
+	err = WriteSweepTable(&buf, points, []*OutputSpecs{results[0].Summary, nil}, c.Beliefs, c.Behaviours)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+2+1 {
+		t.Fatalf("There should be 4 rows; there were %d", len(rows))
+	}
+	if rows[3][0] != "1" || rows[3][1] != "1.5" || rows[3][3] != "failed" || rows[3][4] != "" {
+		t.Errorf("The last row should record that run 1 failed; it was %v", rows[3])
+	}
+	if rows[0][5] != "meanActivation:"+c.Beliefs[0].Uuid.String() {
+		t.Errorf("Beliefs with the same name should be named by UUID; the header was %v", rows[0])
+	}
+}
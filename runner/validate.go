@@ -0,0 +1,321 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+// Severity is the severity of a Problem.
+type Severity string
+
+const (
+	// SeverityError means the scenario is wrong, such as a value outside its
+	// range, or a reference which will be ignored when it is read.
+	SeverityError Severity = "error"
+	// SeverityWarning means the scenario is valid, but probably not what was
+	// intended.
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is a problem with the input files of a scenario.
+type Problem struct {
+	// The file with the problem.
+	File string
+	// Where the problem is in the file, as a JSON path, such as
+	// "[3].friends.<uuid>", or empty if it is the whole file.
+	Location string
+	// The severity of the problem.
+	Severity Severity
+	// A description of the problem.
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Location == "" {
+		return fmt.Sprintf("%s: %s: %s", p.File, p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", p.File, p.Location, p.Severity, p.Message)
+}
+
+// Validator checks the specs of the input files of a scenario as they are
+// read, reporting every Problem.
+//
+// The specs must be checked in the order behaviours, beliefs, performance
+// relationships, then each agent, then the network if there is one, followed
+// by a call to Finish. The agents are checked one at a time, so they do not
+// need to be held in memory.
+type Validator struct {
+	// The names of the input files, used to locate problems.
+	BehavioursFile string
+	BeliefsFile    string
+	PrsFile        string
+	AgentsFile     string
+	NetworkFile    string
+	// The start time of the simulation, before which every agent must have
+	// an activation for every belief.
+	StartTime b.SimTime
+	// Report is called with every Problem, in the order it is found.
+	Report func(Problem)
+
+	behaviours map[uuid.UUID]bool
+	beliefs    map[uuid.UUID]bool
+	// The UUIDs of the beliefs, in the order of the beliefs file.
+	beliefOrder []uuid.UUID
+	// The beliefs with at least one performance relationship.
+	beliefsWithPrs map[uuid.UUID]bool
+	agents         map[uuid.UUID]bool
+	// References to friends which had not been checked when they were
+	// referred to.
+	pendingFriends []friendReference
+}
+
+// friendReference is a reference by an agent to a friend.
+type friendReference struct {
+	agent  int
+	friend uuid.UUID
+}
+
+// CheckBehaviours checks the specs of the behaviours file.
+func (v *Validator) CheckBehaviours(specs []BehaviourSpec) {
+	v.behaviours = make(map[uuid.UUID]bool, len(specs))
+	for i, spec := range specs {
+		if v.behaviours[spec.Uuid] {
+			v.errorf(v.BehavioursFile, fmt.Sprintf("[%d].uuid", i), "duplicate behaviour UUID %v", spec.Uuid)
+		}
+		v.behaviours[spec.Uuid] = true
+	}
+}
+
+// CheckBeliefs checks the specs of the beliefs file.
+func (v *Validator) CheckBeliefs(specs []BeliefSpec) {
+	v.beliefs = make(map[uuid.UUID]bool, len(specs))
+	for i, spec := range specs {
+		if v.beliefs[spec.Uuid] {
+			v.errorf(v.BeliefsFile, fmt.Sprintf("[%d].uuid", i), "duplicate belief UUID %v", spec.Uuid)
+		} else {
+			v.beliefOrder = append(v.beliefOrder, spec.Uuid)
+		}
+		v.beliefs[spec.Uuid] = true
+	}
+
+	for i, spec := range specs {
+		for _, u := range sortedUuids(spec.Perceptions) {
+			perception := spec.Perceptions[u]
+			location := fmt.Sprintf("[%d].perceptions.%v", i, u)
+			if !v.behaviours[u] {
+				v.errorf(v.BeliefsFile, location, "unknown behaviour %v", u)
+			}
+			v.checkRange(v.BeliefsFile, location, "perception", perception, -1, 1)
+		}
+		for _, u := range sortedUuids(spec.Relationships) {
+			if !v.beliefs[u] {
+				v.errorf(v.BeliefsFile, fmt.Sprintf("[%d].relationships.%v", i, u), "unknown belief %v", u)
+			}
+		}
+	}
+}
+
+// CheckPrs checks the specs of the performance relationships file.
+func (v *Validator) CheckPrs(specs []PerformanceRelationshipSpec) {
+	v.beliefsWithPrs = make(map[uuid.UUID]bool)
+	type pair struct{ belief, behaviour uuid.UUID }
+	seen := make(map[pair]bool, len(specs))
+	for i, spec := range specs {
+		location := fmt.Sprintf("[%d]", i)
+		if !v.beliefs[spec.BeliefUuid] {
+			v.errorf(v.PrsFile, location+".beliefUuid", "unknown belief %v", spec.BeliefUuid)
+		}
+		if !v.behaviours[spec.BehaviourUuid] {
+			v.errorf(v.PrsFile, location+".behaviourUuid", "unknown behaviour %v", spec.BehaviourUuid)
+		}
+		p := pair{spec.BeliefUuid, spec.BehaviourUuid}
+		if seen[p] {
+			v.errorf(v.PrsFile, location, "duplicate performance relationship of belief %v to behaviour %v", p.belief, p.behaviour)
+		}
+		seen[p] = true
+		v.checkRange(v.PrsFile, location+".value", "performance relationship", spec.Value, -1, 1)
+		v.beliefsWithPrs[spec.BeliefUuid] = true
+	}
+}
+
+// CheckAgent checks the spec of the agent at index i of the agents file.
+func (v *Validator) CheckAgent(i int, spec *AgentSpec) {
+	if v.agents == nil {
+		v.agents = make(map[uuid.UUID]bool)
+	}
+	location := fmt.Sprintf("[%d]", i)
+
+	if v.agents[spec.Uuid] {
+		v.errorf(v.AgentsFile, location+".uuid", "duplicate agent UUID %v", spec.Uuid)
+	}
+	v.agents[spec.Uuid] = true
+
+	times := make([]b.SimTime, 0, len(spec.Activations))
+	for time := range spec.Activations {
+		times = append(times, time)
+	}
+	sortTimes(times)
+	for _, time := range times {
+		acts := spec.Activations[time]
+		for _, u := range sortedUuids(acts) {
+			act := acts[u]
+			actLocation := fmt.Sprintf("%s.activations.%d.%v", location, time, u)
+			if !v.beliefs[u] {
+				v.errorf(v.AgentsFile, actLocation, "unknown belief %v", u)
+			}
+			v.checkRange(v.AgentsFile, actLocation, "activation", act, -1, 1)
+		}
+	}
+
+	initial := v.StartTime - 1
+	if _, found := spec.Activations[initial]; !found {
+		v.errorf(v.AgentsFile, location+".activations", "no activations at tick %d, before the start time", initial)
+	} else {
+		for _, u := range v.beliefOrder {
+			if _, found := spec.Activations[initial][u]; !found {
+				v.errorf(v.AgentsFile, fmt.Sprintf("%s.activations.%d", location, initial), "no activation of belief %v", u)
+			}
+		}
+	}
+
+	times = times[:0]
+	for time := range spec.Actions {
+		times = append(times, time)
+	}
+	sortTimes(times)
+	for _, time := range times {
+		u := spec.Actions[time]
+		if !v.behaviours[u] {
+			v.errorf(v.AgentsFile, fmt.Sprintf("%s.actions.%d", location, time), "unknown behaviour %v", u)
+		}
+	}
+
+	for _, u := range sortedUuids(spec.Deltas) {
+		delta := spec.Deltas[u]
+		deltaLocation := fmt.Sprintf("%s.deltas.%v", location, u)
+		if !v.beliefs[u] {
+			v.errorf(v.AgentsFile, deltaLocation, "unknown belief %v", u)
+		}
+		// Nothing limits a delta, but one outside [-1, 1], such as from a
+		// deltaScale, amplifies the activation of the belief at every tick
+		// until it is clamped.
+		if math.IsNaN(delta) || math.IsInf(delta, 0) {
+			v.errorf(v.AgentsFile, deltaLocation, "delta %g is not finite", delta)
+		} else if delta < -1 || delta > 1 {
+			v.warnf(
+				v.AgentsFile,
+				deltaLocation,
+				"delta %g is outside [-1, 1], so the activation is amplified until it is clamped",
+				delta,
+			)
+		}
+	}
+	for _, u := range v.beliefOrder {
+		if _, found := spec.Deltas[u]; !found {
+			v.errorf(v.AgentsFile, location+".deltas", "no delta of belief %v", u)
+		}
+	}
+
+	for _, u := range sortedUuids(spec.Friends) {
+		w := spec.Friends[u]
+		v.checkRange(v.AgentsFile, fmt.Sprintf("%s.friends.%v", location, u), "friend weight", w, 0, 1)
+		if !v.agents[u] {
+			v.pendingFriends = append(v.pendingFriends, friendReference{agent: i, friend: u})
+		}
+	}
+}
+
+// CheckNetwork checks a network read from the NetworkFile, which is attached
+// to the agents. It must be called after every agent has been checked.
+func (v *Validator) CheckNetwork(network Network) {
+	unknown := make(map[uuid.UUID]bool)
+
+	for _, source := range sortedUuids(network) {
+		if !v.agents[source] {
+			unknown[source] = true
+		}
+		friends := network[source]
+		for _, target := range sortedUuids(friends) {
+			if !v.agents[target] {
+				unknown[target] = true
+			}
+			v.checkRange(v.NetworkFile, fmt.Sprintf("%v.%v", source, target), "friend weight", friends[target], 0, 1)
+		}
+	}
+
+	for _, u := range sortedUuids(unknown) {
+		v.errorf(v.NetworkFile, "", "unknown agent %v", u)
+	}
+}
+
+// Finish reports the problems which can only be found once every agent has
+// been checked.
+func (v *Validator) Finish() {
+	for _, ref := range v.pendingFriends {
+		if !v.agents[ref.friend] {
+			v.errorf(v.AgentsFile, fmt.Sprintf("[%d].friends.%v", ref.agent, ref.friend), "unknown agent %v", ref.friend)
+		}
+	}
+	v.pendingFriends = nil
+
+	for _, u := range v.beliefOrder {
+		if !v.beliefsWithPrs[u] {
+			v.Report(Problem{
+				File:     v.PrsFile,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("belief %v has no performance relationships, so it does not affect behaviour", u),
+			})
+		}
+	}
+}
+
+// checkRange reports an error if value is outside [min, max].
+func (v *Validator) checkRange(file, location, name string, value, min, max float64) {
+	if !(value >= min && value <= max) {
+		v.errorf(file, location, "%s %g is outside [%g, %g]", name, value, min, max)
+	}
+}
+
+// errorf reports an error.
+func (v *Validator) errorf(file, location, format string, args ...any) {
+	v.Report(Problem{
+		File:     file,
+		Location: location,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// warnf reports a warning.
+func (v *Validator) warnf(file, location, format string, args ...any) {
+	v.Report(Problem{
+		File:     file,
+		Location: location,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// sortedUuids gets the keys of m in order.
+func sortedUuids[V any](m map[uuid.UUID]V) []uuid.UUID {
+	keys := make([]uuid.UUID, 0, len(m))
+	for u := range m {
+		keys = append(keys, u)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+	return keys
+}
+
+// sortTimes sorts times in increasing order.
+func sortTimes(times []b.SimTime) {
+	sort.Slice(times, func(i, j int) bool {
+		return times[i] < times[j]
+	})
+}
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	b "github.com/0xr0bert/gobelief/beliefspread"
+	"github.com/google/uuid"
+)
+
+func TestValidator(t *testing.T) {
+	beh := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	bel1 := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	bel2 := uuid.MustParse("00000000-0000-0000-0000-000000000003")
+	a1 := uuid.MustParse("00000000-0000-0000-0000-000000000004")
+	a2 := uuid.MustParse("00000000-0000-0000-0000-000000000005")
+	unknown := uuid.MustParse("00000000-0000-0000-0000-000000000009")
+
+	var problems []string
+	v := Validator{
+		BehavioursFile: "behaviours.json",
+		BeliefsFile:    "beliefs.json",
+		PrsFile:        "prs.json",
+		AgentsFile:     "agents.json.zst",
+		StartTime:      1,
+		Report: func(p Problem) {
+			problems = append(problems, p.String())
+		},
+	}
+
+	v.CheckBehaviours([]BehaviourSpec{{Name: "beh", Uuid: beh}})
+	v.CheckBeliefs([]BeliefSpec{
+		{Name: "bel1", Uuid: bel1, Perceptions: map[uuid.UUID]float64{beh: 1.5}},
+		{Name: "bel2", Uuid: bel2, Relationships: map[uuid.UUID]float64{unknown: 0.5}},
+	})
+	v.CheckPrs([]PerformanceRelationshipSpec{
+		{BeliefUuid: bel1, BehaviourUuid: beh, Value: 0.5},
+		{BeliefUuid: bel1, BehaviourUuid: beh, Value: 0.5},
+	})
+	v.CheckAgent(0, &AgentSpec{
+		Uuid:        a1,
+		Activations: map[b.SimTime]map[uuid.UUID]float64{0: {bel1: 0.5, bel2: -2}},
+		Deltas:      map[uuid.UUID]float64{bel1: 1.5, bel2: 1},
+		Friends:     map[uuid.UUID]float64{a2: 1, unknown: 0.5},
+	})
+	v.CheckAgent(1, &AgentSpec{
+		Uuid:        a2,
+		Activations: map[b.SimTime]map[uuid.UUID]float64{1: {bel1: 0.5}},
+		Deltas:      map[uuid.UUID]float64{bel1: 1},
+		Friends:     map[uuid.UUID]float64{a1: 2},
+	})
+	v.CheckAgent(2, &AgentSpec{
+		Uuid:        a2,
+		Activations: map[b.SimTime]map[uuid.UUID]float64{0: {bel1: 0, bel2: 0}},
+		Deltas:      map[uuid.UUID]float64{bel1: 1, bel2: math.Inf(1)},
+	})
+	v.Finish()
+
+	expected := []string{
+		"beliefs.json: [0].perceptions." + beh.String() + ": error: perception 1.5 is outside [-1, 1]",
+		"beliefs.json: [1].relationships." + unknown.String() + ": error: unknown belief " + unknown.String(),
+		"prs.json: [1]: error: duplicate performance relationship of belief " + bel1.String() + " to behaviour " + beh.String(),
+		"agents.json.zst: [0].activations.0." + bel2.String() + ": error: activation -2 is outside [-1, 1]",
+		"agents.json.zst: [0].deltas." + bel1.String() + ": warning: delta 1.5 is outside [-1, 1], so the activation is amplified until it is clamped",
+		"agents.json.zst: [1].activations: error: no activations at tick 0, before the start time",
+		"agents.json.zst: [1].deltas: error: no delta of belief " + bel2.String(),
+		"agents.json.zst: [1].friends." + a1.String() + ": error: friend weight 2 is outside [0, 1]",
+		"agents.json.zst: [2].uuid: error: duplicate agent UUID " + a2.String(),
+		"agents.json.zst: [2].deltas." + bel2.String() + ": error: delta +Inf is not finite",
+		"agents.json.zst: [0].friends." + unknown.String() + ": error: unknown agent " + unknown.String(),
+		"prs.json: warning: belief " + bel2.String() + " has no performance relationships, so it does not affect behaviour",
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Unexpected problems:\n%q\nexpected:\n%q", problems, expected)
+	}
+}
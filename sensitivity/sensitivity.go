@@ -0,0 +1,266 @@
+// Package sensitivity implements global sensitivity analysis of a model with
+// respect to its parameters.
+//
+// A design is a set of points in the space of the parameters, at which the
+// model is run. The indices of each parameter are calculated from the outputs
+// of the model at those points, in the order of the points.
+//
+// Two methods are implemented:
+//   - the elementary effects method of Morris (1991), which is cheap and ranks
+//     parameters by importance; and
+//   - the variance-based method of Sobol, using the sample design of Saltelli
+//     (2002), which estimates the fraction of the variance of the output due to
+//     each parameter alone (the first-order index), and to each parameter and
+//     its interactions (the total index).
+package sensitivity
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Range is the range of values of a parameter.
+type Range struct {
+	// The name of the parameter.
+	Name string
+	// The smallest and largest values of the parameter.
+	Min float64
+	Max float64
+}
+
+// Scale maps a point in the unit hypercube to the ranges.
+func Scale(ranges []Range, unit []float64) []float64 {
+	point := make([]float64, len(ranges))
+	for i, r := range ranges {
+		point[i] = r.Min + unit[i]*(r.Max-r.Min)
+	}
+	return point
+}
+
+// MorrisDesign is a design of random trajectories through a grid of levels in
+// the space of the parameters, in which each step changes one parameter.
+type MorrisDesign struct {
+	// The ranges of the parameters.
+	Ranges []Range
+	// The number of levels of the grid.
+	Levels int
+	// The points of each trajectory, in the unit hypercube. Each trajectory
+	// has len(Ranges)+1 points.
+	Unit [][]float64
+}
+
+// MorrisIndex is the distribution of the elementary effects of a parameter.
+//
+// The elementary effects are the change in the output divided by the change in
+// the parameter, with the range of the parameter scaled to [0, 1].
+type MorrisIndex struct {
+	// The name of the parameter.
+	Name string
+	// The mean of the elementary effects.
+	Mu float64
+	// The mean of the absolute elementary effects, which measures the overall
+	// importance of the parameter.
+	MuStar float64
+	// The standard deviation of the elementary effects, which measures
+	// nonlinearity and interactions with other parameters.
+	Sigma float64
+}
+
+// NewMorrisDesign creates a MorrisDesign with the specified number of
+// trajectories through a grid with the specified (even) number of levels.
+func NewMorrisDesign(
+	ranges []Range,
+	trajectories int,
+	levels int,
+	rng *rand.Rand,
+) (*MorrisDesign, error) {
+	if levels < 2 || levels%2 != 0 {
+		return nil, errors.New("the number of levels must be even and at least 2")
+	}
+	if trajectories < 2 {
+		return nil, errors.New("there must be at least 2 trajectories")
+	}
+
+	k := len(ranges)
+	// The step is chosen so each level is equally likely to be sampled.
+	step := float64(levels) / (2 * float64(levels-1))
+	d := &MorrisDesign{Ranges: ranges, Levels: levels}
+
+	for t := 0; t < trajectories; t++ {
+		x := make([]float64, k)
+		for i := range x {
+			x[i] = float64(rng.Intn(levels)) / float64(levels-1)
+		}
+		d.Unit = append(d.Unit, append([]float64(nil), x...))
+
+		for _, i := range rng.Perm(k) {
+			if x[i]+step <= 1+1e-12 {
+				x[i] += step
+			} else {
+				x[i] -= step
+			}
+			d.Unit = append(d.Unit, append([]float64(nil), x...))
+		}
+	}
+
+	return d, nil
+}
+
+// Points gets the points of the design, scaled to the ranges.
+func (d *MorrisDesign) Points() [][]float64 {
+	points := make([][]float64, len(d.Unit))
+	for i, unit := range d.Unit {
+		points[i] = Scale(d.Ranges, unit)
+	}
+	return points
+}
+
+// Analyse calculates the MorrisIndex of each parameter from the output of the
+// model at each point.
+func (d *MorrisDesign) Analyse(outputs []float64) ([]MorrisIndex, error) {
+	if len(outputs) != len(d.Unit) {
+		return nil, fmt.Errorf("expected %d outputs, got %d", len(d.Unit), len(outputs))
+	}
+
+	k := len(d.Ranges)
+	effects := make([][]float64, k)
+	for start := 0; start < len(d.Unit); start += k + 1 {
+		for s := start; s < start+k; s++ {
+			for i := 0; i < k; i++ {
+				change := d.Unit[s+1][i] - d.Unit[s][i]
+				if change != 0 {
+					effects[i] = append(effects[i], (outputs[s+1]-outputs[s])/change)
+				}
+			}
+		}
+	}
+
+	indices := make([]MorrisIndex, k)
+	for i, r := range d.Ranges {
+		indices[i].Name = r.Name
+		n := float64(len(effects[i]))
+		for _, e := range effects[i] {
+			indices[i].Mu += e / n
+			indices[i].MuStar += math.Abs(e) / n
+		}
+		for _, e := range effects[i] {
+			indices[i].Sigma += math.Pow(e-indices[i].Mu, 2) / (n - 1)
+		}
+		indices[i].Sigma = math.Sqrt(indices[i].Sigma)
+	}
+
+	return indices, nil
+}
+
+// SaltelliDesign is the design of Saltelli (2002) for estimating Sobol indices.
+//
+// It consists of two independent random samples, A and B, and for each
+// parameter i, the sample AB_i, which is A with the values of parameter i taken
+// from B. The points are ordered by sample: for each j, A_j, B_j, then AB_i,j
+// for each i.
+type SaltelliDesign struct {
+	// The ranges of the parameters.
+	Ranges []Range
+	// The number of points in each sample.
+	N int
+	// The points, in the unit hypercube.
+	Unit [][]float64
+}
+
+// SobolIndex is the Sobol indices of a parameter.
+type SobolIndex struct {
+	// The name of the parameter.
+	Name string
+	// The first-order index, the fraction of the variance of the output due to
+	// the parameter alone.
+	S1 float64
+	// The total index, the fraction of the variance of the output due to the
+	// parameter and its interactions with other parameters.
+	ST float64
+}
+
+// NewSaltelliDesign creates a SaltelliDesign with n points in each sample,
+// which has n*(len(ranges)+2) points.
+//
+// The samples are drawn uniformly at random from the ranges.
+func NewSaltelliDesign(ranges []Range, n int, rng *rand.Rand) (*SaltelliDesign, error) {
+	if n < 2 {
+		return nil, errors.New("there must be at least 2 points in each sample")
+	}
+
+	k := len(ranges)
+	d := &SaltelliDesign{Ranges: ranges, N: n}
+	for j := 0; j < n; j++ {
+		a := make([]float64, k)
+		b := make([]float64, k)
+		for i := 0; i < k; i++ {
+			a[i] = rng.Float64()
+			b[i] = rng.Float64()
+		}
+		d.Unit = append(d.Unit, a, b)
+		for i := 0; i < k; i++ {
+			ab := append([]float64(nil), a...)
+			ab[i] = b[i]
+			d.Unit = append(d.Unit, ab)
+		}
+	}
+
+	return d, nil
+}
+
+// Points gets the points of the design, scaled to the ranges.
+func (d *SaltelliDesign) Points() [][]float64 {
+	points := make([][]float64, len(d.Unit))
+	for i, unit := range d.Unit {
+		points[i] = Scale(d.Ranges, unit)
+	}
+	return points
+}
+
+// Analyse calculates the SobolIndex of each parameter from the output of the
+// model at each point.
+//
+// The first-order index uses the estimator of Saltelli et al. (2010), with the
+// output of B centred on the mean to reduce its variance, and the total index
+// uses the estimator of Jansen (1999).
+func (d *SaltelliDesign) Analyse(outputs []float64) ([]SobolIndex, error) {
+	k := len(d.Ranges)
+	if len(outputs) != d.N*(k+2) {
+		return nil, fmt.Errorf("expected %d outputs, got %d", d.N*(k+2), len(outputs))
+	}
+
+	fA := make([]float64, d.N)
+	fB := make([]float64, d.N)
+	for j := 0; j < d.N; j++ {
+		fA[j] = outputs[j*(k+2)]
+		fB[j] = outputs[j*(k+2)+1]
+	}
+
+	mean := 0.0
+	for j := 0; j < d.N; j++ {
+		mean += (fA[j] + fB[j]) / float64(2*d.N)
+	}
+	variance := 0.0
+	for j := 0; j < d.N; j++ {
+		variance += (math.Pow(fA[j]-mean, 2) + math.Pow(fB[j]-mean, 2)) / float64(2*d.N-1)
+	}
+
+	indices := make([]SobolIndex, k)
+	for i, r := range d.Ranges {
+		indices[i].Name = r.Name
+		if variance == 0 {
+			continue
+		}
+		for j := 0; j < d.N; j++ {
+			fAB := outputs[j*(k+2)+2+i]
+			indices[i].S1 += (fB[j] - mean) * (fAB - fA[j]) / float64(d.N)
+			indices[i].ST += math.Pow(fA[j]-fAB, 2) / float64(2*d.N)
+		}
+		indices[i].S1 /= variance
+		indices[i].ST /= variance
+	}
+
+	return indices, nil
+}
@@ -0,0 +1,97 @@
+package sensitivity
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// ranges of two parameters on [0, 1], and a third on [0, 2] which the model
+// ignores.
+var ranges = []Range{
+	{Name: "x1", Min: 0, Max: 1},
+	{Name: "x2", Min: 0, Max: 1},
+	{Name: "x3", Min: 0, Max: 2},
+}
+
+// model is linear in x1 and x2, so the first-order and total indices are equal,
+// and x2 contributes 4 times the variance of x1.
+func model(point []float64) float64 {
+	return point[0] + 2*point[1]
+}
+
+func evaluate(points [][]float64) []float64 {
+	outputs := make([]float64, len(points))
+	for i, point := range points {
+		outputs[i] = model(point)
+	}
+	return outputs
+}
+
+func TestMorris(t *testing.T) {
+	d, err := NewMorrisDesign(ranges, 20, 4, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Unit) != 20*4 {
+		t.Fatalf("There should be 80 points; there were %d", len(d.Unit))
+	}
+
+	indices, err := d.Analyse(evaluate(d.Points()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []float64{1, 2, 0}
+	for i, index := range indices {
+		if math.Abs(index.MuStar-expected[i]) > 1e-9 {
+			t.Errorf("MuStar of %s should be %f; it was %f", index.Name, expected[i], index.MuStar)
+		}
+		if math.Abs(index.Sigma) > 1e-9 {
+			t.Errorf("Sigma of %s should be 0; it was %f", index.Name, index.Sigma)
+		}
+	}
+}
+
+func TestMorrisInvalid(t *testing.T) {
+	_, err := NewMorrisDesign(ranges, 10, 3, rand.New(rand.NewSource(1)))
+	if err == nil {
+		t.Error("Expected error for an odd number of levels")
+	}
+
+	d, err := NewMorrisDesign(ranges, 10, 4, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Analyse([]float64{1})
+	if err == nil {
+		t.Error("Expected error for the wrong number of outputs")
+	}
+}
+
+func TestSobol(t *testing.T) {
+	d, err := NewSaltelliDesign(ranges, 20000, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Unit) != 20000*5 {
+		t.Fatalf("There should be 100000 points; there were %d", len(d.Unit))
+	}
+
+	indices, err := d.Analyse(evaluate(d.Points()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []float64{0.2, 0.8, 0}
+	for i, index := range indices {
+		if math.Abs(index.S1-expected[i]) > 0.03 {
+			t.Errorf("S1 of %s should be %f; it was %f", index.Name, expected[i], index.S1)
+		}
+		if math.Abs(index.ST-expected[i]) > 0.03 {
+			t.Errorf("ST of %s should be %f; it was %f", index.Name, expected[i], index.ST)
+		}
+	}
+}